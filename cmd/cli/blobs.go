@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/eshahhh/blogochain/internal/store"
+)
+
+type uploadDoc struct {
+	File string `json:"file"`
+	store.BlobInfo
+	Ref string `json:"ref"`
+}
+
+func (d uploadDoc) printTable() {
+	if d.Chunks > 1 {
+		fmt.Printf("Stored %s as attachment %s (%d bytes in %d chunks)\n", d.File, d.ID, d.Size, d.Chunks)
+	} else {
+		fmt.Printf("Stored %s as attachment %s (%d bytes)\n", d.File, d.ID, d.Size)
+	}
+	fmt.Printf("Refer to it as %s, e.g. ![image](%s) in a Markdown post\n", d.Ref, d.Ref)
+}
+
+func uploadBlob(args []string) (document, *cliError) {
+	if len(args) == 0 {
+		return nil, usageError("Please provide a file to upload", "Usage: upload <file>")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return nil, failure("upload_failed", fmt.Errorf("Cannot read file: %w", err))
+	}
+	defer f.Close()
+	info, err := activeNode.UploadBlob(f)
+	if err != nil {
+		return nil, failure("upload_failed", fmt.Errorf("Upload failed: %w", err))
+	}
+	return uploadDoc{File: args[0], BlobInfo: info, Ref: "sha256:" + info.ID}, nil
+}
+
+type gcDoc struct {
+	store.GCStats
+}
+
+func (d gcDoc) printTable() {
+	fmt.Printf("Removed %d attachment objects (%d bytes), kept %d\n", d.Removed, d.FreedBytes, d.Kept)
+}
+
+func collectBlobs([]string) (document, *cliError) {
+	stats, err := activeNode.CollectBlobs()
+	if err != nil {
+		return nil, failure("node_error", err)
+	}
+	return gcDoc{stats}, nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+)
+
+// keyFlag adds --key, the file holding the hex ed25519 seed that signs
+// blog transactions, defaulting to BLOGOCHAIN_KEY. Without it the
+// selected wallet account signs.
+func keyFlag(fs *flag.FlagSet) *string {
+	return fs.String("key", os.Getenv("BLOGOCHAIN_KEY"), "file with the signing key from keygen, instead of the wallet account (env BLOGOCHAIN_KEY)")
+}
+
+func loadKey(path string) (ed25519.PrivateKey, *cliError) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, failure("key_unavailable", fmt.Errorf("Cannot read key: %w", err))
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, failure("key_unavailable", fmt.Errorf("%s does not hold a hex ed25519 seed", path))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+type keygenDoc struct {
+	File      string `json:"file"`
+	PublicKey string `json:"public_key"`
+}
+
+func (d keygenDoc) printTable() {
+	fmt.Printf("Key written to %s\n", d.File)
+	fmt.Printf("Public key (author ID): %s\n", d.PublicKey)
+}
+
+func keygen(args []string) (document, *cliError) {
+	if len(args) == 0 {
+		return nil, usageError("Please provide a file to write the key to", "Usage: keygen <file>")
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, failure("keygen_failed", err)
+	}
+	if err := writeKey(args[0], priv); err != nil {
+		return nil, failure("keygen_failed", fmt.Errorf("Cannot create key file: %w", err))
+	}
+	return keygenDoc{File: args[0], PublicKey: hex.EncodeToString(pub)}, nil
+}
+
+type blogTxDoc struct {
+	TxID    string `json:"tx_id"`
+	Type    string `json:"type"`
+	Post    string `json:"post"`
+	Pending int    `json:"pending"`
+}
+
+func (d blogTxDoc) printTable() {
+	switch d.Type {
+	case blockchain.TxPost:
+		fmt.Printf("Post %s added to the pending pool\n", d.TxID)
+	default:
+		fmt.Printf("%s of post %s added to the pending pool (transaction %s)\n", strings.ToUpper(d.Type[:1])+d.Type[1:], d.Post, d.TxID)
+	}
+	fmt.Printf("Total pending: %d\n", d.Pending)
+}
+
+// submitBlogTx signs t with the key in keyPath, or the selected account's,
+// and adds it to the pool.
+func submitBlogTx(t blockchain.BlogTx, keyPath string) (document, *cliError) {
+	key, cerr := signingKey(keyPath)
+	if cerr != nil {
+		return nil, cerr
+	}
+	t.Sign(key)
+	tx := t.Encode()
+	pending, err := activeNode.AddTransaction(tx)
+	if err != nil {
+		return nil, failure("transaction_rejected", fmt.Errorf("Transaction rejected: %w", err))
+	}
+	post := t.Post
+	if t.Type == blockchain.TxPost {
+		post = blockchain.TxID(tx)
+	}
+	return blogTxDoc{TxID: blockchain.TxID(tx), Type: t.Type, Post: post, Pending: pending}, nil
+}
+
+// contentFlags adds the flags shared by post and edit.
+func contentFlags(fs *flag.FlagSet, t *blockchain.BlogTx) (markdown *bool) {
+	fs.StringVar(&t.Title, "title", "", "post title")
+	fs.Func("tag", "tag the post (repeatable)", func(s string) error {
+		t.Tags = append(t.Tags, s)
+		return nil
+	})
+	return fs.Bool("markdown", false, "the body is Markdown rather than plain text")
+}
+
+func setupPost(fs *flag.FlagSet) runFunc {
+	t := blockchain.BlogTx{Type: blockchain.TxPost}
+	key := keyFlag(fs)
+	markdown := contentFlags(fs, &t)
+	return func(args []string) (document, *cliError) {
+		t.Body = strings.Join(args, " ")
+		if t.Title == "" && t.Body == "" {
+			return nil, usageError("Please provide a title or body", "Usage: post --title <title> [--tag t] [--markdown] <body>")
+		}
+		if *markdown {
+			t.ContentType = blockchain.ContentMarkdown
+		}
+		return submitBlogTx(t, *key)
+	}
+}
+
+// setupEdit replaces a post's revision. The title, tags, content type and
+// body that are not given are kept from the current revision.
+func setupEdit(fs *flag.FlagSet) runFunc {
+	t := blockchain.BlogTx{Type: blockchain.TxEdit}
+	key := keyFlag(fs)
+	markdown := contentFlags(fs, &t)
+	return func(args []string) (document, *cliError) {
+		if len(args) == 0 {
+			return nil, usageError("Please provide the ID of the post to edit", "Usage: edit [--title <title>] [--tag t] [--markdown] <post-id> [body]")
+		}
+		current, cerr := findPost(args[0])
+		if cerr != nil {
+			if cerr.Code == "not_found" {
+				cerr.Hint = "Posts can be edited once they are mined"
+			}
+			return nil, cerr
+		}
+		t.Post = current.ID
+		t.Body = strings.Join(args[1:], " ")
+		set := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if !set["title"] {
+			t.Title = current.Title
+		}
+		if !set["tag"] {
+			t.Tags = current.Tags
+		}
+		if t.Body == "" {
+			t.Body = current.Body
+		}
+		t.ContentType = current.ContentType
+		if set["markdown"] {
+			t.ContentType = blockchain.ContentPlain
+			if *markdown {
+				t.ContentType = blockchain.ContentMarkdown
+			}
+		}
+		return submitBlogTx(t, *key)
+	}
+}
+
+func setupDeletePost(fs *flag.FlagSet) runFunc {
+	key := keyFlag(fs)
+	return func(args []string) (document, *cliError) {
+		if len(args) == 0 {
+			return nil, usageError("Please provide the ID of the post to delete", "Usage: delete-post <post-id>")
+		}
+		return submitBlogTx(blockchain.BlogTx{Type: blockchain.TxDelete, Post: strings.ToLower(args[0])}, *key)
+	}
+}
+
+func setupComment(fs *flag.FlagSet) runFunc {
+	key := keyFlag(fs)
+	return func(args []string) (document, *cliError) {
+		if len(args) < 2 {
+			return nil, usageError("Please provide a post ID and a comment", "Usage: comment <post-id> <text>")
+		}
+		t := blockchain.BlogTx{Type: blockchain.TxComment, Post: strings.ToLower(args[0]), Body: strings.Join(args[1:], " ")}
+		return submitBlogTx(t, *key)
+	}
+}
+
+func findPost(id string) (blockchain.Post, *cliError) {
+	p, err := activeNode.Post(strings.ToLower(id))
+	if errors.Is(err, blockchain.ErrNotFound) {
+		return p, failure("not_found", err)
+	}
+	if err != nil {
+		return p, failure("node_error", err)
+	}
+	return p, nil
+}
+
+type postsDoc struct {
+	Count int               `json:"count"`
+	Posts []blockchain.Post `json:"posts"`
+}
+
+func (d postsDoc) printTable() {
+	fmt.Printf("Posts (%d)\n", d.Count)
+	fmt.Println(strings.Repeat("=", 40))
+	for _, p := range d.Posts {
+		fmt.Printf("%s  %s\n", p.Created.Format("2006-01-02 15:04"), p.Title)
+		fmt.Printf("  ID: %s\n", p.ID)
+		fmt.Printf("  Author: %s\n", p.Author)
+		if len(p.Tags) > 0 {
+			fmt.Printf("  Tags: %s\n", strings.Join(p.Tags, ", "))
+		}
+		fmt.Printf("  Revisions: %d, comments: %d\n", len(p.Revisions), len(p.Comments))
+	}
+}
+
+func listPosts([]string) (document, *cliError) {
+	posts, err := activeNode.Posts()
+	if err != nil {
+		return nil, failure("node_error", err)
+	}
+	return postsDoc{Count: len(posts), Posts: posts}, nil
+}
+
+type postDoc struct {
+	blockchain.Post
+}
+
+func (d postDoc) printTable() {
+	if d.Deleted {
+		fmt.Printf("[deleted post]\n")
+	} else {
+		fmt.Printf("%s\n", d.Title)
+	}
+	fmt.Println(strings.Repeat("=", 40))
+	fmt.Printf("ID: %s\n", d.ID)
+	fmt.Printf("Author: %s\n", d.Author)
+	fmt.Printf("Posted: %s in block #%d\n", d.Created.Format("2006-01-02 15:04:05"), d.Height)
+	if !d.Updated.Equal(d.Created) {
+		fmt.Printf("Updated: %s\n", d.Updated.Format("2006-01-02 15:04:05"))
+	}
+	if len(d.Tags) > 0 {
+		fmt.Printf("Tags: %s\n", strings.Join(d.Tags, ", "))
+	}
+	if !d.Deleted {
+		fmt.Printf("\n%s\n", d.Body)
+	}
+
+	fmt.Printf("\nHistory:\n")
+	for i, r := range d.Revisions {
+		fmt.Printf("  %d. %s in block #%d at %s (transaction %s)\n", i+1, r.Type, r.Height, r.Timestamp.Format("2006-01-02 15:04:05"), r.TxID)
+	}
+	if len(d.Comments) > 0 {
+		fmt.Printf("\nComments:\n")
+		for _, c := range d.Comments {
+			fmt.Printf("  %s at %s:\n    %s\n", c.Author[:16]+"...", c.Timestamp.Format("2006-01-02 15:04:05"), c.Body)
+		}
+	}
+}
+
+func showPost(args []string) (document, *cliError) {
+	if len(args) == 0 {
+		return nil, usageError("Please provide a post ID", "Usage: show-post <post-id>; IDs are listed by posts")
+	}
+	p, cerr := findPost(args[0])
+	if cerr != nil {
+		return nil, cerr
+	}
+	return postDoc{p}, nil
+}
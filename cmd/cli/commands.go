@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+)
+
+type runFunc func(args []string) (document, *cliError)
+
+// command is one CLI command. setup defines the command's flags on fs and
+// returns the function that runs it with the remaining arguments; it is
+// called afresh for every invocation so flag values never leak between
+// commands in interactive mode.
+type command struct {
+	Name        string
+	Usage       string
+	Description string
+	// MaxArgs limits positional arguments; -1 means any number.
+	MaxArgs int
+	setup   func(fs *flag.FlagSet) runFunc
+}
+
+var (
+	commands []*command
+	byName   map[string]*command
+)
+
+func init() {
+	commands = []*command{
+		{Name: "create-chain", Usage: "create-chain [difficulty]", Description: "Create a new blockchain with specified difficulty", MaxArgs: 1, setup: setupCreateChain},
+		{Name: "mine-block", Usage: "mine-block", Description: "Mine a block with pending transactions", setup: noFlags(mineBlock)},
+		{Name: "add-tx", Usage: "add-tx [--raw] <data>", Description: "Add a transaction, signed by the wallet account, to pending pool", MaxArgs: -1, setup: setupAddTx},
+		{Name: "show-chain", Usage: "show-chain", Description: "Display the entire blockchain", setup: noFlags(showChain)},
+		{Name: "block", Usage: "block <hash|height>", Description: "Show one block by hash or height", MaxArgs: 1, setup: noFlags(showBlock)},
+		{Name: "tx", Usage: "tx <id>", Description: "Show a mined transaction by ID", MaxArgs: 1, setup: noFlags(showTransaction)},
+		{Name: "wallet", Usage: "wallet <command> [args]", Description: "Manage signing keys: new <name>, import <name> <key-file>, export <name> <file>, list, address [name], use <name>, sign <tx>", MaxArgs: -1, setup: noFlags(walletCommand)},
+		{Name: "keygen", Usage: "keygen <file>", Description: "Create a key for signing blog transactions", MaxArgs: 1, setup: noFlags(keygen)},
+		{Name: "post", Usage: "post [--key file] --title <title> [--tag t] [--markdown] <body>", Description: "Publish a signed blog post", MaxArgs: -1, setup: setupPost},
+		{Name: "edit", Usage: "edit [--key file] [--title <title>] [--tag t] [--markdown] <post-id> [body]", Description: "Publish a new revision of your post", MaxArgs: -1, setup: setupEdit},
+		{Name: "delete-post", Usage: "delete-post [--key file] <post-id>", Description: "Delete your post", MaxArgs: 1, setup: setupDeletePost},
+		{Name: "comment", Usage: "comment [--key file] <post-id> <text>", Description: "Comment on a post", MaxArgs: -1, setup: setupComment},
+		{Name: "posts", Usage: "posts", Description: "List blog posts, newest first", setup: noFlags(listPosts)},
+		{Name: "show-post", Usage: "show-post <post-id>", Description: "Show a post with its history and comments", MaxArgs: 1, setup: noFlags(showPost)},
+		{Name: "upload", Usage: "upload <file>", Description: "Store a file as an attachment posts can refer to", MaxArgs: 1, setup: noFlags(uploadBlob)},
+		{Name: "gc-blobs", Usage: "gc-blobs", Description: "Remove attachments no transaction refers to", setup: noFlags(collectBlobs)},
+		{Name: "notarize", Usage: "notarize <file|hash>", Description: "Timestamp a document on the chain (--remote only)", MaxArgs: 1, setup: noFlags(notarize)},
+		{Name: "receipt", Usage: "receipt <file|hash>", Description: "Fetch a notarized document's receipt (--remote only)", MaxArgs: 1, setup: noFlags(fetchReceipt)},
+		{Name: "export-chain", Usage: "export-chain <file>", Description: "Write the chain to a file for offline checks", MaxArgs: 1, setup: noFlags(exportChain)},
+		{Name: "verify-receipt", Usage: "verify-receipt --chain <file> --difficulty <n> [--document <file>] <receipt>", Description: "Check a notary receipt against a chain export", MaxArgs: 1, setup: setupVerifyReceipt},
+		{Name: "validate", Usage: "validate [--server]", Description: "Validate the blockchain integrity", setup: setupValidate},
+		{Name: "search", Usage: "search [filters] [query]", Description: "Search transactions across all blocks", MaxArgs: -1, setup: setupSearch},
+		{Name: "status", Usage: "status", Description: "Show blockchain status", setup: noFlags(showStatus)},
+		{Name: "clear", Usage: "clear", Description: "Clear the screen", setup: noFlags(clearScreen)},
+		{Name: "reset", Usage: "reset [--yes]", Description: "Reset the blockchain", setup: setupReset},
+		{Name: "watch", Usage: "watch", Description: "Stream new blocks and metrics (--remote only)", setup: noFlags(watch)},
+		{Name: "source", Usage: "source <file>", Description: "Run the commands in a file, one per line", MaxArgs: 1, setup: setupSource},
+		{Name: "history", Usage: "history", Description: "Show interactive command history", setup: noFlags(showHistory)},
+		{Name: "help", Usage: "help [command]", Description: "Show this help message, or help for one command", MaxArgs: 1, setup: noFlags(showHelp)},
+		{Name: "exit", Usage: "exit/quit", Description: "Exit interactive mode"},
+	}
+	byName = make(map[string]*command, len(commands))
+	for _, c := range commands {
+		byName[c.Name] = c
+	}
+	byName["quit"] = byName["exit"]
+}
+
+func noFlags(fn runFunc) func(*flag.FlagSet) runFunc {
+	return func(*flag.FlagSet) runFunc { return fn }
+}
+
+func setupCreateChain(fs *flag.FlagSet) runFunc {
+	difficulty := fs.Int("difficulty", defaultDifficulty, "leading zero hex digits required in block hashes")
+	return func(args []string) (document, *cliError) {
+		d := *difficulty
+		if len(args) == 1 {
+			n, err := parseDifficulty(args[0])
+			if err != nil {
+				return nil, usageError(err.Error(), "Usage: create-chain [--difficulty n | n]")
+			}
+			d = n
+		}
+		if d < 0 {
+			return nil, usageError("difficulty must not be negative", "")
+		}
+		return createChain(d)
+	}
+}
+
+func setupReset(fs *flag.FlagSet) runFunc {
+	yes := fs.Bool("yes", false, "reset without asking for confirmation")
+	return func([]string) (document, *cliError) {
+		return resetBlockchain(*yes)
+	}
+}
+
+func setupSearch(fs *flag.FlagSet) runFunc {
+	var q blockchain.SearchQuery
+	mode := fs.String("mode", "text", "how to read the query: text, block_hash, tx_id, merkle_root or regex")
+	from := fs.Int("from-height", -1, "only blocks at or above this height")
+	to := fs.Int("to-height", -1, "only blocks at or below this height")
+	since := fs.String("since", "", "only blocks stamped at or after this time (RFC 3339 or YYYY-MM-DD)")
+	until := fs.String("until", "", "only blocks stamped at or before this time (RFC 3339 or YYYY-MM-DD)")
+	fs.StringVar(&q.Author, "author", "", "only transactions by this author or public key")
+	fs.StringVar(&q.TxType, "type", "", "only transactions of this type, e.g. text")
+	fs.Func("tag", "only transactions with this tag (repeatable)", func(s string) error {
+		q.Tags = append(q.Tags, s)
+		return nil
+	})
+	fs.StringVar(&q.Miner, "miner", "", "only blocks mined by this name")
+	fs.StringVar(&q.Sort, "sort", "oldest", "oldest or newest first")
+	fs.IntVar(&q.Limit, "limit", blockchain.DefaultSearchLimit, "results per page")
+	fs.StringVar(&q.Cursor, "cursor", "", "continue from a previous page")
+	return func(args []string) (document, *cliError) {
+		q.Text = strings.Join(args, " ")
+		q.Mode = blockchain.SearchMode(*mode)
+		if *from >= 0 {
+			q.FromHeight = from
+		}
+		if *to >= 0 {
+			q.ToHeight = to
+		}
+		var err error
+		if q.Since, err = blockchain.ParseSearchTime(*since, false); err != nil {
+			return nil, usageError("--since: "+err.Error(), "")
+		}
+		if q.Until, err = blockchain.ParseSearchTime(*until, true); err != nil {
+			return nil, usageError("--until: "+err.Error(), "")
+		}
+		return searchTransactions(q)
+	}
+}
+
+func setupSource(*flag.FlagSet) runFunc {
+	return func(args []string) (document, *cliError) {
+		if len(args) != 1 {
+			return nil, usageError("Please provide a file to run", "Usage: source <file>")
+		}
+		return nil, sourceFile(args[0])
+	}
+}
+
+type flagInfo struct {
+	Name    string `json:"name"`
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+}
+
+type commandInfo struct {
+	Name        string     `json:"name"`
+	Usage       string     `json:"usage"`
+	Description string     `json:"description"`
+	Flags       []flagInfo `json:"flags,omitempty"`
+}
+
+func (c *command) info() commandInfo {
+	ci := commandInfo{Name: c.Name, Usage: c.Usage, Description: c.Description}
+	if c.setup != nil {
+		fs := c.flagSet()
+		c.setup(fs)
+		fs.VisitAll(func(f *flag.Flag) {
+			ci.Flags = append(ci.Flags, flagInfo{Name: f.Name, Default: f.DefValue, Usage: f.Usage})
+		})
+	}
+	return ci
+}
+
+func (c *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// run parses args (not including the command name) and runs the command.
+func (c *command) run(args []string) (document, *cliError) {
+	fs := c.flagSet()
+	fn := c.setup(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return commandHelpDoc{c.info()}, nil
+		}
+		return nil, usageError(err.Error(), "Usage: "+c.Usage)
+	}
+	rest := fs.Args()
+	if c.MaxArgs >= 0 && len(rest) > c.MaxArgs {
+		msg := fmt.Sprintf("%s takes no arguments", c.Name)
+		if c.MaxArgs > 0 {
+			msg = fmt.Sprintf("%s takes at most %d argument(s)", c.Name, c.MaxArgs)
+		}
+		return nil, usageError(msg, "Usage: "+c.Usage)
+	}
+	return fn(rest)
+}
+
+type helpDoc struct {
+	Commands []commandInfo `json:"commands"`
+}
+
+func (helpDoc) printTable() {
+	printUsage()
+}
+
+type commandHelpDoc struct {
+	Command commandInfo `json:"command"`
+}
+
+func (d commandHelpDoc) printTable() {
+	c := d.Command
+	fmt.Printf("Usage: %s\n", c.Usage)
+	fmt.Printf("  %s\n", c.Description)
+	if len(c.Flags) > 0 {
+		fmt.Println()
+		fmt.Println("Flags:")
+		for _, f := range c.Flags {
+			fmt.Printf("  --%-20s %s (default %s)\n", f.Name, f.Usage, f.Default)
+		}
+	}
+}
+
+func showHelp(args []string) (document, *cliError) {
+	if len(args) == 1 {
+		c, ok := byName[args[0]]
+		if !ok {
+			return nil, usageError(fmt.Sprintf("Unknown command: %s", args[0]), "Type 'help' for available commands")
+		}
+		return commandHelpDoc{c.info()}, nil
+	}
+	doc := helpDoc{}
+	for _, c := range commands {
+		doc.Commands = append(doc.Commands, c.info())
+	}
+	return doc, nil
+}
+
+// commandNames lists command names starting with prefix, for completion.
+func commandNames(prefix string) []string {
+	var names []string
+	for _, c := range commands {
+		if strings.HasPrefix(c.Name, prefix) {
+			names = append(names, c.Name)
+		}
+	}
+	if strings.HasPrefix("quit", prefix) {
+		names = append(names, "quit")
+	}
+	return names
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const maxHistory = 1000
+
+// history holds interactive command lines, appending them to a file when
+// one is configured so they survive restarts.
+type history struct {
+	entries []string
+	path    string
+}
+
+var cmdHistory = &history{}
+
+// historyPath is BLOGOCHAIN_HISTORY if set (empty disables the file), or
+// ~/.blogochain_history.
+func historyPath() string {
+	if v, ok := os.LookupEnv("BLOGOCHAIN_HISTORY"); ok {
+		return v
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".blogochain_history")
+}
+
+func (h *history) load(path string) {
+	h.path = path
+	if path == "" {
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+	}
+}
+
+// add records line unless it repeats the previous entry.
+func (h *history) add(line string) {
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return
+	}
+	h.entries = append(h.entries, line)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[1:]
+	}
+	if h.path == "" {
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(f, line)
+	f.Close()
+}
+
+type historyDoc struct {
+	Entries []string `json:"entries"`
+}
+
+func (d historyDoc) printTable() {
+	for i, e := range d.Entries {
+		fmt.Printf("%5d  %s\n", i+1, e)
+	}
+}
+
+func showHistory([]string) (document, *cliError) {
+	return historyDoc{Entries: append([]string{}, cmdHistory.entries...)}, nil
+}
+
+// lineEditor reads lines from a terminal with cursor movement, history
+// and tab completion. Supported keys: arrows, Home/End, Delete,
+// Backspace, Ctrl-A/E/B/F (move), Ctrl-P/N (history), Ctrl-K/U/W (kill),
+// Ctrl-L (clear screen), Ctrl-C (discard line) and Ctrl-D (EOF on an
+// empty line).
+type lineEditor struct {
+	fd      int
+	out     io.Writer
+	history *history
+}
+
+func newLineEditor(fd int, h *history) *lineEditor {
+	return &lineEditor{fd: fd, out: progress, history: h}
+}
+
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	state, err := makeRaw(e.fd)
+	if err != nil {
+		return plainReader{}.ReadLine(prompt)
+	}
+	defer restoreTerm(e.fd, state)
+
+	var (
+		buf     []rune
+		pos     int
+		histPos = len(e.history.entries)
+		draft   []rune
+	)
+	setLine := func(s []rune) {
+		buf = append([]rune(nil), s...)
+		pos = len(buf)
+	}
+	e.refresh(prompt, buf, pos)
+
+	for {
+		r, _, err := stdin.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(buf) > 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return string(buf), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case 1: // Ctrl-A
+			pos = 0
+		case 5: // Ctrl-E
+			pos = len(buf)
+		case 2: // Ctrl-B
+			if pos > 0 {
+				pos--
+			}
+		case 6: // Ctrl-F
+			if pos < len(buf) {
+				pos++
+			}
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			buf, pos = nil, 0
+			histPos = len(e.history.entries)
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case 8, 127: // Backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case 11: // Ctrl-K
+			buf = buf[:pos]
+		case 21: // Ctrl-U
+			buf = append([]rune(nil), buf[pos:]...)
+			pos = 0
+		case 23: // Ctrl-W
+			start := pos
+			for start > 0 && buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && buf[start-1] != ' ' {
+				start--
+			}
+			buf = append(buf[:start], buf[pos:]...)
+			pos = start
+		case 12: // Ctrl-L
+			fmt.Fprint(e.out, "\x1b[2J\x1b[H")
+		case 16, 14: // Ctrl-P, Ctrl-N
+			histPos, draft = e.moveHistory(r == 16, histPos, draft, buf, setLine)
+		case '\t':
+			buf, pos = e.complete(prompt, buf, pos)
+		case 27: // escape sequence
+			switch e.readEscape() {
+			case "A":
+				histPos, draft = e.moveHistory(true, histPos, draft, buf, setLine)
+			case "B":
+				histPos, draft = e.moveHistory(false, histPos, draft, buf, setLine)
+			case "C":
+				if pos < len(buf) {
+					pos++
+				}
+			case "D":
+				if pos > 0 {
+					pos--
+				}
+			case "H", "1~", "7~":
+				pos = 0
+			case "F", "4~", "8~":
+				pos = len(buf)
+			case "3~":
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if r >= ' ' {
+				buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+				pos++
+			}
+		}
+		e.refresh(prompt, buf, pos)
+	}
+}
+
+// readEscape reads the rest of an ESC [ or ESC O sequence and returns its
+// final part, such as "A" for up or "3~" for Delete.
+func (e *lineEditor) readEscape() string {
+	r, _, err := stdin.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return ""
+	}
+	var seq []rune
+	for {
+		r, _, err := stdin.ReadRune()
+		if err != nil {
+			return ""
+		}
+		seq = append(seq, r)
+		if r < '0' || r > '9' {
+			return string(seq)
+		}
+	}
+}
+
+// moveHistory steps through history, keeping the line being typed as a
+// draft to return to past the newest entry.
+func (e *lineEditor) moveHistory(back bool, histPos int, draft, buf []rune, setLine func([]rune)) (int, []rune) {
+	entries := e.history.entries
+	if histPos == len(entries) {
+		draft = append([]rune(nil), buf...)
+	}
+	switch {
+	case back && histPos > 0:
+		histPos--
+	case !back && histPos < len(entries):
+		histPos++
+	default:
+		return histPos, draft
+	}
+	if histPos == len(entries) {
+		setLine(draft)
+	} else {
+		setLine([]rune(entries[histPos]))
+	}
+	return histPos, draft
+}
+
+// complete applies tab completion at pos: a single candidate is inserted
+// with a trailing space, several are extended to their common prefix or
+// listed below the prompt.
+func (e *lineEditor) complete(prompt string, buf []rune, pos int) ([]rune, int) {
+	word, candidates := completeLine(string(buf[:pos]))
+	if len(candidates) == 0 {
+		return buf, pos
+	}
+
+	insert := commonPrefix(candidates)
+	if len(candidates) == 1 && !strings.HasSuffix(insert, string(filepath.Separator)) {
+		insert += " "
+	}
+	if len(insert) > len(word) && strings.HasPrefix(insert, word) {
+		add := []rune(insert[len(word):])
+		buf = append(buf[:pos], append(add, buf[pos:]...)...)
+		return buf, pos + len(add)
+	}
+
+	fmt.Fprint(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	return buf, pos
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+func (e *lineEditor) refresh(prompt string, buf []rune, pos int) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+	if back := len(buf) - pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
@@ -1,345 +1,748 @@
 package main
 
 import (
-	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/eshahhh/blogochain/internal/blockchain"
+	"github.com/eshahhh/blogochain/internal/store"
 )
 
 func main() {
-	fmt.Println("Blogochain CLI")
-	fmt.Println("Type 'help' for available commands or 'exit' to quit")
-	fmt.Println(strings.Repeat("=", 50))
+	os.Exit(run())
+}
 
-	if len(os.Args) > 1 && os.Args[1] != "interactive" {
-		executeCommand(os.Args[1:])
-		return
+func run() int {
+	dataDir := "data"
+	if v := os.Getenv("BLOGOCHAIN_DATADIR"); v != "" {
+		dataDir = v
+	}
+	remoteURL := os.Getenv("BLOGOCHAIN_REMOTE")
+	token := os.Getenv("BLOGOCHAIN_TOKEN")
+	genesisHash = os.Getenv("BLOGOCHAIN_GENESIS_HASH")
+	walletDir = defaultWalletDir()
+	if v := os.Getenv("BLOGOCHAIN_WALLET"); v != "" {
+		walletDir = v
+	}
+	accountName = os.Getenv("BLOGOCHAIN_ACCOUNT")
+	output := outputTable
+	if v := os.Getenv("BLOGOCHAIN_OUTPUT"); v != "" {
+		output = v
+	}
+	flags := flag.NewFlagSet("cli", flag.ExitOnError)
+	flags.StringVar(&dataDir, "datadir", dataDir, "directory holding the chain and pending transactions (env BLOGOCHAIN_DATADIR)")
+	flags.StringVar(&remoteURL, "remote", remoteURL, "WebSocket URL of a running server, e.g. ws://localhost:8080/ws (env BLOGOCHAIN_REMOTE)")
+	flags.StringVar(&token, "token", token, "API token for --remote (env BLOGOCHAIN_TOKEN)")
+	flags.StringVar(&genesisHash, "genesis-hash", genesisHash, "hash the chain's genesis block must have (env BLOGOCHAIN_GENESIS_HASH)")
+	flags.StringVar(&walletDir, "wallet", walletDir, "keystore directory (env BLOGOCHAIN_WALLET)")
+	flags.StringVar(&accountName, "account", accountName, "wallet account that signs transactions, instead of the default (env BLOGOCHAIN_ACCOUNT)")
+	flags.StringVar(&output, "output", output, "output format: table, json or yaml (env BLOGOCHAIN_OUTPUT)")
+	flags.Usage = printUsage
+	flags.Parse(os.Args[1:])
+	args := flags.Args()
+
+	format, err := parseOutputFormat(output)
+	if err != nil {
+		return emitError("", usageError(err.Error(), "Use --output table, json or yaml"))
+	}
+	outputFormat = format
+	if structuredOutput() {
+		progress = os.Stderr
+		blockchain.SetOutput(progress)
 	}
 
-	scanner := bufio.NewScanner(os.Stdin)
+	interactive := len(args) == 0 || args[0] == "interactive"
+	if interactive || !structuredOutput() {
+		fmt.Fprintln(progress, "Blogochain CLI")
+		fmt.Fprintln(progress, "Type 'help' for available commands or 'exit' to quit")
+		fmt.Fprintln(progress, strings.Repeat("=", 50))
+	}
 
-	for {
-		fmt.Print("\nblogochain> ")
+	if remoteURL != "" {
+		r, err := dialRemote(remoteURL, token)
+		if err != nil {
+			return emitError("", failure("remote_unreachable", fmt.Errorf("Cannot reach server: %w", err)))
+		}
+		defer r.Close()
+		remote = r
+		activeNode = r
+		fmt.Fprintf(progress, "Connected to %s\n", remoteURL)
+	} else {
+		st, err := store.Open(dataDir)
+		if err != nil {
+			return emitError("", failure("datadir_unavailable", fmt.Errorf("Cannot open data directory: %w", err)))
+		}
+		defer st.Close()
+		chainStore = st
+		if err := loadBlockchain(); err != nil {
+			return emitError("", failure("load_failed", err))
+		}
+	}
+
+	if !interactive {
+		return executeCommand(args)
+	}
+
+	var in lineReader = plainReader{}
+	if fd := int(os.Stdin.Fd()); isTerminal(fd) {
+		cmdHistory.load(historyPath())
+		in = newLineEditor(fd, cmdHistory)
+	}
 
-		if !scanner.Scan() {
+	for {
+		fmt.Fprint(progress, "\n")
+		line, err := in.ReadLine("blogochain> ")
+		if err == io.EOF {
 			break
 		}
-
-		input := strings.TrimSpace(scanner.Text())
-		if input == "" {
+		if err != nil {
+			fmt.Fprintf(progress, "Error reading input: %v\n", err)
+			return exitFailure
+		}
+		if strings.TrimSpace(line) == "" {
 			continue
 		}
+		cmdHistory.add(strings.TrimSpace(line))
 
-		if input == "exit" || input == "quit" {
-			fmt.Println("Goodbye!")
+		if _, quit := runLine(line); quit {
+			fmt.Fprintln(progress, "Goodbye!")
 			break
 		}
-
-		args := strings.Fields(input)
-		executeCommand(args)
-	}
-
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("Error reading input: %v\n", err)
 	}
+	return exitOK
 }
 
-func executeCommand(args []string) {
+// executeCommand runs one command, prints its result or error in the
+// selected output format and returns the exit code.
+func executeCommand(args []string) int {
 	if len(args) == 0 {
-		return
+		return exitOK
 	}
 
-	command := args[0]
-
-	oldArgs := os.Args
-	os.Args = append([]string{"cli"}, args...)
-	defer func() { os.Args = oldArgs }()
-
-	switch command {
-	case "create-chain":
-		createChain()
-	case "mine-block":
-		mineBlock()
-	case "add-tx":
-		addTransaction()
-	case "show-chain":
-		showChain()
-	case "validate":
-		validateChain()
-	case "search":
-		searchTransactions()
-	case "help":
-		printUsage()
-	case "status":
-		showStatus()
-	case "clear":
-		clearScreen()
-	case "reset":
-		resetBlockchain()
-	default:
-		fmt.Printf("Unknown command: %s\n", command)
-		fmt.Println("Type 'help' for available commands")
+	name := args[0]
+	c, ok := byName[name]
+	if !ok || c.setup == nil {
+		return emitError(name, usageError(fmt.Sprintf("Unknown command: %s", name), "Type 'help' for available commands"))
 	}
+
+	doc, err := c.run(args[1:])
+	if saveErr := saveBlockchain(); saveErr != nil && err == nil {
+		err = failure("save_failed", saveErr)
+	}
+	if err != nil {
+		return emitError(name, err)
+	}
+	emit(doc)
+	if v, ok := doc.(*validationDoc); ok && !v.Valid {
+		return exitFailure
+	}
+	return exitOK
 }
 
 func printUsage() {
 	fmt.Println("Blogochain CLI")
-	fmt.Println("Usage: ./cli [interactive] or ./cli <command> [options]")
+	fmt.Println("Usage: ./cli [global options] [interactive] or ./cli [global options] <command> [options]")
+	fmt.Println()
+	fmt.Println("Global options:")
+	fmt.Println("  --datadir <dir>              - Chain data directory (default \"data\", env BLOGOCHAIN_DATADIR)")
+	fmt.Println("  --remote <url>               - Run commands against a server, e.g. ws://localhost:8080/ws (env BLOGOCHAIN_REMOTE)")
+	fmt.Println("  --token <token>              - API token for --remote (env BLOGOCHAIN_TOKEN)")
+	fmt.Println("  --genesis-hash <hash>        - Reject chains with a different genesis block (env BLOGOCHAIN_GENESIS_HASH)")
+	fmt.Println("  --wallet <dir>               - Keystore directory (default ~/.blogochain_wallet, env BLOGOCHAIN_WALLET)")
+	fmt.Println("  --account <name>             - Wallet account that signs transactions (env BLOGOCHAIN_ACCOUNT)")
+	fmt.Println("  --output <format>            - table (default), json or yaml (env BLOGOCHAIN_OUTPUT)")
 	fmt.Println()
 	fmt.Println("Commands:")
-	fmt.Println("  create-chain [difficulty]    - Create a new blockchain with specified difficulty")
-	fmt.Println("  mine-block                   - Mine a block with pending transactions")
-	fmt.Println("  add-tx <data>                - Add a transaction to pending pool")
-	fmt.Println("  show-chain                   - Display the entire blockchain")
-	fmt.Println("  validate                     - Validate the blockchain integrity")
-	fmt.Println("  search <query>               - Search transactions across all blocks")
-	fmt.Println("  status                       - Show blockchain status")
-	fmt.Println("  clear                        - Clear the screen")
-	fmt.Println("  reset                        - Reset the blockchain")
-	fmt.Println("  help                         - Show this help message")
-	fmt.Println("  exit/quit                    - Exit interactive mode")
+	for _, c := range commands {
+		fmt.Printf("  %-29s- %s\n", c.Usage, c.Description)
+	}
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  ./cli                        # Start interactive mode")
 	fmt.Println("  ./cli create-chain 3         # Single command mode")
+	fmt.Println("  ./cli add-tx Hello && ./cli mine-block")
+	fmt.Println("                               # State persists between invocations")
+	fmt.Println("  ./cli --remote ws://localhost:8080/ws watch")
+	fmt.Println("  ./cli --output json status   # Machine-readable output")
+	fmt.Println("  ./cli source setup.txt       # Run a file of commands")
 	fmt.Println("  In interactive mode:")
 	fmt.Println("    add-tx \"Hello, blockchain!\"")
 	fmt.Println("    mine-block")
 	fmt.Println("    search \"Hello\"")
+	fmt.Println("    help reset                 # Flags for one command")
+	fmt.Println("  Quote arguments as in a shell; Tab completes commands, flags and block hashes.")
 }
 
-var globalBlockchain *blockchain.Blockchain
+var (
+	globalBlockchain *blockchain.Blockchain
+	chainStore       *store.Store
+	// genesisHash, if set, is checked by validate and status.
+	genesisHash string
+
+	// activeNode is what commands run against; remote is set as well when
+	// it is a server.
+	activeNode node = localNode{}
+	remote     *remoteNode
+)
+
+// loadBlockchain restores the chain saved in the data directory, if any.
+func loadBlockchain() error {
+	state, err := chainStore.Load()
+	if errors.Is(err, store.ErrNoChain) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Cannot load chain from %s: %w", chainStore.Dir(), err)
+	}
+	bc, err := blockchain.Restore(state)
+	if err != nil {
+		return fmt.Errorf("Cannot load chain from %s: %w", chainStore.Dir(), err)
+	}
+	bc.SetGenesisHash(genesisHash)
+	globalBlockchain = bc
+	return nil
+}
+
+// saveBlockchain writes the chain back to the data directory if it changed.
+func saveBlockchain() error {
+	if globalBlockchain == nil || chainStore == nil {
+		return nil
+	}
+	if err := chainStore.Save(globalBlockchain); err != nil {
+		return fmt.Errorf("Failed to save chain to %s: %w", chainStore.Dir(), err)
+	}
+	return nil
+}
+
+const defaultDifficulty = 4
+
+func parseDifficulty(s string) (int, error) {
+	d, err := strconv.Atoi(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid difficulty %q", s)
+	}
+	return d, nil
+}
 
 func getOrCreateBlockchain() *blockchain.Blockchain {
+	return getOrCreateBlockchainWith(defaultDifficulty)
+}
+
+// getOrCreateBlockchainWith creates the chain with difficulty if there is
+// none yet.
+func getOrCreateBlockchainWith(difficulty int) *blockchain.Blockchain {
 	if globalBlockchain == nil {
-		difficulty := 4
-		if len(os.Args) > 2 {
-			if d, err := strconv.Atoi(os.Args[2]); err == nil && d >= 0 {
-				difficulty = d
-			}
-		}
-		fmt.Printf("Creating new blockchain with difficulty %d\n", difficulty)
+		fmt.Fprintf(progress, "Creating new blockchain with difficulty %d\n", difficulty)
 		globalBlockchain = blockchain.NewBlockchain(difficulty)
+		globalBlockchain.SetGenesisHash(genesisHash)
 	}
 	return globalBlockchain
 }
 
-func createChain() {
-	bc := getOrCreateBlockchain()
-	fmt.Printf("Blockchain created with %d blocks\n", len(bc.GetChain()))
-	fmt.Printf("Current difficulty: %d\n", bc.GetDifficulty())
-	fmt.Printf("Pending transactions: %d\n", len(bc.GetPendingTransactions()))
+func remoteOnlyError(command string) *cliError {
+	return &cliError{
+		Code:    "unsupported_remote",
+		Message: command + " is not available with --remote; the server owns its chain",
+		exit:    exitFailure,
+	}
 }
 
-func mineBlock() {
-	bc := getOrCreateBlockchain()
+type chainSummaryDoc struct {
+	Blocks     int `json:"blocks"`
+	Difficulty int `json:"difficulty"`
+	Pending    int `json:"pending"`
+}
+
+func (d chainSummaryDoc) printTable() {
+	fmt.Printf("Blockchain created with %d blocks\n", d.Blocks)
+	fmt.Printf("Current difficulty: %d\n", d.Difficulty)
+	fmt.Printf("Pending transactions: %d\n", d.Pending)
+}
+
+func createChain(difficulty int) (document, *cliError) {
+	if remote != nil {
+		return nil, remoteOnlyError("create-chain")
+	}
+	bc := getOrCreateBlockchainWith(difficulty)
+	return chainSummaryDoc{
+		Blocks:     len(bc.GetChain()),
+		Difficulty: bc.GetDifficulty(),
+		Pending:    len(bc.GetPendingTransactions()),
+	}, nil
+}
+
+type minedBlockDoc struct {
+	Block      *blockchain.Block `json:"block"`
+	DurationMs float64           `json:"duration_ms"`
+	Hashrate   float64           `json:"hashrate"`
+}
+
+func (d minedBlockDoc) printTable() {
+	fmt.Printf("\nBlock mined successfully!\n")
+	fmt.Printf("Block #%d\n", d.Block.Index)
+	fmt.Printf("Hash: %s\n", d.Block.Hash)
+	fmt.Printf("Nonce: %d\n", d.Block.Nonce)
+	fmt.Printf("Mining time: %v\n", time.Duration(d.DurationMs*float64(time.Millisecond)))
+	if d.Hashrate > 0 {
+		fmt.Printf("Hashrate: %.2f H/s\n", d.Hashrate)
+	}
+}
 
-	pending := bc.GetPendingTransactions()
+func mineBlock([]string) (document, *cliError) {
+	pending, err := activeNode.Pending()
+	if err != nil {
+		return nil, failure("node_error", err)
+	}
 	if len(pending) == 0 {
-		fmt.Println("No pending transactions to mine")
-		fmt.Println("Use 'add-tx <data>' to add transactions first")
-		return
+		return nil, &cliError{
+			Code:    "nothing_to_mine",
+			Message: "No pending transactions to mine",
+			Hint:    "Use 'add-tx <data>' to add transactions first",
+			exit:    exitFailure,
+		}
 	}
 
-	fmt.Printf("Mining block with %d pending transactions...\n", len(pending))
-	fmt.Printf("Current difficulty: %d\n", bc.GetDifficulty())
-	fmt.Println(strings.Repeat("-", 40))
+	fmt.Fprintf(progress, "Mining block with %d pending transactions...\n", len(pending))
+	if st, err := activeNode.Status(); err == nil {
+		fmt.Fprintf(progress, "Current difficulty: %d\n", st.Difficulty)
+	}
+	fmt.Fprintln(progress, strings.Repeat("-", 40))
 
 	start := time.Now()
-	block := bc.MineBlock()
+	block, hashrate, err := activeNode.MineBlock()
 	duration := time.Since(start)
 
-	if block != nil {
-		hashrate := bc.LastHashrate()
-		fmt.Printf("\nBlock mined successfully!\n")
-		fmt.Printf("Block #%d\n", block.Index)
-		fmt.Printf("Hash: %s\n", block.Hash)
-		fmt.Printf("Nonce: %d\n", block.Nonce)
-		fmt.Printf("Mining time: %v\n", duration)
-		fmt.Printf("Hashrate: %.2f H/s\n", hashrate)
-	} else {
-		fmt.Println("Mining failed")
+	if err != nil {
+		return nil, failure("mining_failed", fmt.Errorf("Mining failed: %w", err))
 	}
+	return minedBlockDoc{
+		Block:      block,
+		DurationMs: float64(duration) / float64(time.Millisecond),
+		Hashrate:   hashrate,
+	}, nil
 }
 
-func addTransaction() {
-	if len(os.Args) < 3 {
-		fmt.Println("Please provide transaction data")
-		fmt.Println("Usage: ./cli add-tx \"transaction data\"")
-		return
+type addTxDoc struct {
+	Transaction string `json:"transaction"`
+	TxID        string `json:"tx_id"`
+	Author      string `json:"author,omitempty"`
+	Pending     int    `json:"pending"`
+}
+
+func (d addTxDoc) printTable() {
+	fmt.Printf("Transaction added: %s\n", d.Transaction)
+	if d.Author != "" {
+		fmt.Printf("Signed by: %s\n", d.Author)
+	}
+	fmt.Printf("Total pending: %d\n", d.Pending)
+}
+
+func setupAddTx(fs *flag.FlagSet) runFunc {
+	raw := fs.Bool("raw", false, "add the data as it is instead of signing it with the wallet account")
+	return func(args []string) (document, *cliError) {
+		return addTransaction(strings.Join(args, " "), *raw)
 	}
+}
 
-	data := strings.Join(os.Args[2:], " ")
-	bc := getOrCreateBlockchain()
-	bc.AddTransaction(data)
+// addTransaction adds data to the pool. Unless raw is set or no wallet
+// account is selected, data goes in a note signed by the account.
+func addTransaction(data string, raw bool) (document, *cliError) {
+	if data == "" {
+		return nil, usageError("Please provide transaction data", "Usage: ./cli add-tx [--raw] \"transaction data\"")
+	}
 
-	fmt.Printf("Transaction added: %s\n", data)
-	fmt.Printf("Total pending: %d\n", len(bc.GetPendingTransactions()))
+	doc := addTxDoc{Transaction: data}
+	if !raw {
+		account, cerr := selectedAccount()
+		if cerr != nil {
+			return nil, cerr
+		}
+		if account != "" {
+			key, cerr := unlockAccount(account)
+			if cerr != nil {
+				return nil, cerr
+			}
+			t := blockchain.BlogTx{Type: blockchain.TxNote, Body: data}
+			t.Sign(key)
+			doc.Transaction, doc.Author = t.Encode(), t.Author
+		}
+	}
+	pending, err := activeNode.AddTransaction(doc.Transaction)
+	if err != nil {
+		return nil, failure("transaction_rejected", fmt.Errorf("Transaction rejected: %w", err))
+	}
+	doc.TxID, doc.Pending = blockchain.TxID(doc.Transaction), pending
+	return doc, nil
 }
 
-func showChain() {
-	bc := getOrCreateBlockchain()
-	chain := bc.GetChain()
+type chainDoc struct {
+	Length     int                 `json:"length"`
+	Difficulty int                 `json:"difficulty"`
+	Pending    int                 `json:"pending"`
+	Valid      bool                `json:"valid"`
+	Blocks     []*blockchain.Block `json:"blocks"`
+}
 
+func (d chainDoc) printTable() {
 	fmt.Printf("Blockchain Overview\n")
 	fmt.Println(strings.Repeat("=", 50))
-	fmt.Printf("Total blocks: %d\n", len(chain))
-	fmt.Printf("Current difficulty: %d\n", bc.GetDifficulty())
-	fmt.Printf("Pending transactions: %d\n", len(bc.GetPendingTransactions()))
-	fmt.Printf("Chain valid: %t\n", bc.IsValid())
+	fmt.Printf("Total blocks: %d\n", d.Length)
+	fmt.Printf("Current difficulty: %d\n", d.Difficulty)
+	fmt.Printf("Pending transactions: %d\n", d.Pending)
+	fmt.Printf("Chain valid: %t\n", d.Valid)
 	fmt.Println()
 
-	for i, block := range chain {
-		fmt.Printf("Block #%d\n", block.Index)
-		fmt.Printf("  Timestamp: %s\n", block.Timestamp.Format("2006-01-02 15:04:05"))
-		fmt.Printf("  Hash: %s\n", block.Hash)
-		fmt.Printf("  Previous: %s\n", block.PrevHash)
-		fmt.Printf("  Nonce: %d\n", block.Nonce)
-		fmt.Printf("  Difficulty: %d\n", block.Difficulty)
-		fmt.Printf("  Merkle Root: %s\n", block.MerkleRoot)
-		fmt.Printf("  Transactions (%d):\n", len(block.Transactions))
-		for j, tx := range block.Transactions {
-			fmt.Printf("    %d. %s\n", j+1, tx)
-		}
-
-		if i < len(chain)-1 {
+	for i, block := range d.Blocks {
+		printBlock(block)
+		if i < len(d.Blocks)-1 {
 			fmt.Println(strings.Repeat("-", 30))
 		}
 	}
 }
 
-func validateChain() {
-	bc := getOrCreateBlockchain()
+func printBlock(block *blockchain.Block) {
+	fmt.Printf("Block #%d\n", block.Index)
+	fmt.Printf("  Timestamp: %s\n", block.Timestamp.Format("2006-01-02 15:04:05"))
+	fmt.Printf("  Hash: %s\n", block.Hash)
+	fmt.Printf("  Previous: %s\n", block.PrevHash)
+	fmt.Printf("  Nonce: %d\n", block.Nonce)
+	fmt.Printf("  Difficulty: %d\n", block.Difficulty)
+	fmt.Printf("  Merkle Root: %s\n", block.MerkleRoot)
+	fmt.Printf("  Transactions (%d):\n", len(block.Transactions))
+	for j, tx := range block.Transactions {
+		fmt.Printf("    %d. %s\n", j+1, tx)
+	}
+}
+
+func showChain([]string) (document, *cliError) {
+	chain, err := activeNode.Chain()
+	if err != nil {
+		return nil, failure("node_error", err)
+	}
+	st, err := activeNode.Status()
+	if err != nil {
+		return nil, failure("node_error", err)
+	}
+	return chainDoc{
+		Length:     len(chain),
+		Difficulty: st.Difficulty,
+		Pending:    st.Pending,
+		Valid:      st.Valid,
+		Blocks:     chain,
+	}, nil
+}
+
+type blockDoc struct {
+	*blockchain.Block
+}
+
+func (d blockDoc) printTable() {
+	printBlock(d.Block)
+}
+
+// showBlock looks a block up by height if the argument is a number and
+// by hash otherwise.
+func showBlock(args []string) (document, *cliError) {
+	if len(args) == 0 {
+		return nil, usageError("Please provide a block hash or height", "Usage: block <hash|height>")
+	}
+	var block *blockchain.Block
+	var err error
+	if height, convErr := strconv.Atoi(args[0]); convErr == nil && len(args[0]) < 64 {
+		block, err = activeNode.BlockByHeight(height)
+	} else {
+		block, err = activeNode.BlockByHash(args[0])
+	}
+	if errors.Is(err, blockchain.ErrNotFound) {
+		return nil, failure("not_found", err)
+	}
+	if err != nil {
+		return nil, failure("node_error", err)
+	}
+	return blockDoc{block}, nil
+}
+
+type txDoc struct {
+	blockchain.TxRecord
+}
+
+func (d txDoc) printTable() {
+	fmt.Printf("Transaction %s\n", d.TxID)
+	fmt.Printf("  Block: #%d (Hash: %s)\n", d.Height, d.BlockHash)
+	fmt.Printf("  Position: %d\n", d.TxIndex+1)
+	fmt.Printf("  Timestamp: %s\n", d.Timestamp.Format("2006-01-02 15:04:05"))
+	fmt.Printf("  Confirmations: %d\n", d.Confirmations)
+	fmt.Printf("  Data: %s\n", d.Transaction)
+}
+
+func showTransaction(args []string) (document, *cliError) {
+	if len(args) == 0 {
+		return nil, usageError("Please provide a transaction ID", "Usage: tx <id>; IDs are listed by search")
+	}
+	tx, err := activeNode.Transaction(args[0])
+	if errors.Is(err, blockchain.ErrNotFound) {
+		return nil, failure("not_found", err)
+	}
+	if err != nil {
+		return nil, failure("node_error", err)
+	}
+	return txDoc{tx}, nil
+}
+
+type validationDoc struct {
+	blockchain.ValidationReport
+	Source        string  `json:"source"`
+	DurationMs    float64 `json:"duration_ms"`
+	BlocksChecked int     `json:"blocks_checked"`
+}
 
+func (d *validationDoc) printTable() {
 	fmt.Println("Validating blockchain...")
 	fmt.Println(strings.Repeat("=", 30))
 
-	start := time.Now()
-	isValid := bc.IsValid()
-	duration := time.Since(start)
-
-	if isValid {
+	if d.Valid {
 		fmt.Printf("Blockchain is valid!\n")
 	} else {
 		fmt.Printf("Blockchain validation failed!\n")
 	}
 
-	fmt.Printf("Validation time: %v\n", duration)
-	fmt.Printf("Total blocks validated: %d\n", len(bc.GetChain()))
+	fmt.Printf("Validation time: %v\n", time.Duration(d.DurationMs*float64(time.Millisecond)))
+	fmt.Printf("Total blocks validated: %d\n", d.BlocksChecked)
 
-	chain := bc.GetChain()
 	fmt.Println("\nDetailed validation:")
 
-	for i, block := range chain {
-		fmt.Printf("  Block #%d: ", block.Index)
+	for _, b := range d.Blocks {
+		if b.Valid {
+			fmt.Printf("  Block #%d: OK\n", b.Index)
+			continue
+		}
+		fmt.Printf("  Block #%d: %d problem(s)\n", b.Index, len(b.Issues))
+		for _, issue := range b.Issues {
+			fmt.Printf("    - %s: %s\n", issue.Code, issue.Message)
+		}
+	}
+}
+
+func setupValidate(fs *flag.FlagSet) runFunc {
+	server := fs.Bool("server", false, "with --remote, report the server's own validation instead of checking the downloaded chain")
+	return func([]string) (document, *cliError) {
+		return validateChain(*server)
+	}
+}
 
-		if i > 0 && block.PrevHash != chain[i-1].Hash {
-			fmt.Printf("Previous hash mismatch\n")
-		} else if len(block.Hash) != 64 {
-			fmt.Printf("Invalid hash format\n")
-		} else {
-			fmt.Printf("OK\n")
+func validateChain(server bool) (document, *cliError) {
+	source := "local"
+	if remote != nil {
+		source = "downloaded"
+	}
+	validate := activeNode.Validate
+	if server {
+		if remote == nil {
+			return nil, usageError("--server needs --remote", "")
 		}
+		source = "server"
+		validate = remote.ServerValidate
+	}
+
+	start := time.Now()
+	report, err := validate()
+	duration := time.Since(start)
+	if err != nil {
+		return nil, failure("node_error", err)
 	}
+
+	return &validationDoc{
+		ValidationReport: report,
+		Source:           source,
+		DurationMs:       float64(duration) / float64(time.Millisecond),
+		BlocksChecked:    len(report.Blocks),
+	}, nil
 }
 
-func showStatus() {
-	if globalBlockchain == nil {
+type latestBlockDoc struct {
+	Index     int       `json:"index"`
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type statusDoc struct {
+	Initialized bool            `json:"initialized"`
+	Server      string          `json:"server,omitempty"`
+	Blocks      int             `json:"blocks"`
+	Difficulty  int             `json:"difficulty"`
+	Pending     int             `json:"pending"`
+	Valid       bool            `json:"valid"`
+	Latest      *latestBlockDoc `json:"latest,omitempty"`
+	Hashrate    float64         `json:"hashrate"`
+}
+
+func (d statusDoc) printTable() {
+	if !d.Initialized {
 		fmt.Println("Blockchain Status: Not initialized")
 		fmt.Println("Use 'create-chain [difficulty]' to initialize")
 		return
 	}
 
-	bc := globalBlockchain
-	chain := bc.GetChain()
-	pending := bc.GetPendingTransactions()
-
 	fmt.Println("Blockchain Status")
 	fmt.Println(strings.Repeat("=", 30))
-	fmt.Printf("Total blocks: %d\n", len(chain))
-	fmt.Printf("Difficulty: %d\n", bc.GetDifficulty())
-	fmt.Printf("Pending transactions: %d\n", len(pending))
-	fmt.Printf("Chain valid: %t\n", bc.IsValid())
-
-	if len(chain) > 0 {
-		latestBlock := bc.GetLatestBlock()
-		fmt.Printf("Latest block: #%d\n", latestBlock.Index)
-		fmt.Printf("Latest hash: %s\n", latestBlock.Hash[:16]+"...")
-		fmt.Printf("Latest timestamp: %s\n", latestBlock.Timestamp.Format("15:04:05"))
+	if d.Server != "" {
+		fmt.Printf("Server: %s\n", d.Server)
+	}
+	fmt.Printf("Total blocks: %d\n", d.Blocks)
+	fmt.Printf("Difficulty: %d\n", d.Difficulty)
+	fmt.Printf("Pending transactions: %d\n", d.Pending)
+	fmt.Printf("Chain valid: %t\n", d.Valid)
+
+	if d.Latest != nil {
+		fmt.Printf("Latest block: #%d\n", d.Latest.Index)
+		fmt.Printf("Latest hash: %s\n", d.Latest.Hash[:16]+"...")
+		fmt.Printf("Latest timestamp: %s\n", d.Latest.Timestamp.Format("15:04:05"))
 	}
 
-	hashrate := bc.LastHashrate()
-	if hashrate > 0 {
-		fmt.Printf("Last hashrate: %.2f H/s\n", hashrate)
+	if d.Hashrate > 0 {
+		fmt.Printf("Last hashrate: %.2f H/s\n", d.Hashrate)
 	}
 }
 
-func searchTransactions() {
-	if len(os.Args) < 3 {
-		fmt.Println("Please provide search query")
-		fmt.Println("Usage: ./cli search \"query\"")
-		return
+func showStatus([]string) (document, *cliError) {
+	st, err := activeNode.Status()
+	if errors.Is(err, errNotInitialized) {
+		return statusDoc{Initialized: false}, nil
+	}
+	if err != nil {
+		return nil, failure("node_error", err)
 	}
 
-	query := strings.Join(os.Args[2:], " ")
-	bc := getOrCreateBlockchain()
+	doc := statusDoc{
+		Initialized: true,
+		Blocks:      st.Blocks,
+		Difficulty:  st.Difficulty,
+		Pending:     st.Pending,
+		Valid:       st.Valid,
+		Hashrate:    st.Hashrate,
+	}
+	if remote != nil {
+		doc.Server = remote.url
+	}
+	if st.Latest != nil {
+		doc.Latest = &latestBlockDoc{Index: st.Latest.Index, Hash: st.Latest.Hash, Timestamp: st.Latest.Timestamp}
+	}
+	return doc, nil
+}
 
-	results := bc.SearchData(query)
+type searchDoc struct {
+	Query      string                    `json:"query"`
+	Count      int                       `json:"count"`
+	Total      int                       `json:"total"`
+	NextCursor string                    `json:"next_cursor,omitempty"`
+	Results    []blockchain.SearchResult `json:"results"`
+}
 
-	fmt.Printf("Search results for \"%s\":\n", query)
+func (d searchDoc) printTable() {
+	fmt.Printf("Search results for \"%s\":\n", d.Query)
 	fmt.Println(strings.Repeat("=", 40))
 
-	if len(results) == 0 {
+	if len(d.Results) == 0 {
 		fmt.Println("No transactions found matching the query")
 		return
 	}
 
-	fmt.Printf("Found %d blocks containing the query:\n", len(results))
+	fmt.Printf("Found %d matching transactions, showing %d:\n", d.Total, d.Count)
 	fmt.Println()
 
-	for _, block := range results {
-		fmt.Printf("Block #%d (Hash: %s)\n", block.Index, block.Hash[:16]+"...")
-		fmt.Printf("  Timestamp: %s\n", block.Timestamp.Format("2006-01-02 15:04:05"))
-		fmt.Printf("  Matching transactions:\n")
-
-		for i, tx := range block.Transactions {
-			if containsQuery(tx, query) {
-				fmt.Printf("    %d. %s\n", i+1, tx)
+	for _, r := range d.Results {
+		fmt.Printf("Block #%d, transaction %d (Hash: %s)\n", r.Height, r.TxIndex+1, r.BlockHash[:16]+"...")
+		fmt.Printf("  Timestamp: %s\n", r.Timestamp.Format("2006-01-02 15:04:05"))
+		fmt.Printf("  Transaction ID: %s\n", r.TxID)
+		if r.Type != "text" {
+			fmt.Printf("  Type: %s", r.Type)
+			if r.Author != "" {
+				fmt.Printf(", author %s", r.Author)
+			}
+			if len(r.Tags) > 0 {
+				fmt.Printf(", tags %s", strings.Join(r.Tags, ", "))
 			}
+			fmt.Println()
 		}
+		fmt.Printf("  %s\n", r.Snippet)
 		fmt.Println()
 	}
+	if d.NextCursor != "" {
+		fmt.Printf("More results: repeat the search with --cursor %s\n", d.NextCursor)
+	}
+}
+
+func searchTransactions(q blockchain.SearchQuery) (document, *cliError) {
+	page, err := activeNode.Search(q)
+	if errors.Is(err, blockchain.ErrBadQuery) {
+		hint := "Combine words with AND, OR and NOT; use \"...\" for phrases and word* for prefixes"
+		switch q.Mode {
+		case "", blockchain.SearchText:
+		case blockchain.SearchRegex:
+			hint = fmt.Sprintf("Regexes use RE2 syntax and may be at most %d bytes", blockchain.MaxRegexLength)
+		default:
+			hint = "--mode takes text, block_hash, tx_id, merkle_root or regex"
+		}
+		return nil, usageError(err.Error(), hint)
+	}
+	if errors.Is(err, blockchain.ErrSearchBudget) {
+		return nil, failure("search_budget", err)
+	}
+	if err != nil {
+		return nil, failure("node_error", err)
+	}
+	return searchDoc{Query: q.Text, Count: len(page.Results), Total: page.Total, NextCursor: page.NextCursor, Results: page.Results}, nil
 }
 
-func containsQuery(text, query string) bool {
-	text = strings.ToLower(text)
-	query = strings.ToLower(query)
-	return strings.Contains(text, query)
+func watch([]string) (document, *cliError) {
+	if remote == nil {
+		return nil, usageError("watch needs a server; use --remote <url>", "")
+	}
+	if err := remote.watch(emit); err != nil {
+		return nil, failure("remote_error", err)
+	}
+	return nil, nil
 }
 
-func clearScreen() {
+func clearScreen([]string) (document, *cliError) {
+	if structuredOutput() {
+		return nil, nil
+	}
 	fmt.Print("\033[2J\033[H")
 	fmt.Println("Blogochain Interactive CLI")
 	fmt.Println("Screen cleared!")
+	return nil, nil
 }
 
-func resetBlockchain() {
-	fmt.Print("Are you sure you want to reset the blockchain? (y/N): ")
+type resetDoc struct {
+	Reset bool `json:"reset"`
+}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	if scanner.Scan() {
-		response := strings.ToLower(strings.TrimSpace(scanner.Text()))
-		if response == "y" || response == "yes" {
-			globalBlockchain = nil
-			fmt.Println("Blockchain reset successfully!")
-			fmt.Println("Use 'create-chain [difficulty]' to create a new blockchain")
-		} else {
-			fmt.Println("Reset cancelled")
-		}
+func (d resetDoc) printTable() {
+	if d.Reset {
+		fmt.Println("Blockchain reset successfully!")
+		fmt.Println("Use 'create-chain [difficulty]' to create a new blockchain")
+	} else {
+		fmt.Println("Reset cancelled")
+	}
+}
+
+func resetBlockchain(yes bool) (document, *cliError) {
+	if remote != nil {
+		return nil, remoteOnlyError("reset")
+	}
+	if !yes && !confirm("Are you sure you want to reset the blockchain? (y/N): ") {
+		return resetDoc{Reset: false}, nil
+	}
+	if err := chainStore.Reset(); err != nil {
+		return nil, failure("reset_failed", fmt.Errorf("Failed to delete saved chain: %w", err))
 	}
+	globalBlockchain = nil
+	return resetDoc{Reset: true}, nil
 }
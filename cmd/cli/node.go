@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"io"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+	"github.com/eshahhh/blogochain/internal/store"
+)
+
+var errNotInitialized = errors.New("blockchain not initialized")
+
+type chainStatus struct {
+	Blocks     int
+	Difficulty int
+	Pending    int
+	Valid      bool
+	Latest     *blockchain.Block
+	Hashrate   float64
+}
+
+// node is what the commands run against: the chain in the local data
+// directory, or a running server when --remote is given.
+type node interface {
+	AddTransaction(data string) (pending int, err error)
+	MineBlock() (block *blockchain.Block, hashrate float64, err error)
+	Chain() ([]*blockchain.Block, error)
+	BlockByHash(hash string) (*blockchain.Block, error)
+	BlockByHeight(height int) (*blockchain.Block, error)
+	Transaction(id string) (blockchain.TxRecord, error)
+	Posts() ([]blockchain.Post, error)
+	Post(id string) (blockchain.Post, error)
+	Pending() ([]string, error)
+	Search(q blockchain.SearchQuery) (blockchain.SearchPage, error)
+	Status() (chainStatus, error)
+	Validate() (blockchain.ValidationReport, error)
+	UploadBlob(r io.Reader) (store.BlobInfo, error)
+	CollectBlobs() (store.GCStats, error)
+}
+
+// localNode works on globalBlockchain, creating it on first use.
+type localNode struct{}
+
+func (localNode) AddTransaction(data string) (int, error) {
+	bc := getOrCreateBlockchain()
+	if err := bc.AddTransaction(data); err != nil {
+		return 0, err
+	}
+	return len(bc.GetPendingTransactions()), nil
+}
+
+func (localNode) MineBlock() (*blockchain.Block, float64, error) {
+	bc := getOrCreateBlockchain()
+	block := bc.MineBlock()
+	if block == nil {
+		return nil, 0, errors.New("mining failed")
+	}
+	return block, bc.LastHashrate(), nil
+}
+
+func (localNode) Chain() ([]*blockchain.Block, error) {
+	return getOrCreateBlockchain().GetChain(), nil
+}
+
+func (localNode) BlockByHash(hash string) (*blockchain.Block, error) {
+	return getOrCreateBlockchain().GetBlockByHash(hash)
+}
+
+func (localNode) BlockByHeight(height int) (*blockchain.Block, error) {
+	return getOrCreateBlockchain().GetBlockByHeight(height)
+}
+
+func (localNode) Transaction(id string) (blockchain.TxRecord, error) {
+	return getOrCreateBlockchain().GetTransaction(id)
+}
+
+func (localNode) Posts() ([]blockchain.Post, error) {
+	return getOrCreateBlockchain().Posts(), nil
+}
+
+func (localNode) Post(id string) (blockchain.Post, error) {
+	return getOrCreateBlockchain().Post(id)
+}
+
+func (localNode) Pending() ([]string, error) {
+	return getOrCreateBlockchain().GetPendingTransactions(), nil
+}
+
+func (localNode) Search(q blockchain.SearchQuery) (blockchain.SearchPage, error) {
+	return getOrCreateBlockchain().Search(q)
+}
+
+func (localNode) Status() (chainStatus, error) {
+	if globalBlockchain == nil {
+		return chainStatus{}, errNotInitialized
+	}
+	bc := globalBlockchain
+	return chainStatus{
+		Blocks:     len(bc.GetChain()),
+		Difficulty: bc.GetDifficulty(),
+		Pending:    len(bc.GetPendingTransactions()),
+		Valid:      bc.IsValid(),
+		Latest:     bc.GetLatestBlock(),
+		Hashrate:   bc.LastHashrate(),
+	}, nil
+}
+
+func (localNode) Validate() (blockchain.ValidationReport, error) {
+	return getOrCreateBlockchain().Validate(), nil
+}
+
+func (localNode) UploadBlob(r io.Reader) (store.BlobInfo, error) {
+	return chainStore.Blobs().Put(r)
+}
+
+func (localNode) CollectBlobs() (store.GCStats, error) {
+	return chainStore.Blobs().GC(getOrCreateBlockchain().ReferencedAttachments(), store.BlobGracePeriod)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+	"github.com/eshahhh/blogochain/internal/notary"
+	"github.com/eshahhh/blogochain/internal/store"
+)
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// documentHash reads arg as a file to hash or, if there is no such file,
+// as a hex SHA-256.
+func documentHash(arg string) (string, error) {
+	if _, err := os.Stat(arg); err == nil {
+		return hashFile(arg)
+	}
+	hash := strings.ToLower(arg)
+	if !notary.IsHash(hash) {
+		return "", fmt.Errorf("%s is neither a file nor a SHA-256 hash", arg)
+	}
+	return hash, nil
+}
+
+type notarizeDoc struct {
+	DocumentHash string `json:"document_hash"`
+	Status       string `json:"status"`
+	Receipt      string `json:"receipt"`
+}
+
+func (d notarizeDoc) printTable() {
+	fmt.Printf("Document %s is %s\n", d.DocumentHash, d.Status)
+	fmt.Printf("Fetch its receipt with: receipt %s\n", d.DocumentHash)
+}
+
+func notarize(args []string) (document, *cliError) {
+	if remote == nil {
+		return nil, usageError("notarize needs a server; use --remote <url>", "")
+	}
+	if len(args) == 0 {
+		return nil, usageError("Please provide a file or its SHA-256", "Usage: notarize <file|hash>")
+	}
+	hash, err := documentHash(args[0])
+	if err != nil {
+		return nil, usageError(err.Error(), "Usage: notarize <file|hash>")
+	}
+	body, _ := json.Marshal(map[string]string{"document_hash": hash})
+	resp, err := remote.httpRequest(http.MethodPost, "/notarize", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, failure("remote_error", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, failure("remote_error", httpError(resp))
+	}
+	var doc notarizeDoc
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, failure("remote_error", err)
+	}
+	return doc, nil
+}
+
+type receiptDoc struct {
+	notary.Receipt
+}
+
+func (d receiptDoc) printTable() {
+	fmt.Printf("Document %s\n", d.DocumentHash)
+	fmt.Printf("  Batch root:   %s (%d proof steps)\n", d.BatchRoot, len(d.Path))
+	fmt.Printf("  Transaction:  %s\n", d.TxID)
+	fmt.Printf("  Block:        #%d %s\n", d.BlockHeight, d.BlockHash)
+	fmt.Printf("  Timestamp:    %s\n", d.Timestamp.Format("2006-01-02 15:04:05 MST"))
+	fmt.Println("Save it with --output json to check it later with verify-receipt")
+}
+
+func fetchReceipt(args []string) (document, *cliError) {
+	if remote == nil {
+		return nil, usageError("receipt needs a server; use --remote <url>", "")
+	}
+	if len(args) == 0 {
+		return nil, usageError("Please provide a file or its SHA-256", "Usage: receipt <file|hash>")
+	}
+	hash, err := documentHash(args[0])
+	if err != nil {
+		return nil, usageError(err.Error(), "Usage: receipt <file|hash>")
+	}
+	resp, err := remote.httpRequest(http.MethodGet, "/notary/receipts/"+hash, "", nil)
+	if err != nil {
+		return nil, failure("remote_error", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusAccepted:
+		var status notarizeDoc
+		json.NewDecoder(resp.Body).Decode(&status)
+		return nil, failure("receipt_pending", fmt.Errorf("Document %s is %s; its batch is not mined yet", hash, status.Status))
+	case http.StatusNotFound:
+		return nil, failure("not_found", fmt.Errorf("Document %s was never notarized", hash))
+	default:
+		return nil, failure("remote_error", httpError(resp))
+	}
+	var doc receiptDoc
+	if err := json.NewDecoder(resp.Body).Decode(&doc.Receipt); err != nil {
+		return nil, failure("remote_error", err)
+	}
+	return doc, nil
+}
+
+type exportDoc struct {
+	File   string `json:"file"`
+	Blocks int    `json:"blocks"`
+}
+
+func (d exportDoc) printTable() {
+	fmt.Printf("Exported %d blocks to %s\n", d.Blocks, d.File)
+}
+
+func exportChain(args []string) (document, *cliError) {
+	if len(args) == 0 {
+		return nil, usageError("Please provide a file to write", "Usage: export-chain <file>")
+	}
+	status, err := activeNode.Status()
+	if err != nil {
+		return nil, failure("node_error", err)
+	}
+	blocks, err := activeNode.Chain()
+	if err != nil {
+		return nil, failure("node_error", err)
+	}
+	data, err := json.MarshalIndent(store.ChainDoc{Difficulty: status.Difficulty, Blocks: blocks}, "", "  ")
+	if err == nil {
+		err = os.WriteFile(args[0], data, 0o644)
+	}
+	if err != nil {
+		return nil, failure("export_failed", fmt.Errorf("Cannot write %s: %w", args[0], err))
+	}
+	return exportDoc{File: args[0], Blocks: len(blocks)}, nil
+}
+
+type receiptCheckDoc struct {
+	DocumentHash  string `json:"document_hash"`
+	BlockHeight   int    `json:"block_height"`
+	BlockHash     string `json:"block_hash"`
+	Timestamp     string `json:"timestamp"`
+	Confirmations int    `json:"confirmations"`
+}
+
+func (d receiptCheckDoc) printTable() {
+	fmt.Printf("Receipt OK: document %s existed by %s\n", d.DocumentHash, d.Timestamp)
+	fmt.Printf("  Block #%d %s, %d confirmations\n", d.BlockHeight, d.BlockHash, d.Confirmations)
+}
+
+func setupVerifyReceipt(fs *flag.FlagSet) runFunc {
+	chainFile := fs.String("chain", "", "chain export to check against, from export-chain")
+	docFile := fs.String("document", "", "the notarized file, to check it matches the receipt")
+	difficulty := fs.Int("difficulty", -1, "leading zero hex digits every block must have")
+	return func(args []string) (document, *cliError) {
+		const usage = "Usage: verify-receipt --chain <file> --difficulty <n> [--document <file>] <receipt.json>"
+		if len(args) == 0 || *chainFile == "" {
+			return nil, usageError("Please provide a receipt and a chain export", usage)
+		}
+		if *difficulty < 0 {
+			return nil, usageError("Please provide the difficulty every block must meet", usage)
+		}
+		if genesisHash == "" {
+			return nil, usageError("Please pin the chain with --genesis-hash", usage)
+		}
+		return verifyReceipt(args[0], *chainFile, *docFile, *difficulty)
+	}
+}
+
+// verifyReceipt checks a saved receipt against a chain export alone, so
+// neither needs to come from a server the user trusts. The export's own
+// difficulty is ignored: --genesis-hash pins which chain it must be, and
+// every block must meet difficulty.
+func verifyReceipt(receiptFile, chainFile, docFile string, difficulty int) (document, *cliError) {
+	var r notary.Receipt
+	if err := readJSONFile(receiptFile, &r); err != nil {
+		return nil, failure("receipt_invalid", fmt.Errorf("Cannot read receipt: %w", err))
+	}
+	var chain store.ChainDoc
+	if err := readJSONFile(chainFile, &chain); err != nil {
+		return nil, failure("receipt_invalid", fmt.Errorf("Cannot read chain export: %w", err))
+	}
+	if docFile != "" {
+		hash, err := hashFile(docFile)
+		if err != nil {
+			return nil, failure("receipt_invalid", fmt.Errorf("Cannot read document: %w", err))
+		}
+		if hash != r.DocumentHash {
+			return nil, failure("receipt_invalid", fmt.Errorf("%s has hash %s, but the receipt is for %s", docFile, hash, r.DocumentHash))
+		}
+	}
+	report := blockchain.ValidateChainAtLeast(chain.Blocks, difficulty, genesisHash)
+	if !report.Valid {
+		return nil, failure("receipt_invalid", fmt.Errorf("The chain export is invalid from block #%d", report.FirstInvalid))
+	}
+	if err := r.Verify(chain.Blocks); err != nil {
+		return nil, failure("receipt_invalid", err)
+	}
+	return receiptCheckDoc{
+		DocumentHash:  r.DocumentHash,
+		BlockHeight:   r.BlockHeight,
+		BlockHash:     r.BlockHash,
+		Timestamp:     r.Timestamp.Format("2006-01-02 15:04:05 MST"),
+		Confirmations: len(chain.Blocks) - r.BlockHeight,
+	}, nil
+}
+
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.New("not valid JSON: " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Output formats for --output. table is the human-readable text the CLI
+// has always printed; json and yaml print one document per command.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// Exit codes for single-command mode.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+var (
+	outputFormat = outputTable
+	// stdout receives documents and progress everything else: prompts,
+	// banners and mining progress from the CLI and the chain. In json and
+	// yaml mode progress is stderr, so only documents reach stdout.
+	stdout   io.Writer = os.Stdout
+	progress io.Writer = os.Stdout
+)
+
+func parseOutputFormat(s string) (string, error) {
+	switch s {
+	case outputTable, outputJSON, outputYAML:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown output format %q (want table, json or yaml)", s)
+}
+
+func structuredOutput() bool {
+	return outputFormat != outputTable
+}
+
+// document is a command result. printTable renders it as text for the
+// table format; json and yaml marshal it using its JSON tags.
+type document interface {
+	printTable()
+}
+
+// cliError is a command failure. It is printed as {"error": {...}} in json
+// and yaml mode and as Message followed by Hint in table mode.
+type cliError struct {
+	Command string `json:"command,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+	exit    int
+}
+
+func (e *cliError) Error() string {
+	return e.Message
+}
+
+func (e *cliError) printTable() {
+	fmt.Println(e.Message)
+	if e.Hint != "" {
+		fmt.Println(e.Hint)
+	}
+}
+
+func usageError(message, hint string) *cliError {
+	return &cliError{Code: "usage", Message: message, Hint: hint, exit: exitUsage}
+}
+
+func failure(code string, err error) *cliError {
+	return &cliError{Code: code, Message: err.Error(), exit: exitFailure}
+}
+
+// emit writes doc in the selected format.
+func emit(doc document) {
+	if doc == nil {
+		return
+	}
+	switch outputFormat {
+	case outputTable:
+		doc.printTable()
+	case outputJSON:
+		enc := json.NewEncoder(stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(doc); err != nil {
+			fmt.Fprintf(os.Stderr, "encode output: %v\n", err)
+		}
+	case outputYAML:
+		if err := writeYAML(stdout, doc); err != nil {
+			fmt.Fprintf(os.Stderr, "encode output: %v\n", err)
+		}
+	}
+}
+
+// emitError writes err and returns the exit code it calls for.
+func emitError(command string, err *cliError) int {
+	err.Command = command
+	if structuredOutput() {
+		emit(errorDoc{Error: err})
+	} else {
+		err.printTable()
+	}
+	return err.exit
+}
+
+type errorDoc struct {
+	Error *cliError `json:"error"`
+}
+
+func (d errorDoc) printTable() {
+	d.Error.printTable()
+}
+
+// writeYAML marshals v through its JSON form, keeping field order, and
+// writes it as a YAML document. Strings are always double-quoted, which
+// YAML reads with the same escapes as JSON.
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := marshalJSON(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := decodeOrdered(dec)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("---\n")
+	writeYAMLNode(&b, node, 0)
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// marshalJSON is json.Marshal without escaping <, > and &.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+type yamlField struct {
+	key   string
+	value interface{}
+}
+
+// decodeOrdered reads one JSON value, returning objects as []yamlField so
+// the struct field order survives.
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			fields := []yamlField{}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, yamlField{key: key.(string), value: value})
+			}
+			_, err := dec.Token()
+			return fields, err
+		case '[':
+			items := []interface{}{}
+			for dec.More() {
+				item, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			_, err := dec.Token()
+			return items, err
+		}
+	}
+	return tok, nil
+}
+
+var plainYAMLKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func yamlScalar(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		if t {
+			return "true"
+		}
+		return "false"
+	case json.Number:
+		return t.String()
+	case string:
+		b, _ := marshalJSON(t)
+		return string(b)
+	case []yamlField:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	}
+	return fmt.Sprint(v)
+}
+
+func yamlKey(k string) string {
+	if plainYAMLKey.MatchString(k) {
+		return k
+	}
+	return yamlScalar(k)
+}
+
+// inlineYAML reports whether v is written on the same line as its key:
+// scalars and empty collections.
+func inlineYAML(v interface{}) bool {
+	switch t := v.(type) {
+	case []yamlField:
+		return len(t) == 0
+	case []interface{}:
+		return len(t) == 0
+	}
+	return true
+}
+
+func writeYAMLNode(b *strings.Builder, node interface{}, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch t := node.(type) {
+	case []yamlField:
+		if len(t) == 0 {
+			b.WriteString(pad + "{}\n")
+			return
+		}
+		for _, f := range t {
+			if inlineYAML(f.value) {
+				fmt.Fprintf(b, "%s%s: %s\n", pad, yamlKey(f.key), yamlScalar(f.value))
+				continue
+			}
+			fmt.Fprintf(b, "%s%s:\n", pad, yamlKey(f.key))
+			writeYAMLNode(b, f.value, indent+1)
+		}
+	case []interface{}:
+		if len(t) == 0 {
+			b.WriteString(pad + "[]\n")
+			return
+		}
+		for _, item := range t {
+			if inlineYAML(item) {
+				fmt.Fprintf(b, "%s- %s\n", pad, yamlScalar(item))
+				continue
+			}
+			// Nest under the dash; the first line shares it.
+			var nested strings.Builder
+			writeYAMLNode(&nested, item, indent+1)
+			text := nested.String()
+			b.WriteString(pad + "- " + strings.TrimPrefix(text, pad+"  "))
+		}
+	default:
+		b.WriteString(pad + yamlScalar(t) + "\n")
+	}
+}
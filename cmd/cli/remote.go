@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+	"github.com/eshahhh/blogochain/internal/store"
+	"github.com/gorilla/websocket"
+)
+
+const remoteTimeout = 15 * time.Second
+
+// serverMsg covers every message type the server's Hub sends; each type
+// only fills in its own fields.
+type serverMsg struct {
+	Type         string                    `json:"type"`
+	Success      bool                      `json:"success"`
+	Message      string                    `json:"message"`
+	Data         json.RawMessage           `json:"data"`
+	Results      []blockchain.SearchResult `json:"results"`
+	Total        int                       `json:"total"`
+	NextCursor   string                    `json:"next_cursor"`
+	Blocks       []*blockchain.Block       `json:"blocks"`
+	Block        *blockchain.Block         `json:"block"`
+	Transactions []string                  `json:"transactions"`
+
+	Miners         int     `json:"miners"`
+	Pending        int     `json:"pending"`
+	ChainLen       int     `json:"chain_len"`
+	Difficulty     int     `json:"difficulty"`
+	ServerHashrate float64 `json:"server_hashrate"`
+
+	JobID      string  `json:"job_id"`
+	State      string  `json:"state"`
+	BlockIndex int     `json:"block_index"`
+	Nonce      int     `json:"nonce"`
+	Attempts   int64   `json:"attempts"`
+	ElapsedMs  int64   `json:"elapsed_ms"`
+	Hashrate   float64 `json:"hashrate"`
+
+	RequestType  string `json:"request_type"`
+	RetryAfterMs int64  `json:"retry_after_ms"`
+}
+
+// remoteNode runs commands against a server's /ws endpoint.
+type remoteNode struct {
+	url      string
+	token    string
+	conn     *websocket.Conn
+	incoming chan serverMsg
+	readErr  error
+	metrics  *serverMsg
+}
+
+func dialRemote(url, token string) (*remoteNode, error) {
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("connect to %s: %s", url, resp.Status)
+		}
+		return nil, fmt.Errorf("connect to %s: %w", url, err)
+	}
+	r := &remoteNode{url: url, token: token, conn: conn, incoming: make(chan serverMsg, 64)}
+	go r.readLoop()
+	return r, nil
+}
+
+func (r *remoteNode) readLoop() {
+	defer close(r.incoming)
+	for {
+		_, data, err := r.conn.ReadMessage()
+		if err != nil {
+			r.readErr = err
+			return
+		}
+		var msg serverMsg
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		r.incoming <- msg
+	}
+}
+
+func (r *remoteNode) Close() error {
+	r.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return r.conn.Close()
+}
+
+func (r *remoteNode) send(v interface{}) error {
+	r.conn.SetWriteDeadline(time.Now().Add(remoteTimeout))
+	return r.conn.WriteJSON(v)
+}
+
+// await returns the next message whose type is one of want, passing every
+// other message to other (if non-nil). A zero timeout waits indefinitely.
+// Failed responses and rate limits for the request come back as errors.
+func (r *remoteNode) await(timeout time.Duration, other func(serverMsg), want ...string) (serverMsg, error) {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		select {
+		case msg, ok := <-r.incoming:
+			if !ok {
+				if r.readErr != nil {
+					return serverMsg{}, fmt.Errorf("connection to %s lost: %w", r.url, r.readErr)
+				}
+				return serverMsg{}, fmt.Errorf("connection to %s closed", r.url)
+			}
+			if msg.Type == "metrics" {
+				m := msg
+				r.metrics = &m
+			}
+			for _, w := range want {
+				if msg.Type != w {
+					continue
+				}
+				if isResponse(msg.Type) && !msg.Success {
+					return msg, errors.New(msg.Message)
+				}
+				return msg, nil
+			}
+			if msg.Type == "rate_limited" {
+				for _, w := range want {
+					if w == msg.RequestType+"_response" {
+						return msg, fmt.Errorf("%s (retry in %dms)", msg.Message, msg.RetryAfterMs)
+					}
+				}
+			}
+			if other != nil {
+				other(msg)
+			}
+		case <-deadline:
+			return serverMsg{}, fmt.Errorf("timed out waiting for %v from %s", want, r.url)
+		}
+	}
+}
+
+func isResponse(msgType string) bool {
+	return strings.HasSuffix(msgType, "_response") || msgType == "mine_block_queued"
+}
+
+func (r *remoteNode) request(v interface{}, want ...string) (serverMsg, error) {
+	if err := r.send(v); err != nil {
+		return serverMsg{}, err
+	}
+	return r.await(remoteTimeout, nil, want...)
+}
+
+func (r *remoteNode) latestMetrics() (serverMsg, error) {
+	if r.metrics != nil {
+		return *r.metrics, nil
+	}
+	return r.await(remoteTimeout, nil, "metrics")
+}
+
+func (r *remoteNode) AddTransaction(data string) (int, error) {
+	if _, err := r.request(map[string]string{"type": "add_transaction", "data": data}, "add_transaction_response"); err != nil {
+		return 0, err
+	}
+	pending, err := r.Pending()
+	return len(pending), err
+}
+
+func (r *remoteNode) MineBlock() (*blockchain.Block, float64, error) {
+	queued, err := r.request(map[string]string{"type": "mine_block"}, "mine_block_queued", "mine_block_response")
+	if err != nil {
+		return nil, 0, err
+	}
+	var job struct {
+		JobID    string `json:"job_id"`
+		Position int    `json:"position"`
+	}
+	json.Unmarshal(queued.Data, &job)
+	fmt.Fprintf(progress, "Mining job %s queued at position %d on %s\n", job.JobID, job.Position, r.url)
+
+	var hashrate float64
+	progress := func(msg serverMsg) {
+		if msg.Type == "mining_progress" && msg.JobID == job.JobID {
+			hashrate = msg.Hashrate
+			fmt.Fprintf(progress, "  nonce %d, %d attempts, %.1fs, %.0f H/s\n", msg.Nonce, msg.Attempts, float64(msg.ElapsedMs)/1000, msg.Hashrate)
+		}
+	}
+	for {
+		msg, err := r.await(0, progress, "mine_block_response")
+		var result struct {
+			JobID string            `json:"job_id"`
+			Block *blockchain.Block `json:"block"`
+		}
+		json.Unmarshal(msg.Data, &result)
+		if result.JobID != job.JobID {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if hashrate == 0 && r.metrics != nil {
+			hashrate = r.metrics.ServerHashrate
+		}
+		return result.Block, hashrate, nil
+	}
+}
+
+func (r *remoteNode) Chain() ([]*blockchain.Block, error) {
+	msg, err := r.request(map[string]string{"type": "get_chain"}, "chain")
+	return msg.Blocks, err
+}
+
+func (r *remoteNode) BlockByHash(hash string) (*blockchain.Block, error) {
+	msg, err := r.request(map[string]string{"type": "get_block", "hash": hash}, "get_block_response")
+	return msg.Block, notFound(err)
+}
+
+func (r *remoteNode) BlockByHeight(height int) (*blockchain.Block, error) {
+	msg, err := r.request(map[string]interface{}{"type": "get_block", "height": height}, "get_block_response")
+	return msg.Block, notFound(err)
+}
+
+func (r *remoteNode) Transaction(id string) (blockchain.TxRecord, error) {
+	var tx blockchain.TxRecord
+	msg, err := r.request(map[string]string{"type": "get_transaction", "tx_id": id}, "get_transaction_response")
+	if err != nil {
+		return tx, notFound(err)
+	}
+	err = json.Unmarshal(msg.Data, &tx)
+	return tx, err
+}
+
+func (r *remoteNode) Posts() ([]blockchain.Post, error) {
+	var posts []blockchain.Post
+	msg, err := r.request(map[string]string{"type": "get_posts"}, "get_posts_response")
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(msg.Data, &posts)
+	return posts, err
+}
+
+func (r *remoteNode) Post(id string) (blockchain.Post, error) {
+	var post blockchain.Post
+	msg, err := r.request(map[string]string{"type": "get_post", "post_id": id}, "get_post_response")
+	if err != nil {
+		return post, notFound(err)
+	}
+	err = json.Unmarshal(msg.Data, &post)
+	return post, err
+}
+
+// notFound turns the server's "...: not found" failures back into
+// blockchain.ErrNotFound.
+func notFound(err error) error {
+	if err != nil && strings.HasSuffix(err.Error(), ": "+blockchain.ErrNotFound.Error()) {
+		return fmt.Errorf("%s: %w", strings.TrimSuffix(err.Error(), ": "+blockchain.ErrNotFound.Error()), blockchain.ErrNotFound)
+	}
+	return err
+}
+
+func (r *remoteNode) Pending() ([]string, error) {
+	msg, err := r.request(map[string]string{"type": "get_pending"}, "pending_transactions")
+	return msg.Transactions, err
+}
+
+func (r *remoteNode) Search(q blockchain.SearchQuery) (blockchain.SearchPage, error) {
+	req := struct {
+		Type string `json:"type"`
+		blockchain.SearchQuery
+	}{"search_chain", q}
+	msg, err := r.request(req, "search_chain_response")
+	return blockchain.SearchPage{Results: msg.Results, Total: msg.Total, NextCursor: msg.NextCursor}, err
+}
+
+func (r *remoteNode) Status() (chainStatus, error) {
+	chain, err := r.Chain()
+	if err != nil {
+		return chainStatus{}, err
+	}
+	pending, err := r.Pending()
+	if err != nil {
+		return chainStatus{}, err
+	}
+	m, err := r.latestMetrics()
+	if err != nil {
+		return chainStatus{}, err
+	}
+	st := chainStatus{
+		Blocks:     len(chain),
+		Difficulty: m.Difficulty,
+		Pending:    len(pending),
+		Valid:      blockchain.ValidateChain(chain, m.Difficulty, genesisHash).Valid,
+		Hashrate:   m.ServerHashrate,
+	}
+	if len(chain) > 0 {
+		st.Latest = chain[len(chain)-1]
+	}
+	return st, nil
+}
+
+// Validate downloads the chain and checks it locally rather than trusting
+// the server's own verdict.
+func (r *remoteNode) Validate() (blockchain.ValidationReport, error) {
+	var report blockchain.ValidationReport
+	chain, err := r.Chain()
+	if err != nil {
+		return report, err
+	}
+	m, err := r.latestMetrics()
+	if err != nil {
+		return report, err
+	}
+	return blockchain.ValidateChain(chain, m.Difficulty, genesisHash), nil
+}
+
+// ServerValidate asks the server for its own validation report.
+func (r *remoteNode) ServerValidate() (blockchain.ValidationReport, error) {
+	var report blockchain.ValidationReport
+	msg, err := r.request(map[string]string{"type": "validate"}, "validate_response")
+	if err != nil {
+		return report, err
+	}
+	err = json.Unmarshal(msg.Data, &report)
+	return report, err
+}
+
+// httpRequest sends a request to path on the server's HTTP API, which is
+// served next to /ws, with the node's token.
+func (r *remoteNode) httpRequest(method, path, contentType string, body io.Reader) (*http.Response, error) {
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = strings.Replace(u.Scheme, "ws", "http", 1)
+	u.Path = path
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// httpError describes an unexpected HTTP response.
+func httpError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+func (r *remoteNode) UploadBlob(body io.Reader) (store.BlobInfo, error) {
+	var info store.BlobInfo
+	resp, err := r.httpRequest(http.MethodPost, "/blobs", "application/octet-stream", body)
+	if err != nil {
+		return info, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return info, httpError(resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&info)
+	return info, err
+}
+
+func (r *remoteNode) CollectBlobs() (store.GCStats, error) {
+	var stats store.GCStats
+	msg, err := r.request(map[string]string{"type": "gc_blobs"}, "gc_blobs_response")
+	if err != nil {
+		return stats, err
+	}
+	err = json.Unmarshal(msg.Data, &stats)
+	return stats, err
+}
+
+type watchMetrics struct {
+	Blocks         int     `json:"blocks"`
+	Pending        int     `json:"pending"`
+	Difficulty     int     `json:"difficulty"`
+	Clients        int     `json:"clients"`
+	ServerHashrate float64 `json:"server_hashrate"`
+}
+
+// watchEvent is one line of watch output: the chain tip when watching
+// starts, a new block, a metrics change or a mining job state change.
+type watchEvent struct {
+	Event   string            `json:"event"`
+	Time    time.Time         `json:"time"`
+	Block   *blockchain.Block `json:"block,omitempty"`
+	Metrics *watchMetrics     `json:"metrics,omitempty"`
+	JobID   string            `json:"job_id,omitempty"`
+	State   string            `json:"state,omitempty"`
+}
+
+func (e watchEvent) printTable() {
+	stamp := e.Time.Format("15:04:05")
+	switch e.Event {
+	case "tip":
+		fmt.Printf("Chain tip: #%d\n", e.Block.Index)
+	case "block":
+		b := e.Block
+		fmt.Printf("[%s] New block #%d %s (%d txs, difficulty %d)\n", stamp, b.Index, b.Hash[:16]+"...", len(b.Transactions), b.Difficulty)
+	case "metrics":
+		m := e.Metrics
+		fmt.Printf("[%s] blocks=%d pending=%d difficulty=%d clients=%d server_hashrate=%.1f H/s\n", stamp, m.Blocks, m.Pending, m.Difficulty, m.Clients, m.ServerHashrate)
+	case "mining_job":
+		fmt.Printf("[%s] Mining %s: %s\n", stamp, e.JobID, e.State)
+	}
+}
+
+// watch passes new blocks, mining activity and metrics changes to emit
+// until interrupted.
+func (r *remoteNode) watch(emit func(document)) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Fprintf(progress, "Watching %s (Ctrl-C to stop)\n", r.url)
+	lastIndex := -1
+	var lastMetrics watchMetrics
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-r.incoming:
+			if !ok {
+				return fmt.Errorf("connection to %s lost: %v", r.url, r.readErr)
+			}
+			now := time.Now()
+			switch msg.Type {
+			case "chain":
+				if len(msg.Blocks) == 0 {
+					continue
+				}
+				if lastIndex < 0 {
+					tip := msg.Blocks[len(msg.Blocks)-1]
+					lastIndex = tip.Index
+					emit(watchEvent{Event: "tip", Time: now, Block: tip})
+					continue
+				}
+				for _, b := range msg.Blocks {
+					if b.Index <= lastIndex {
+						continue
+					}
+					emit(watchEvent{Event: "block", Time: now, Block: b})
+					lastIndex = b.Index
+				}
+			case "metrics":
+				m := watchMetrics{
+					Blocks:         msg.ChainLen,
+					Pending:        msg.Pending,
+					Difficulty:     msg.Difficulty,
+					Clients:        msg.Miners,
+					ServerHashrate: msg.ServerHashrate,
+				}
+				if m != lastMetrics {
+					emit(watchEvent{Event: "metrics", Time: now, Metrics: &m})
+					lastMetrics = m
+				}
+			case "mining_job":
+				emit(watchEvent{Event: "mining_job", Time: now, JobID: msg.JobID, State: msg.State})
+			}
+		}
+	}
+}
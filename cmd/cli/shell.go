@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+const maxSourceDepth = 8
+
+var (
+	// stdin is shared by the prompt, line editor and confirmations so
+	// buffered input is never lost between them.
+	stdin = bufio.NewReader(os.Stdin)
+
+	sourceDepth int
+)
+
+// splitArgs splits a command line the way a POSIX shell does for plain
+// words: whitespace separates arguments, single quotes keep everything
+// literally, double quotes allow \" \\ \$ and \` escapes, a backslash
+// outside quotes escapes the next character and # starts a comment.
+func splitArgs(line string) ([]string, error) {
+	var (
+		args   []string
+		cur    strings.Builder
+		inWord bool
+		quote  rune
+	)
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case quote == '"':
+			switch {
+			case r == '"':
+				quote = 0
+			case r == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`", runes[i+1]):
+				i++
+				cur.WriteRune(runes[i])
+			default:
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			cur.WriteRune(runes[i])
+			inWord = true
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				args = append(args, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		case r == '#' && !inWord:
+			i = len(runes)
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// runLine parses and runs one line of input. quit is true for exit and
+// quit.
+func runLine(line string) (code int, quit bool) {
+	args, err := splitArgs(line)
+	if err != nil {
+		return emitError("", usageError(err.Error(), "")), false
+	}
+	if len(args) == 0 {
+		return exitOK, false
+	}
+	if args[0] == "exit" || args[0] == "quit" {
+		return exitOK, true
+	}
+	return executeCommand(args), false
+}
+
+// sourceFile runs each line of path as a command, stopping at the first
+// one that fails or at exit.
+func sourceFile(path string) *cliError {
+	if sourceDepth >= maxSourceDepth {
+		return failure("source_failed", fmt.Errorf("source nested more than %d deep", maxSourceDepth))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return failure("source_failed", err)
+	}
+	defer f.Close()
+
+	sourceDepth++
+	defer func() { sourceDepth-- }()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		code, quit := runLine(scanner.Text())
+		if quit {
+			return nil
+		}
+		if code != exitOK {
+			return &cliError{Code: "source_failed", Message: fmt.Sprintf("%s:%d: command failed", path, n), exit: code}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return failure("source_failed", err)
+	}
+	return nil
+}
+
+// confirm asks a yes/no question on stdin; anything but y or yes is no.
+func confirm(prompt string) bool {
+	fmt.Fprint(progress, prompt)
+	answer, err := stdin.ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// plainReader reads lines without editing, for piped input.
+type plainReader struct{}
+
+func (plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(progress, prompt)
+	line, err := stdin.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// completeLine returns the completions for the word ending at the end of
+// line: command names for the first word, flags after a dash, file names
+// for source, and block hashes otherwise.
+func completeLine(line string) (word string, candidates []string) {
+	start := strings.LastIndexFunc(line, unicode.IsSpace) + 1
+	word = line[start:]
+	words := strings.Fields(line[:start])
+	if len(words) == 0 {
+		return word, commandNames(word)
+	}
+
+	c, ok := byName[words[0]]
+	switch {
+	case !ok:
+		return word, nil
+	case strings.HasPrefix(word, "-"):
+		for _, f := range c.info().Flags {
+			if name := "--" + f.Name; strings.HasPrefix(name, word) {
+				candidates = append(candidates, name)
+			}
+		}
+	case c.Name == "source":
+		matches, _ := filepath.Glob(word + "*")
+		for _, m := range matches {
+			if fi, err := os.Stat(m); err == nil && fi.IsDir() {
+				m += string(filepath.Separator)
+			}
+			candidates = append(candidates, m)
+		}
+	case c.Name == "help":
+		candidates = commandNames(word)
+	case word != "":
+		chain, err := activeNode.Chain()
+		if err != nil {
+			return word, nil
+		}
+		for _, b := range chain {
+			if strings.HasPrefix(b.Hash, word) {
+				candidates = append(candidates, b.Hash)
+			}
+		}
+	}
+	return word, candidates
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"  status  ", []string{"status"}},
+		{"add-tx hello world", []string{"add-tx", "hello", "world"}},
+		{`add-tx "hello world"`, []string{"add-tx", "hello world"}},
+		{`add-tx 'it''s'`, []string{"add-tx", "its"}},
+		{`add-tx 'a "b" \c'`, []string{"add-tx", `a "b" \c`}},
+		{`add-tx "say \"hi\" \\ \$HOME \n"`, []string{"add-tx", `say "hi" \ $HOME \n`}},
+		{`add-tx hello\ world`, []string{"add-tx", "hello world"}},
+		{`add-tx ""`, []string{"add-tx", ""}},
+		{"search go # find posts", []string{"search", "go"}},
+		{"add-tx a#b", []string{"add-tx", "a#b"}},
+		{`add-tx "#not a comment"`, []string{"add-tx", "#not a comment"}},
+		{"add-tx\tköln 東京", []string{"add-tx", "köln", "東京"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := splitArgs(tt.line)
+			if err != nil {
+				t.Fatalf("splitArgs: %v", err)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, line := range []string{`add-tx "open`, "add-tx 'open", `add-tx trailing\`} {
+		if _, err := splitArgs(line); err == nil {
+			t.Errorf("splitArgs(%q) succeeded, want an error", line)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+type termState struct{}
+
+// Line editing is only implemented for Linux terminals; elsewhere
+// interactive mode reads plain lines.
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (*termState, error) {
+	return nil, errors.New("line editing is not supported on this platform")
+}
+
+func noEcho(fd int) (*termState, error) {
+	return nil, errors.New("hiding input is not supported on this platform")
+}
+
+func restoreTerm(fd int, st *termState) error {
+	return nil
+}
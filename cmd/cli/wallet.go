@@ -0,0 +1,390 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+	"github.com/eshahhh/blogochain/internal/wallet"
+)
+
+var (
+	// walletDir is the keystore directory and accountName the account
+	// picked with --account; without it the keystore's default is used.
+	walletDir   string
+	accountName string
+
+	keystore *wallet.Keystore
+	// unlocked caches keys for the rest of an interactive session so the
+	// passphrase is asked once per account.
+	unlocked = make(map[string]ed25519.PrivateKey)
+)
+
+func defaultWalletDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "wallet"
+	}
+	return filepath.Join(home, ".blogochain_wallet")
+}
+
+func openKeystore() (*wallet.Keystore, *cliError) {
+	if keystore == nil {
+		ks, err := wallet.Open(walletDir)
+		if err != nil {
+			return nil, failure("wallet_unavailable", fmt.Errorf("Cannot open wallet: %w", err))
+		}
+		keystore = ks
+	}
+	return keystore, nil
+}
+
+// selectedAccount returns the account named by --account or
+// BLOGOCHAIN_ACCOUNT, or else the wallet's default; "" if there is none.
+func selectedAccount() (string, *cliError) {
+	if accountName != "" {
+		return accountName, nil
+	}
+	if _, err := os.Stat(walletDir); errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	ks, cerr := openKeystore()
+	if cerr != nil {
+		return "", cerr
+	}
+	name, err := ks.Default()
+	if err != nil {
+		return "", failure("wallet_unavailable", err)
+	}
+	return name, nil
+}
+
+// readPassphrase takes the passphrase from BLOGOCHAIN_PASSPHRASE or asks
+// for it, without echo on a terminal.
+func readPassphrase(prompt string) (string, error) {
+	if v, ok := os.LookupEnv("BLOGOCHAIN_PASSPHRASE"); ok {
+		return v, nil
+	}
+	fmt.Fprint(progress, prompt)
+	if fd := int(os.Stdin.Fd()); isTerminal(fd) {
+		if st, err := noEcho(fd); err == nil {
+			defer restoreTerm(fd, st)
+		} else {
+			fmt.Fprint(progress, "(input will be shown) ")
+		}
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("no passphrase given")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// newPassphrase asks for a passphrase twice.
+func newPassphrase() (string, *cliError) {
+	pass, err := readPassphrase("New passphrase: ")
+	if err != nil {
+		return "", failure("wallet_unavailable", err)
+	}
+	if _, ok := os.LookupEnv("BLOGOCHAIN_PASSPHRASE"); !ok {
+		again, err := readPassphrase("Repeat passphrase: ")
+		if err != nil {
+			return "", failure("wallet_unavailable", err)
+		}
+		if again != pass {
+			return "", usageError("The passphrases do not match", "")
+		}
+	}
+	if pass == "" {
+		return "", usageError("The passphrase must not be empty", "")
+	}
+	return pass, nil
+}
+
+// unlockAccount returns the key of account name, asking for its
+// passphrase the first time.
+func unlockAccount(name string) (ed25519.PrivateKey, *cliError) {
+	if key, ok := unlocked[name]; ok {
+		return key, nil
+	}
+	ks, cerr := openKeystore()
+	if cerr != nil {
+		return nil, cerr
+	}
+	if _, err := ks.Account(name); err != nil {
+		return nil, walletFailure(err)
+	}
+	pass, err := readPassphrase(fmt.Sprintf("Passphrase for %s: ", name))
+	if err != nil {
+		return nil, failure("key_unavailable", err)
+	}
+	key, err := ks.Unlock(name, pass)
+	if err != nil {
+		return nil, walletFailure(err)
+	}
+	unlocked[name] = key
+	return key, nil
+}
+
+func walletFailure(err error) *cliError {
+	switch {
+	case errors.Is(err, wallet.ErrNoAccount):
+		cerr := failure("not_found", err)
+		cerr.Hint = "List accounts with wallet list"
+		return cerr
+	case errors.Is(err, wallet.ErrBadName), errors.Is(err, wallet.ErrAccountExists):
+		return usageError(err.Error(), "")
+	case errors.Is(err, wallet.ErrBadPassphrase):
+		return failure("key_unavailable", err)
+	}
+	return failure("wallet_unavailable", err)
+}
+
+// signingKey returns the key in keyPath if given, else the selected
+// account's.
+func signingKey(keyPath string) (ed25519.PrivateKey, *cliError) {
+	if keyPath != "" {
+		return loadKey(keyPath)
+	}
+	name, cerr := selectedAccount()
+	if cerr != nil {
+		return nil, cerr
+	}
+	if name == "" {
+		return nil, usageError("No signing key given", "Create an account with wallet new <name>, or pass --key <file>")
+	}
+	return unlockAccount(name)
+}
+
+type accountDoc struct {
+	wallet.Account
+	Selected bool `json:"selected"`
+}
+
+func (d accountDoc) printTable() {
+	fmt.Printf("Account %s\n", d.Name)
+	fmt.Printf("  Address (author ID): %s\n", d.Address)
+	if d.Selected {
+		fmt.Println("  Selected for signing")
+	}
+}
+
+type accountsDoc struct {
+	Selected string           `json:"selected"`
+	Accounts []wallet.Account `json:"accounts"`
+}
+
+func (d accountsDoc) printTable() {
+	if len(d.Accounts) == 0 {
+		fmt.Println("No accounts; create one with wallet new <name>")
+		return
+	}
+	fmt.Printf("Accounts (%d)\n", len(d.Accounts))
+	fmt.Println(strings.Repeat("=", 40))
+	for _, a := range d.Accounts {
+		mark := " "
+		if a.Name == d.Selected {
+			mark = "*"
+		}
+		fmt.Printf("%s %-16s %s\n", mark, a.Name, a.Address)
+	}
+}
+
+type keyExportDoc struct {
+	Account string `json:"account"`
+	File    string `json:"file"`
+}
+
+func (d keyExportDoc) printTable() {
+	fmt.Printf("Unencrypted key of %s written to %s\n", d.Account, d.File)
+}
+
+type signedTxDoc struct {
+	TxID        string `json:"tx_id"`
+	Author      string `json:"author"`
+	Transaction string `json:"transaction"`
+}
+
+func (d signedTxDoc) printTable() {
+	fmt.Printf("Signed transaction %s\n", d.TxID)
+	fmt.Println(d.Transaction)
+}
+
+const walletUsage = "Usage: wallet new|import|export|list|address|use|sign ...; see help wallet"
+
+func walletCommand(args []string) (document, *cliError) {
+	if len(args) == 0 {
+		return nil, usageError("Please provide a wallet command", walletUsage)
+	}
+	ks, cerr := openKeystore()
+	if cerr != nil {
+		return nil, cerr
+	}
+	sub, args := args[0], args[1:]
+	need := func(n int, usage string) *cliError {
+		if len(args) != n {
+			return usageError(fmt.Sprintf("wallet %s takes %d argument(s)", sub, n), "Usage: wallet "+usage)
+		}
+		return nil
+	}
+
+	switch sub {
+	case "new", "import":
+		var key ed25519.PrivateKey
+		if sub == "new" {
+			if cerr := need(1, "new <name>"); cerr != nil {
+				return nil, cerr
+			}
+		} else {
+			if cerr := need(2, "import <name> <key-file>"); cerr != nil {
+				return nil, cerr
+			}
+			if key, cerr = loadKey(args[1]); cerr != nil {
+				return nil, cerr
+			}
+		}
+		if _, err := ks.Account(args[0]); err == nil {
+			return nil, walletFailure(fmt.Errorf("%s: %w", args[0], wallet.ErrAccountExists))
+		} else if !errors.Is(err, wallet.ErrNoAccount) {
+			return nil, walletFailure(err)
+		}
+		pass, cerr := newPassphrase()
+		if cerr != nil {
+			return nil, cerr
+		}
+		var acct wallet.Account
+		var err error
+		if key == nil {
+			acct, err = ks.Create(args[0], pass)
+		} else {
+			acct, err = ks.Import(args[0], key, pass)
+		}
+		if err != nil {
+			return nil, walletFailure(err)
+		}
+		// The first account is selected for signing.
+		selected, err := ks.Default()
+		if err == nil && selected == "" {
+			err = ks.SetDefault(acct.Name)
+			selected = acct.Name
+		}
+		if err != nil {
+			return nil, walletFailure(err)
+		}
+		return accountDoc{Account: acct, Selected: selected == acct.Name}, nil
+
+	case "export":
+		if cerr := need(2, "export <name> <file>"); cerr != nil {
+			return nil, cerr
+		}
+		key, cerr := unlockAccount(args[0])
+		if cerr != nil {
+			return nil, cerr
+		}
+		if err := writeKey(args[1], key); err != nil {
+			return nil, failure("wallet_unavailable", fmt.Errorf("Cannot write key file: %w", err))
+		}
+		return keyExportDoc{Account: args[0], File: args[1]}, nil
+
+	case "list":
+		if cerr := need(0, "list"); cerr != nil {
+			return nil, cerr
+		}
+		accts, err := ks.Accounts()
+		if err != nil {
+			return nil, walletFailure(err)
+		}
+		selected, cerr := selectedAccount()
+		if cerr != nil {
+			return nil, cerr
+		}
+		return accountsDoc{Selected: selected, Accounts: accts}, nil
+
+	case "address":
+		if len(args) > 1 {
+			return nil, usageError("wallet address takes at most one account", "Usage: wallet address [name]")
+		}
+		selected, cerr := selectedAccount()
+		if cerr != nil {
+			return nil, cerr
+		}
+		name := selected
+		if len(args) == 1 {
+			name = args[0]
+		}
+		if name == "" {
+			return nil, usageError("No account selected", "Create one with wallet new <name> or pick one with wallet use <name>")
+		}
+		acct, err := ks.Account(name)
+		if err != nil {
+			return nil, walletFailure(err)
+		}
+		return accountDoc{Account: acct, Selected: name == selected}, nil
+
+	case "use":
+		if cerr := need(1, "use <name>"); cerr != nil {
+			return nil, cerr
+		}
+		if err := ks.SetDefault(args[0]); err != nil {
+			return nil, walletFailure(err)
+		}
+		acct, err := ks.Account(args[0])
+		if err != nil {
+			return nil, walletFailure(err)
+		}
+		return accountDoc{Account: acct, Selected: accountName == "" || accountName == acct.Name}, nil
+
+	case "sign":
+		if len(args) == 0 {
+			return nil, usageError("Please provide the transaction to sign", "Usage: wallet sign <text | blog transaction JSON>")
+		}
+		key, cerr := signingKey("")
+		if cerr != nil {
+			return nil, cerr
+		}
+		t, err := unsignedTx(strings.Join(args, " "))
+		if err != nil {
+			return nil, usageError(err.Error(), "")
+		}
+		t.Sign(key)
+		tx := t.Encode()
+		return signedTxDoc{TxID: blockchain.TxID(tx), Author: t.Author, Transaction: tx}, nil
+	}
+	return nil, usageError(fmt.Sprintf("Unknown wallet command: %s", sub), walletUsage)
+}
+
+// unsignedTx reads data as a blog transaction to sign if it is one, such
+// as {"type": "post", "title": "..."}, and as the body of a note
+// otherwise.
+func unsignedTx(data string) (blockchain.BlogTx, error) {
+	_, ok, _ := blockchain.ParseBlogTx(data)
+	if !ok {
+		return blockchain.BlogTx{Type: blockchain.TxNote, Body: data}, nil
+	}
+	var t blockchain.BlogTx
+	if err := json.Unmarshal([]byte(data), &t); err != nil {
+		return t, fmt.Errorf("Cannot read blog transaction: %w", err)
+	}
+	t.Author, t.Sig = "", ""
+	return t, nil
+}
+
+// writeKey writes key's seed to a new file at path in the format keygen
+// and --key use.
+func writeKey(path string, key ed25519.PrivateKey) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, hex.EncodeToString(key.Seed()))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -1,24 +1,196 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/eshahhh/blogochain/internal/api"
 	"github.com/eshahhh/blogochain/internal/blockchain"
+	"github.com/eshahhh/blogochain/internal/config"
+	"github.com/eshahhh/blogochain/internal/logging"
+	"github.com/eshahhh/blogochain/internal/notary"
+	"github.com/eshahhh/blogochain/internal/store"
 )
 
+// peerPollInterval is how often the peers readiness check asks the
+// configured peers for their height.
+const peerPollInterval = 10 * time.Second
+
 func main() {
-	bc := blockchain.NewBlockchain(1)
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if cfg.PrintConfig {
+		cfg.Write(os.Stdout)
+		return
+	}
+
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	logging.SetLevel(level)
+
+	auth, err := loadAuth(cfg)
+	if err != nil {
+		log.Fatalf("auth: %v", err)
+	}
+
+	st, err := store.Open(cfg.DataDir)
+	if err != nil {
+		log.Fatalf("store: %v", err)
+	}
+	bc, err := st.LoadOrCreate(cfg.Difficulty)
+	if err != nil {
+		log.Fatalf("store: %v", err)
+	}
+	if cfg.ClockOffset != 0 {
+		bc.SetClock(blockchain.OffsetClock{Base: blockchain.SystemClock, Offset: time.Duration(cfg.ClockOffset)})
+	}
+	bc.SetMaxFutureDrift(time.Duration(cfg.MaxFutureDrift))
+	if cfg.GenesisHash != "" {
+		if h := bc.GenesisHash(); h != cfg.GenesisHash {
+			log.Fatalf("chain in %s starts with genesis block %s, expected %s", st.Dir(), h, cfg.GenesisHash)
+		}
+		bc.SetGenesisHash(cfg.GenesisHash)
+	}
+	if report := bc.Validate(); !report.Valid {
+		bad := report.Blocks[report.FirstInvalid]
+		log.Printf("WARNING: chain loaded from %s failed validation at block #%d: %s", st.Dir(), bad.Index, bad.Issues[0].Message)
+	}
+	bc.SetMiningThreads(cfg.MiningThreads)
+	if cfg.Retarget.Policy == "interval" {
+		bc.SetRetargetPolicy(blockchain.RetargetPolicy{
+			Interval:        cfg.Retarget.Interval,
+			TargetBlockTime: time.Duration(cfg.Retarget.TargetBlockTime),
+			MaxDifficulty:   cfg.Retarget.MaxDifficulty,
+		})
+	}
+
+	batches, err := st.LoadNotary()
+	if err != nil {
+		log.Fatalf("store: %v", err)
+	}
+	nt := notary.New(bc, batches, st.SaveNotary)
+
+	limits := api.DefaultRateLimitConfig()
+	limits.MaxTxSize = cfg.MaxTxSize
+	limits.TrustedProxies = cfg.TrustedProxies
+
+	server, err := api.NewServer(bc, api.Options{
+		Auth:                     auth,
+		RateLimits:               &limits,
+		StaticDir:                cfg.StaticDir,
+		Blobs:                    st.Blobs(),
+		MaxBlobSize:              int64(cfg.MaxBlobSize),
+		Notary:                   nt,
+		DisableMining:            !cfg.Features.Mining,
+		DisableDifficultyChanges: !cfg.Features.DifficultyChanges,
+		DisableSearch:            !cfg.Features.Search,
+	})
+	if err != nil {
+		log.Fatalf("server: %v", err)
+	}
+	server.AddReadinessCheck("store", func() (string, error) {
+		if err := st.Err(); err != nil {
+			return "", fmt.Errorf("last save failed: %w", err)
+		}
+		return st.Dir(), nil
+	})
+	peers := api.NewPeerCheck(bc, cfg.Peers, cfg.MaxPeerLag)
+	server.AddReadinessCheck("peers", peers.Check)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	server := api.NewServer(bc)
+	saveCtx, stopSaving := context.WithCancel(context.Background())
+	go st.AutoSave(saveCtx, bc, time.Duration(cfg.SaveInterval))
+	go nt.Run(saveCtx, time.Duration(cfg.NotaryInterval))
+	go peers.Run(saveCtx, peerPollInterval)
 
-	mux := server.SetupRoutes()
+	fmt.Printf("Starting blockchain server on %s\n", cfg.Listen)
+	fmt.Printf("Access the web interface at %s\n", webURL(cfg.Listen))
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ListenAndServe(cfg.Listen) }()
+
+	exitCode := 0
+	select {
+	case err := <-serveErr:
+		log.Printf("server error: %v", err)
+		exitCode = 1
+	case <-ctx.Done():
+		log.Println("Shutting down...")
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	cancel()
+
+	stopSaving()
+	// Commit the hashes still queued so their batch is saved with the
+	// mempool.
+	if err := nt.Commit(); err != nil {
+		log.Printf("notary: final commit failed: %v", err)
+	}
+	if err := st.Save(bc); err != nil {
+		log.Printf("store: final save failed: %v", err)
+		exitCode = 1
+	} else {
+		log.Printf("Chain and mempool saved to %s", st.Dir())
+	}
+	st.Close()
+	os.Exit(exitCode)
+}
+
+// webURL returns the address of the web interface served on listen. A
+// listener on every interface is reached through localhost; an address
+// that does not parse is shown as it was configured.
+func webURL(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return listen
+	}
+	switch host {
+	case "", "0.0.0.0", "::":
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/"
+}
 
-	port := ":8080"
-	fmt.Printf("Starting blockchain server on port %s\n", port)
-	fmt.Printf("Access the web interface at http://localhost%s\n", port)
+// loadAuth builds the authenticator. Anonymous clients are viewers unless
+// anonymous_role says otherwise, tokens file or not.
+func loadAuth(cfg *config.Config) (*api.Auth, error) {
+	anonymous := api.RoleViewer
+	if cfg.AnonymousRole != "" {
+		role, err := api.ParseRole(cfg.AnonymousRole)
+		if err != nil {
+			return nil, err
+		}
+		anonymous = role
+	}
 
-	log.Fatal(http.ListenAndServe(port, mux))
+	auth := api.NewAuth(anonymous, cfg.AllowedOrigins, os.Stderr)
+	if cfg.TokensFile != "" {
+		if err := auth.LoadTokens(cfg.TokensFile); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Loaded %d API tokens, anonymous role: %s\n", auth.TokenCount(), anonymous)
+	} else {
+		fmt.Printf("No API tokens configured, anonymous clients act as %s\n", anonymous)
+	}
+	return auth, nil
 }
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestWebURL(t *testing.T) {
+	tests := map[string]string{
+		":8080":          "http://localhost:8080/",
+		"0.0.0.0:8080":   "http://localhost:8080/",
+		"[::]:8080":      "http://localhost:8080/",
+		"127.0.0.1:9000": "http://127.0.0.1:9000/",
+		"[::1]:9000":     "http://[::1]:9000/",
+		"blog.lan:80":    "http://blog.lan:80/",
+		"8080":           "8080",
+	}
+	for listen, want := range tests {
+		if got := webURL(listen); got != want {
+			t.Errorf("webURL(%q) = %q, want %q", listen, got, want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleSubmitter
+	RoleMiner
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleNone:      "none",
+	RoleViewer:    "viewer",
+	RoleSubmitter: "submitter",
+	RoleMiner:     "miner",
+	RoleAdmin:     "admin",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("role(%d)", int(r))
+}
+
+func ParseRole(s string) (Role, error) {
+	for r, name := range roleNames {
+		if strings.EqualFold(s, name) {
+			return r, nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role %q", s)
+}
+
+// messageRoles is the minimum role for each inbound WebSocket message type.
+// Types missing from the map are rejected.
+var messageRoles = map[string]Role{
+	"auth":            RoleNone,
+	"hello":           RoleViewer,
+	"hashrate":        RoleViewer,
+	"get_chain":       RoleViewer,
+	"get_pending":     RoleViewer,
+	"get_block":       RoleViewer,
+	"get_transaction": RoleViewer,
+	"get_posts":       RoleViewer,
+	"get_post":        RoleViewer,
+	"search_chain":    RoleViewer,
+	"validate":        RoleViewer,
+	"add_transaction": RoleSubmitter,
+	"mine_block":      RoleMiner,
+	"cancel_mining":   RoleMiner,
+	"set_difficulty":  RoleAdmin,
+	"gc_blobs":        RoleAdmin,
+}
+
+// Principal is the identity a connection or request acts as.
+type Principal struct {
+	Name string
+	Role Role
+}
+
+type tokenEntry struct {
+	Token string `json:"token"`
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+}
+
+// Auth resolves API tokens to principals, checks origins and writes the
+// audit log. Tokens are kept only as SHA-256 digests.
+type Auth struct {
+	tokens         map[[32]byte]Principal
+	anonymous      Role
+	allowedOrigins []string
+	audit          *log.Logger
+}
+
+func NewAuth(anonymous Role, allowedOrigins []string, audit io.Writer) *Auth {
+	if audit == nil {
+		audit = os.Stderr
+	}
+	return &Auth{
+		tokens:         make(map[[32]byte]Principal),
+		anonymous:      anonymous,
+		allowedOrigins: allowedOrigins,
+		audit:          log.New(audit, "", 0),
+	}
+}
+
+func (a *Auth) AddToken(token, name string, role Role) {
+	a.tokens[sha256.Sum256([]byte(token))] = Principal{Name: name, Role: role}
+}
+
+// LoadTokens reads a JSON array of {"token", "name", "role"} objects.
+func (a *Auth) LoadTokens(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var entries []tokenEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, e := range entries {
+		role, err := ParseRole(e.Role)
+		if err != nil {
+			return fmt.Errorf("token %q: %w", e.Name, err)
+		}
+		if e.Token == "" {
+			return fmt.Errorf("token %q: empty token", e.Name)
+		}
+		a.AddToken(e.Token, e.Name, role)
+	}
+	return nil
+}
+
+func (a *Auth) TokenCount() int {
+	return len(a.tokens)
+}
+
+// Lookup returns the principal for token, or the anonymous principal when
+// the token is empty. ok is false for an unknown token.
+func (a *Auth) Lookup(token string) (Principal, bool) {
+	if token == "" {
+		return Principal{Name: "anonymous", Role: a.anonymous}, true
+	}
+	p, ok := a.tokens[sha256.Sum256([]byte(token))]
+	return p, ok
+}
+
+// Authenticate resolves the token carried by r in an "Authorization: Bearer"
+// header or, for browsers that cannot set headers on WebSockets, a "token"
+// query parameter.
+func (a *Auth) Authenticate(r *http.Request) (Principal, bool) {
+	token := r.URL.Query().Get("token")
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimPrefix(h, "Bearer ")
+	}
+	return a.Lookup(token)
+}
+
+// CheckOrigin allows same-host requests when no origins are configured,
+// any origin for "*", and otherwise only the listed origins.
+func (a *Auth) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(a.allowedOrigins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, allowed := range a.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRole wraps h so that it only runs for principals holding at least
+// role. Denials are audited.
+func (a *Auth) RequireRole(role Role, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := a.Authenticate(r)
+		if !ok {
+			a.Audit(Principal{Name: "invalid-token"}, r.RemoteAddr, r.Method+" "+r.URL.Path, false, "unknown token")
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		if p.Role < role {
+			a.Audit(p, r.RemoteAddr, r.Method+" "+r.URL.Path, false, "requires "+role.String())
+			http.Error(w, "forbidden: requires role "+role.String(), http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+type auditEntry struct {
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"`
+	Role    string    `json:"role"`
+	Remote  string    `json:"remote"`
+	Action  string    `json:"action"`
+	Allowed bool      `json:"allowed"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// Audit writes one JSON line describing a privileged action or a denial.
+func (a *Auth) Audit(p Principal, remote, action string, allowed bool, detail string) {
+	b, err := json.Marshal(auditEntry{
+		Time:    time.Now().UTC(),
+		Actor:   p.Name,
+		Role:    p.Role.String(),
+		Remote:  remote,
+		Action:  action,
+		Allowed: allowed,
+		Detail:  detail,
+	})
+	if err != nil {
+		return
+	}
+	a.audit.Printf("[AUDIT] %s", b)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/eshahhh/blogochain/internal/logging"
+	"github.com/eshahhh/blogochain/internal/store"
+)
+
+// defaultMaxBlobSize applies when Options.MaxBlobSize is not set.
+const defaultMaxBlobSize = 16 << 20
+
+type uploadResponse struct {
+	store.BlobInfo
+	// Ref is how transactions refer to the attachment.
+	Ref string `json:"ref"`
+	URL string `json:"url"`
+}
+
+// HandleUpload answers POST /blobs by storing the request body as an
+// attachment and returning its ID. Uploads share a per-IP upload_blob
+// rate limit.
+func (s *Server) HandleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ok, _, wait := s.hub.limiter.Allow(map[string]*bucket{}, s.hub.limiter.ClientIP(r), "upload_blob"); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, "too many uploads", http.StatusTooManyRequests)
+		return
+	}
+
+	// An upload cut short leaves chunks behind; GC removes them.
+	info, err := s.blobs.Put(http.MaxBytesReader(w, r.Body, s.maxBlobSize))
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		http.Error(w, fmt.Sprintf("attachment exceeds %d bytes", s.maxBlobSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		logging.Errorf("[BLOBS] storing upload: %v", err)
+		http.Error(w, "cannot store attachment", http.StatusInternalServerError)
+		return
+	}
+	p, _ := s.auth.Authenticate(r)
+	s.auth.Audit(p, r.RemoteAddr, "upload_blob", true, fmt.Sprintf("%s, %d bytes", info.ID, info.Size))
+
+	w.Header().Set("Location", "/blobs/"+info.ID)
+	writeJSON(w, http.StatusCreated, uploadResponse{BlobInfo: info, Ref: "sha256:" + info.ID, URL: "/blobs/" + info.ID})
+}
+
+// inlineTypes are the sniffed content types attachments are shown as.
+// Anything else, HTML and SVG in particular, is sent as a download so that
+// an uploaded page cannot run scripts on this origin.
+var inlineTypes = map[string]bool{
+	"image/png":                 true,
+	"image/jpeg":                true,
+	"image/gif":                 true,
+	"image/webp":                true,
+	"text/plain; charset=utf-8": true,
+}
+
+// HandleBlob answers GET /blobs/{id} with the attachment. Every object is
+// checked against its hash as it is sent; if one turns out to be corrupt
+// after the headers are out, the response is cut short.
+func (s *Server) HandleBlob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := pathArg(r, "/blobs/")
+	id = strings.ToLower(id)
+	if !ok || !store.IsBlobID(id) {
+		http.NotFound(w, r)
+		return
+	}
+	blob, err := s.blobs.Open(id)
+	if errors.Is(err, store.ErrBlobNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	var head []byte
+	if err == nil {
+		head, err = blob.Head(512)
+	}
+	if err != nil {
+		logging.Errorf("[BLOBS] opening %s: %v", id, err)
+		http.Error(w, "cannot read attachment", http.StatusInternalServerError)
+		return
+	}
+
+	h := w.Header()
+	etag := `"` + id + `"`
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	contentType := http.DetectContentType(head)
+	if !inlineTypes[contentType] {
+		contentType = "application/octet-stream"
+		h.Set("Content-Disposition", `attachment; filename="`+id+`"`)
+	}
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Length", strconv.FormatInt(blob.Size, 10))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := blob.WriteTo(w); err != nil {
+		if errors.Is(err, store.ErrBlobCorrupt) || errors.Is(err, store.ErrBlobNotFound) {
+			logging.Errorf("[BLOBS] serving %s: %v", id, err)
+		}
+		// The status line has gone out, so abort rather than end the
+		// response as if it were complete.
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,301 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+	"github.com/eshahhh/blogochain/internal/logging"
+	"github.com/eshahhh/blogochain/internal/markdown"
+)
+
+// blogPages renders the blog from the chain's post view: /posts,
+// /posts/{id}, /authors/{key}, /tags/{tag}, the Atom feed at /feed.atom
+// and the Merkle inclusion proofs at /proof/{tx-id} that every page links
+// to.
+type blogPages struct {
+	bc    *blockchain.Blockchain
+	pages map[string]*template.Template
+}
+
+var blogFuncs = template.FuncMap{
+	"short": shortKey,
+	"date":  func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 MST") },
+	"path":  url.PathEscape,
+	// markdown renders a text/markdown body; it escapes any HTML in it.
+	"markdown": markdown.HTML,
+	// current is the revision a post's content comes from.
+	"current": func(p blockchain.Post) blockchain.Revision { return p.Revisions[len(p.Revisions)-1] },
+}
+
+func newBlogPages(bc *blockchain.Blockchain, fsys fs.FS) (*blogPages, error) {
+	bp := &blogPages{bc: bc, pages: make(map[string]*template.Template)}
+	for _, name := range []string{"posts.html", "post.html"} {
+		t, err := template.New(name).Funcs(blogFuncs).ParseFS(fsys, "base.html", name)
+		if err != nil {
+			return nil, err
+		}
+		bp.pages[name] = t
+	}
+	return bp, nil
+}
+
+type postsPage struct {
+	Title  string
+	Feed   string
+	Author string
+	Posts  []blockchain.Post
+}
+
+type postPage struct {
+	Title string
+	Feed  string
+	Post  blockchain.Post
+}
+
+// render writes page into a buffer first so a template error becomes a 500
+// rather than half a page.
+func (bp *blogPages) render(w http.ResponseWriter, status int, name string, page interface{}) {
+	var buf bytes.Buffer
+	if err := bp.pages[name].ExecuteTemplate(&buf, "base", page); err != nil {
+		logging.Errorf("[BLOG] rendering %s: %v", name, err)
+		http.Error(w, "cannot render page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// pathArg returns the unescaped rest of r's path after prefix, which must
+// be a single non-empty segment; tags may contain an escaped slash.
+func pathArg(r *http.Request, prefix string) (string, bool) {
+	arg := strings.TrimPrefix(r.URL.EscapedPath(), prefix)
+	if arg == "" || strings.Contains(arg, "/") {
+		return "", false
+	}
+	arg, err := url.PathUnescape(arg)
+	return arg, err == nil
+}
+
+func (bp *blogPages) HandlePosts(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/posts" && r.URL.Path != "/posts/" {
+		bp.HandlePost(w, r)
+		return
+	}
+	bp.render(w, http.StatusOK, "posts.html", postsPage{Title: "All posts", Feed: "/feed.atom", Posts: bp.bc.Posts()})
+}
+
+// HandlePost shows one post with its history and comments. Deleted posts
+// are answered with 410 Gone and only their history.
+func (bp *blogPages) HandlePost(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathArg(r, "/posts/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	post, err := bp.bc.Post(strings.ToLower(id))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	status, title := http.StatusOK, post.Title
+	if post.Deleted {
+		status, title = http.StatusGone, "Deleted post"
+	}
+	bp.render(w, status, "post.html", postPage{Title: title, Feed: "/feed.atom?author=" + post.Author, Post: post})
+}
+
+func (bp *blogPages) HandleAuthor(w http.ResponseWriter, r *http.Request) {
+	key, ok := pathArg(r, "/authors/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	key = strings.ToLower(key)
+	posts := filterPosts(bp.bc.Posts(), key, "")
+	bp.render(w, http.StatusOK, "posts.html", postsPage{Title: "Posts by " + shortKey(key), Feed: "/feed.atom?author=" + url.QueryEscape(key), Author: key, Posts: posts})
+}
+
+func (bp *blogPages) HandleTag(w http.ResponseWriter, r *http.Request) {
+	tag, ok := pathArg(r, "/tags/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	posts := filterPosts(bp.bc.Posts(), "", tag)
+	bp.render(w, http.StatusOK, "posts.html", postsPage{Title: "Posts tagged " + tag, Feed: "/feed.atom?tag=" + url.QueryEscape(tag), Posts: posts})
+}
+
+// filterPosts keeps the posts by author and tagged tag, either of which
+// may be empty. Tags match case-insensitively.
+func filterPosts(posts []blockchain.Post, author, tag string) []blockchain.Post {
+	kept := posts[:0]
+	for _, p := range posts {
+		if author != "" && p.Author != author {
+			continue
+		}
+		if tag != "" && !hasTag(p.Tags, tag) {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func shortKey(key string) string {
+	if len(key) > 12 {
+		return key[:12] + "…"
+	}
+	return key
+}
+
+// HandleProof answers /proof/{tx-id} with the transaction's Merkle
+// inclusion proof as JSON.
+func (bp *blogPages) HandleProof(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathArg(r, "/proof/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	proof, err := bp.bc.GetTxProof(id)
+	if errors.Is(err, blockchain.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(proof)
+}
+
+// feedSize is how many of the newest posts the Atom feed carries.
+const feedSize = 50
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     atomAuthor     `xml:"author"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// HandleFeed serves an Atom feed of the newest posts, optionally only
+// those by ?author= or tagged ?tag=.
+func (bp *blogPages) HandleFeed(w http.ResponseWriter, r *http.Request) {
+	author := strings.ToLower(r.URL.Query().Get("author"))
+	tag := r.URL.Query().Get("tag")
+	posts := filterPosts(bp.bc.Posts(), author, tag)
+	if len(posts) > feedSize {
+		posts = posts[:feedSize]
+	}
+
+	base := baseURL(r)
+	feed := atomFeed{
+		Title: "Blogochain",
+		ID:    base + "/posts",
+		Links: []atomLink{{Href: base + r.URL.RequestURI(), Rel: "self"}, {Href: base + "/posts"}},
+	}
+	switch {
+	case author != "":
+		feed.Title = "Blogochain: posts by " + shortKey(author)
+	case tag != "":
+		feed.Title = "Blogochain: posts tagged " + tag
+	}
+	updated := time.Unix(0, 0)
+	for _, p := range posts {
+		if p.Updated.After(updated) {
+			updated = p.Updated
+		}
+		rev := p.Revisions[len(p.Revisions)-1]
+		entry := atomEntry{
+			Title:     p.Title,
+			ID:        "urn:blogochain:post:" + p.ID,
+			Published: p.Created.UTC().Format(time.RFC3339),
+			Updated:   p.Updated.UTC().Format(time.RFC3339),
+			Author:    atomAuthor{Name: shortKey(p.Author), URI: base + "/authors/" + p.Author},
+			Links: []atomLink{
+				{Href: base + "/posts/" + p.ID},
+				{Href: base + "/proof/" + rev.TxID, Rel: "related", Type: "application/json"},
+			},
+			Content: atomContent{Type: "text", Body: p.Body},
+		}
+		if p.ContentType == blockchain.ContentMarkdown {
+			entry.Content = atomContent{Type: "html", Body: string(markdown.HTML(p.Body))}
+		}
+		for _, t := range p.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: t})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		logging.Errorf("[BLOG] writing feed: %v", err)
+	}
+}
+
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
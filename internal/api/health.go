@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+)
+
+// CheckFunc is a readiness check. On success it may return a short detail
+// such as "12 blocks valid"; on failure the error explains why.
+type CheckFunc func() (string, error)
+
+type readinessCheck struct {
+	name string
+	fn   CheckFunc
+}
+
+type checkResult struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+type outStatus struct {
+	Status        string        `json:"status"`
+	Checks        []checkResult `json:"checks"`
+	Height        int           `json:"height"`
+	Difficulty    int           `json:"difficulty"`
+	Pending       int           `json:"pending"`
+	Clients       int           `json:"clients"`
+	UptimeSeconds int64         `json:"uptime_seconds"`
+}
+
+// chainCheck re-runs Blockchain.IsValid only when a block has been added
+// since the last run, so frequent probes stay cheap. New transactions and
+// difficulty changes move the chain's version but not its tip, and leave
+// the result as it was.
+type chainCheck struct {
+	bc *blockchain.Blockchain
+
+	mu     sync.Mutex
+	tip    string
+	height int
+	valid  bool
+}
+
+func (cc *chainCheck) check() (string, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	latest := cc.bc.GetLatestBlock()
+	if latest == nil {
+		return "", errors.New("chain is empty")
+	}
+	if latest.Hash != cc.tip {
+		cc.valid = cc.bc.IsValid()
+		cc.tip = latest.Hash
+		cc.height = latest.Index
+	}
+	if !cc.valid {
+		return "", errors.New("chain failed validation")
+	}
+	return fmt.Sprintf("%d blocks valid", cc.height+1), nil
+}
+
+// AddReadinessCheck registers an extra check reported by /readyz and
+// /status. Call before serving.
+func (s *Server) AddReadinessCheck(name string, fn CheckFunc) {
+	s.checks = append(s.checks, readinessCheck{name: name, fn: fn})
+}
+
+func (s *Server) runChecks() ([]checkResult, bool) {
+	ready := true
+	results := make([]checkResult, 0, len(s.checks))
+	for _, c := range s.checks {
+		detail, err := c.fn()
+		r := checkResult{Name: c.name, OK: err == nil, Message: detail}
+		if err != nil {
+			r.Message = err.Error()
+			ready = false
+		}
+		results = append(results, r)
+	}
+	return results, ready
+}
+
+func (s *Server) addBuiltinChecks() {
+	cc := &chainCheck{bc: s.blockchain}
+	cc.check()
+	s.AddReadinessCheck("chain", cc.check)
+	s.AddReadinessCheck("hub", func() (string, error) {
+		if s.hub.closing() {
+			return "", errors.New("hub is shut down")
+		}
+		return fmt.Sprintf("%d clients", s.hub.MinerCount()), nil
+	})
+}
+
+// HandleHealthz reports that the process is alive.
+func (s *Server) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// HandleReadyz answers 200 when every readiness check passes and 503
+// listing the failed checks otherwise.
+func (s *Server) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	results, ready := s.runChecks()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if ready {
+		fmt.Fprintln(w, "ready")
+		return
+	}
+	var failed []string
+	for _, res := range results {
+		if !res.OK {
+			failed = append(failed, res.Name+": "+res.Message)
+		}
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintf(w, "not ready\n%s\n", strings.Join(failed, "\n"))
+}
+
+// HandleStatus returns every check's result and a chain summary as JSON.
+func (s *Server) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	results, ready := s.runChecks()
+	status := outStatus{
+		Status:        "ready",
+		Checks:        results,
+		Difficulty:    s.blockchain.GetDifficulty(),
+		Pending:       len(s.blockchain.GetPendingTransactions()),
+		Clients:       s.hub.MinerCount(),
+		UptimeSeconds: int64(time.Since(s.started).Seconds()),
+	}
+	if latest := s.blockchain.GetLatestBlock(); latest != nil {
+		status.Height = latest.Index
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		status.Status = "unavailable"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(status)
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var miningDurationBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+// serverMetrics holds the counters that only the API layer can see. Chain
+// gauges are read from the Blockchain when /metrics is scraped.
+type serverMetrics struct {
+	mu             sync.Mutex
+	messages       map[string]uint64
+	rejectedTxs    map[string]uint64
+	blocksMined    uint64
+	miningCounts   []uint64
+	miningSum      float64
+	miningObserved uint64
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		messages:     make(map[string]uint64),
+		rejectedTxs:  make(map[string]uint64),
+		miningCounts: make([]uint64, len(miningDurationBuckets)),
+	}
+}
+
+func (m *serverMetrics) countMessage(msgType string) {
+	if _, known := messageRoles[msgType]; !known {
+		msgType = "unknown"
+	}
+	m.mu.Lock()
+	m.messages[msgType]++
+	m.mu.Unlock()
+}
+
+func (m *serverMetrics) rejectTx(reason string) {
+	m.mu.Lock()
+	m.rejectedTxs[reason]++
+	m.mu.Unlock()
+}
+
+func (m *serverMetrics) blockMined(d time.Duration) {
+	secs := d.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blocksMined++
+	m.miningSum += secs
+	m.miningObserved++
+	for i, le := range miningDurationBuckets {
+		if secs <= le {
+			m.miningCounts[i]++
+		}
+	}
+}
+
+type promWriter struct {
+	w *bufio.Writer
+}
+
+func (p promWriter) header(name, typ, help string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (p promWriter) sample(name string, labels string, v float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(p.w, "%s%s %s\n", name, labels, strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+func (p promWriter) gauge(name, help string, v float64) {
+	p.header(name, "gauge", help)
+	p.sample(name, "", v)
+}
+
+func (p promWriter) counter(name, help string, v float64) {
+	p.header(name, "counter", help)
+	p.sample(name, "", v)
+}
+
+// labelled writes one counter sample per key, sorted for stable output.
+func (p promWriter) labelled(name, help, label string, values map[string]uint64) {
+	p.header(name, "counter", help)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p.sample(name, label+`="`+escapeLabel(k)+`"`, float64(values[k]))
+	}
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// HandleMetrics writes the Prometheus text exposition format.
+func (s *Server) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	h := s.hub
+	bc := s.blockchain
+
+	pending := bc.GetPendingTransactions()
+	var pendingBytes int
+	for _, tx := range pending {
+		pendingBytes += len(tx)
+	}
+	height := 0
+	if latest := bc.GetLatestBlock(); latest != nil {
+		height = latest.Index
+	}
+	limits := h.limiter.Stats()
+
+	m := h.metrics
+	m.mu.Lock()
+	messages := make(map[string]uint64, len(m.messages))
+	for k, v := range m.messages {
+		messages[k] = v
+	}
+	rejected := make(map[string]uint64, len(m.rejectedTxs))
+	for k, v := range m.rejectedTxs {
+		rejected[k] = v
+	}
+	blocksMined := m.blocksMined
+	miningCounts := append([]uint64(nil), m.miningCounts...)
+	miningSum, miningObserved := m.miningSum, m.miningObserved
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p := promWriter{w: bufio.NewWriter(w)}
+	defer p.w.Flush()
+
+	p.gauge("blogochain_chain_height", "Index of the latest block.", float64(height))
+	p.gauge("blogochain_difficulty", "Current mining difficulty in leading hex zeros.", float64(bc.GetDifficulty()))
+	p.gauge("blogochain_pending_transactions", "Transactions waiting in the mempool.", float64(len(pending)))
+	p.gauge("blogochain_mempool_bytes", "Total size of pending transactions in bytes.", float64(pendingBytes))
+	p.gauge("blogochain_server_hashrate", "Hashes per second of the last block mined by this server.", bc.LastHashrate())
+	p.gauge("blogochain_pool_hashrate", "Sum of hashrates reported by connected clients.", h.TotalHashrate())
+	p.gauge("blogochain_connected_clients", "Open WebSocket connections.", float64(h.MinerCount()))
+	p.counter("blogochain_blocks_mined_total", "Blocks mined by this server's mining jobs.", float64(blocksMined))
+	p.counter("blogochain_reorgs_total", "Times the node switched to a different branch.", float64(bc.ReorgCount()))
+
+	p.header("blogochain_mining_duration_seconds", "histogram", "Wall time of successful mining jobs.")
+	for i, le := range miningDurationBuckets {
+		p.sample("blogochain_mining_duration_seconds_bucket", `le="`+strconv.FormatFloat(le, 'g', -1, 64)+`"`, float64(miningCounts[i]))
+	}
+	p.sample("blogochain_mining_duration_seconds_bucket", `le="+Inf"`, float64(miningObserved))
+	p.sample("blogochain_mining_duration_seconds_sum", "", miningSum)
+	p.sample("blogochain_mining_duration_seconds_count", "", float64(miningObserved))
+
+	p.labelled("blogochain_ws_messages_total", "WebSocket messages received by type.", "type", messages)
+	p.labelled("blogochain_transactions_rejected_total", "Transactions refused by reason.", "reason", rejected)
+	p.labelled("blogochain_rate_limited_total", "Messages refused by rate limits by type.", "type", limits.Limited)
+	p.counter("blogochain_rejected_connections_total", "Connections refused by the per-IP limit.", float64(limits.RejectedConns))
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+	"github.com/eshahhh/blogochain/internal/logging"
+)
+
+const (
+	maxQueuedJobs    = 16
+	progressThrottle = 250 * time.Millisecond
+)
+
+var (
+	errQueueFull   = errors.New("mining queue is full")
+	errJobNotFound = errors.New("mining job not found")
+	errNotJobOwner = errors.New("only the client that queued a mining job, or an admin, may cancel it")
+	errMinerClosed = errors.New("server is shutting down")
+)
+
+// miningJob is one mine_block request. Jobs run one at a time in FIFO order;
+// each mines a fresh template taken when the job starts.
+type miningJob struct {
+	ID        string
+	requester *Client
+	// owner is the requester's principal when the job was queued; a named
+	// token holder may cancel the job from another connection.
+	owner       Principal
+	requestedBy string
+	// miner is recorded in the mined block.
+	miner  string
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type outMiningJob struct {
+	Type       string `json:"type"`
+	JobID      string `json:"job_id"`
+	State      string `json:"state"`
+	Position   int    `json:"position,omitempty"`
+	BlockIndex int    `json:"block_index,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+type outMiningProgress struct {
+	Type       string  `json:"type"`
+	JobID      string  `json:"job_id"`
+	BlockIndex int     `json:"block_index"`
+	Difficulty int     `json:"difficulty"`
+	Nonce      int     `json:"nonce"`
+	Attempts   int64   `json:"attempts"`
+	ElapsedMs  int64   `json:"elapsed_ms"`
+	Hashrate   float64 `json:"hashrate"`
+}
+
+// Miner runs mining jobs in the background so readPump never blocks on
+// proof-of-work and the chain lock is only taken to snapshot and submit.
+type Miner struct {
+	hub *Hub
+	bc  *blockchain.Blockchain
+
+	mu      sync.Mutex
+	queue   []*miningJob
+	current *miningJob
+	nextID  int
+	closed  bool
+	wake    chan struct{}
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+func NewMiner(hub *Hub, bc *blockchain.Blockchain) *Miner {
+	return &Miner{
+		hub:  hub,
+		bc:   bc,
+		wake: make(chan struct{}, 1),
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Enqueue adds a job and returns it with its position in the queue
+// (0 means it will start immediately).
+func (m *Miner) Enqueue(requester *Client, requestedBy, miner string) (*miningJob, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, 0, errMinerClosed
+	}
+	if len(m.queue) >= maxQueuedJobs {
+		return nil, 0, errQueueFull
+	}
+
+	m.nextID++
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &miningJob{
+		ID:          fmt.Sprintf("job-%d", m.nextID),
+		requester:   requester,
+		owner:       requester.principal,
+		requestedBy: requestedBy,
+		miner:       miner,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	m.queue = append(m.queue, job)
+
+	position := len(m.queue) - 1
+	if m.current != nil {
+		position++
+	}
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return job, position, nil
+}
+
+// cancellableBy reports whether by may cancel the job: admins may cancel
+// any job, anyone else only their own. Clients without a token share the
+// anonymous principal, so for them only the connection that queued the
+// job counts.
+func (job *miningJob) cancellableBy(by *Client) bool {
+	switch {
+	case by.principal.Role >= RoleAdmin, by == job.requester:
+		return true
+	case job.owner.Name == "anonymous":
+		return false
+	}
+	return by.principal.Name == job.owner.Name
+}
+
+// Cancel stops a running job or removes a queued one on behalf of by. An
+// empty id cancels the job currently being mined.
+func (m *Miner) Cancel(id string, by *Client) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.current != nil && (id == "" || id == m.current.ID) {
+		if !m.current.cancellableBy(by) {
+			return "", errNotJobOwner
+		}
+		m.current.cancel()
+		return m.current.ID, nil
+	}
+
+	for i, job := range m.queue {
+		if job.ID == id {
+			if !job.cancellableBy(by) {
+				return "", errNotJobOwner
+			}
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			job.cancel()
+			m.hub.BroadcastJSON(outMiningJob{Type: "mining_job", JobID: job.ID, State: "cancelled"})
+			// The requester is waiting for the job's result, as for a
+			// running job that is cancelled.
+			job.requester.sendResponse("mine_block_response", false, "Mining cancelled", map[string]interface{}{"job_id": job.ID})
+			return job.ID, nil
+		}
+	}
+	return "", errJobNotFound
+}
+
+// Close cancels the running job, drops the queue and waits for Run to
+// return, so no block is submitted after it.
+func (m *Miner) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		<-m.done
+		return
+	}
+	m.closed = true
+	if m.current != nil {
+		m.current.cancel()
+	}
+	for _, job := range m.queue {
+		job.cancel()
+	}
+	m.queue = nil
+	close(m.quit)
+	m.mu.Unlock()
+
+	<-m.done
+}
+
+func (m *Miner) Run() {
+	defer close(m.done)
+	for {
+		job := m.next()
+		if job == nil {
+			select {
+			case <-m.wake:
+			case <-m.quit:
+				return
+			}
+			continue
+		}
+		m.runJob(job)
+
+		m.mu.Lock()
+		m.current = nil
+		m.mu.Unlock()
+	}
+}
+
+func (m *Miner) next() *miningJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.queue) == 0 {
+		return nil
+	}
+	job := m.queue[0]
+	m.queue = m.queue[1:]
+	m.current = job
+	return job
+}
+
+func (m *Miner) runJob(job *miningJob) {
+	defer job.cancel()
+
+	template := m.bc.NewBlockTemplate()
+	if template == nil {
+		m.hub.BroadcastJSON(outMiningJob{Type: "mining_job", JobID: job.ID, State: "failed", Message: "No pending transactions to mine"})
+		job.requester.sendResponse("mine_block_response", false, "No pending transactions to mine", map[string]interface{}{"job_id": job.ID})
+		return
+	}
+
+	template.Miner = job.miner
+	logging.Infof("[MINER] %s started block #%d for %s (difficulty %d)", job.ID, template.Index, job.requestedBy, template.Difficulty)
+	m.hub.BroadcastJSON(outMiningJob{Type: "mining_job", JobID: job.ID, State: "running", BlockIndex: template.Index})
+	status := outMiningStatus{
+		Type:       "mining_status",
+		Mining:     true,
+		BlockIndex: template.Index,
+		Difficulty: template.Difficulty,
+	}
+	m.hub.BroadcastJSON(status)
+
+	start := time.Now()
+	var lastProgress time.Time
+	progress := func(nonce int, attempts int64) {
+		now := time.Now()
+		if now.Sub(lastProgress) < progressThrottle {
+			return
+		}
+		lastProgress = now
+		elapsed := now.Sub(start)
+		m.hub.BroadcastJSON(outMiningProgress{
+			Type:       "mining_progress",
+			JobID:      job.ID,
+			BlockIndex: template.Index,
+			Difficulty: template.Difficulty,
+			Nonce:      nonce,
+			Attempts:   attempts,
+			ElapsedMs:  elapsed.Milliseconds(),
+			Hashrate:   float64(attempts) / elapsed.Seconds(),
+		})
+	}
+
+	attempts, err := template.MineParallel(job.ctx, template.Difficulty, m.bc.MiningThreads(), progress)
+	if err == nil {
+		err = m.bc.SubmitBlock(template, attempts, time.Since(start))
+	}
+
+	status.Mining = false
+	m.hub.BroadcastJSON(status)
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		logging.Infof("[MINER] %s cancelled after %d attempts", job.ID, attempts)
+		m.hub.BroadcastJSON(outMiningJob{Type: "mining_job", JobID: job.ID, State: "cancelled", BlockIndex: template.Index})
+		job.requester.sendResponse("mine_block_response", false, "Mining cancelled", map[string]interface{}{"job_id": job.ID})
+	case err != nil:
+		logging.Warnf("[MINER] %s failed: %v", job.ID, err)
+		m.hub.BroadcastJSON(outMiningJob{Type: "mining_job", JobID: job.ID, State: "failed", BlockIndex: template.Index, Message: err.Error()})
+		job.requester.sendResponse("mine_block_response", false, "Mining failed: "+err.Error(), map[string]interface{}{"job_id": job.ID})
+	default:
+		m.hub.metrics.blockMined(time.Since(start))
+		logging.Infof("[MINER] %s mined block #%d", job.ID, template.Index)
+		m.hub.BroadcastJSON(outMiningJob{Type: "mining_job", JobID: job.ID, State: "done", BlockIndex: template.Index})
+		job.requester.sendResponse("mine_block_response", true, "Block mined successfully", map[string]interface{}{"job_id": job.ID, "block": template})
+		m.hub.BroadcastChain()
+	}
+}
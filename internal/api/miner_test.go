@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+)
+
+func TestCancelOnlyOwnJobs(t *testing.T) {
+	limiter, err := NewRateLimiter(DefaultRateLimitConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The miner is not run, so jobs stay queued.
+	h := NewHub(blockchain.NewBlockchain(1), NewAuth(RoleMiner, nil, nil), limiter)
+	client := func(name string, role Role) *Client {
+		return &Client{hub: h, principal: Principal{Name: name, Role: role}}
+	}
+	alice := client("alice", RoleMiner)
+	aliceElsewhere := client("alice", RoleMiner)
+	bob := client("bob", RoleMiner)
+	anon := client("anonymous", RoleMiner)
+	anonElsewhere := client("anonymous", RoleMiner)
+	admin := client("root", RoleAdmin)
+
+	enqueue := func(c *Client) string {
+		job, _, err := h.miner.Enqueue(c, c.principal.Name, c.principal.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job.ID
+	}
+	tests := []struct {
+		name  string
+		owner *Client
+		by    *Client
+		ok    bool
+	}{
+		{"owner", alice, alice, true},
+		{"same token on another connection", alice, aliceElsewhere, true},
+		{"another miner", alice, bob, false},
+		{"admin", alice, admin, true},
+		{"anonymous owner", anon, anon, true},
+		{"another anonymous client", anon, anonElsewhere, false},
+		{"named miner on an anonymous job", anon, bob, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := enqueue(tt.owner)
+			got, err := h.miner.Cancel(id, tt.by)
+			if !tt.ok {
+				if !errors.Is(err, errNotJobOwner) {
+					t.Fatalf("Cancel = %q, %v; want errNotJobOwner", got, err)
+				}
+				// Still queued: the owner can cancel it.
+				got, err = h.miner.Cancel(id, tt.owner)
+			}
+			if err != nil || got != id {
+				t.Fatalf("Cancel = %q, %v; want %s", got, err, id)
+			}
+			if _, err := h.miner.Cancel(id, admin); !errors.Is(err, errJobNotFound) {
+				t.Fatalf("second Cancel: %v, want errJobNotFound", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+	"github.com/eshahhh/blogochain/internal/notary"
+)
+
+type notarizeRequest struct {
+	DocumentHash string `json:"document_hash"`
+}
+
+type notarizeResponse struct {
+	DocumentHash string `json:"document_hash"`
+	Status       string `json:"status"`
+	Receipt      string `json:"receipt"`
+}
+
+// HandleNotarize answers POST /notarize, whose JSON body names the hex
+// SHA-256 of a document, by queueing the hash for the next batch. The
+// receipt is served at the returned URL once the batch is mined.
+func (s *Server) HandleNotarize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ok, _, wait := s.hub.limiter.Allow(map[string]*bucket{}, s.hub.limiter.ClientIP(r), "notarize"); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, "too many notarize requests", http.StatusTooManyRequests)
+		return
+	}
+	var req notarizeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil {
+		http.Error(w, "body must be {\"document_hash\": \"<hex SHA-256>\"}", http.StatusBadRequest)
+		return
+	}
+	status, err := s.notary.Submit(req.DocumentHash)
+	if errors.Is(err, notary.ErrBadHash) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, notary.ErrQueueFull) {
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	hash := strings.ToLower(req.DocumentHash)
+	p, _ := s.auth.Authenticate(r)
+	s.auth.Audit(p, r.RemoteAddr, "notarize", true, hash)
+
+	writeJSON(w, http.StatusAccepted, notarizeResponse{DocumentHash: hash, Status: status, Receipt: "/notary/receipts/" + hash})
+}
+
+// HandleReceipt answers GET /notary/receipts/{hash} with the document's
+// receipt, or 202 Accepted and its status while its batch is not mined.
+func (s *Server) HandleReceipt(w http.ResponseWriter, r *http.Request) {
+	hash, ok := pathArg(r, "/notary/receipts/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	hash = strings.ToLower(hash)
+	receipt, err := s.notary.Receipt(hash)
+	if errors.Is(err, notary.ErrPending) {
+		status, _ := s.notary.Status(hash)
+		writeJSON(w, http.StatusAccepted, notarizeResponse{DocumentHash: hash, Status: status, Receipt: r.URL.Path})
+		return
+	}
+	if errors.Is(err, blockchain.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, receipt)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+	"github.com/eshahhh/blogochain/internal/logging"
+)
+
+// PeerCheck is the "peers" readiness check: the node is ready while its
+// chain is at most MaxLag blocks behind the highest peer. Peers are polled
+// by Run and the check reads the last poll, so probing /readyz never waits
+// on the network, and two nodes listing each other do not probe each
+// other in a loop.
+type PeerCheck struct {
+	bc     *blockchain.Blockchain
+	peers  []string
+	maxLag int
+	client *http.Client
+
+	mu      sync.Mutex
+	polled  bool
+	heights map[string]int
+	errs    map[string]error
+}
+
+// NewPeerCheck checks bc against peers, the base URLs of other nodes such
+// as http://node2:8080.
+func NewPeerCheck(bc *blockchain.Blockchain, peers []string, maxLag int) *PeerCheck {
+	return &PeerCheck{
+		bc:     bc,
+		peers:  peers,
+		maxLag: maxLag,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Run polls the peers now and then every interval until ctx is done.
+func (pc *PeerCheck) Run(ctx context.Context, interval time.Duration) {
+	if len(pc.peers) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		pc.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (pc *PeerCheck) poll(ctx context.Context) {
+	heights := make(map[string]int, len(pc.peers))
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, peer := range pc.peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			h, err := pc.height(ctx, peer)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				logging.Warnf("[PEERS] %s: %v", peer, err)
+				errs[peer] = err
+				return
+			}
+			heights[peer] = h
+		}(peer)
+	}
+	wg.Wait()
+
+	pc.mu.Lock()
+	pc.polled, pc.heights, pc.errs = true, heights, errs
+	pc.mu.Unlock()
+}
+
+// height asks peer for its chain height. A peer that is itself not ready
+// answers 503 but still reports its height.
+func (pc *PeerCheck) height(ctx context.Context, peer string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(peer, "/")+"/status", nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := pc.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, fmt.Errorf("status: %s", resp.Status)
+	}
+	var status outStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return 0, fmt.Errorf("status: %w", err)
+	}
+	return status.Height, nil
+}
+
+// Check reports whether the chain has kept up with the peers that
+// answered the last poll. Unreachable peers are ignored as long as one
+// answers.
+func (pc *PeerCheck) Check() (string, error) {
+	if len(pc.peers) == 0 {
+		return "no peers configured", nil
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if !pc.polled {
+		return "", errors.New("peers not polled yet")
+	}
+	if len(pc.heights) == 0 {
+		return "", fmt.Errorf("none of %d peers answered", len(pc.peers))
+	}
+	best, bestPeer := -1, ""
+	for peer, h := range pc.heights {
+		if h > best || (h == best && peer < bestPeer) {
+			best, bestPeer = h, peer
+		}
+	}
+	height := 0
+	if latest := pc.bc.GetLatestBlock(); latest != nil {
+		height = latest.Index
+	}
+	if behind := best - height; behind > pc.maxLag {
+		return "", fmt.Errorf("%d blocks behind %s", behind, bestPeer)
+	}
+	return fmt.Sprintf("at %d, highest of %d/%d peers at %d", height, len(pc.heights), len(pc.peers), best), nil
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+)
+
+func peerAt(t *testing.T, height int, code int) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(code)
+		fmt.Fprintf(w, `{"status":"ready","height":%d}`, height)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestPeerCheck(t *testing.T) {
+	bc := blockchain.NewBlockchain(1) // height 0
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		name  string
+		peers []string
+		ok    bool
+		want  string
+	}{
+		{"no peers", nil, true, "no peers configured"},
+		{"within the lag", []string{peerAt(t, 1, http.StatusOK), peerAt(t, 2, http.StatusOK)}, true, ""},
+		{"too far behind", []string{peerAt(t, 1, http.StatusOK), peerAt(t, 3, http.StatusOK)}, false, "3 blocks behind"},
+		{"peer not ready", []string{peerAt(t, 9, http.StatusServiceUnavailable)}, false, "9 blocks behind"},
+		{"unreachable peer ignored", []string{down.URL, peerAt(t, 0, http.StatusOK)}, true, ""},
+		{"no peer answers", []string{down.URL}, false, "none of 1 peers answered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := NewPeerCheck(bc, tt.peers, 2)
+			if len(tt.peers) > 0 {
+				if _, err := pc.Check(); err == nil {
+					t.Fatal("Check passed before the first poll")
+				}
+			}
+			pc.poll(context.Background())
+			detail, err := pc.Check()
+			if tt.ok != (err == nil) {
+				t.Fatalf("Check = %q, %v; want ok %t", detail, err, tt.ok)
+			}
+			if err != nil {
+				detail = err.Error()
+			}
+			if !strings.Contains(detail, tt.want) {
+				t.Fatalf("Check = %q, want it to mention %q", detail, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket refilling Rate tokens per second up to Burst.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// RateLimitConfig sets per-connection and per-IP limits by message type.
+// The "*" entry applies to types without their own entry. TrustedProxies
+// lists the addresses or CIDR ranges of reverse proxies whose
+// X-Forwarded-For header names the client; by default the client is the
+// connection's remote address, so clients behind one proxy share its
+// limits.
+type RateLimitConfig struct {
+	PerConn        map[string]Limit `json:"per_conn"`
+	PerIP          map[string]Limit `json:"per_ip"`
+	MaxConnsPerIP  int              `json:"max_conns_per_ip"`
+	MaxTxSize      int              `json:"max_tx_size"`
+	TrustedProxies []string         `json:"trusted_proxies"`
+}
+
+func DefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		PerConn: map[string]Limit{
+			"*":               {Rate: 20, Burst: 40},
+			"add_transaction": {Rate: 5, Burst: 10},
+			"search_chain":    {Rate: 1, Burst: 3},
+			"validate":        {Rate: 0.2, Burst: 2},
+			"mine_block":      {Rate: 0.2, Burst: 2},
+			"set_difficulty":  {Rate: 1, Burst: 3},
+			"gc_blobs":        {Rate: 0.1, Burst: 1},
+		},
+		PerIP: map[string]Limit{
+			"*":               {Rate: 50, Burst: 100},
+			"add_transaction": {Rate: 10, Burst: 20},
+			"search_chain":    {Rate: 3, Burst: 6},
+			"validate":        {Rate: 0.5, Burst: 4},
+			"mine_block":      {Rate: 0.5, Burst: 4},
+			"upload_blob":     {Rate: 1, Burst: 10},
+			"notarize":        {Rate: 5, Burst: 50},
+		},
+		MaxConnsPerIP: 8,
+		MaxTxSize:     1024,
+	}
+}
+
+// limitFor returns the limit for msgType and the key of its bucket. Types
+// without their own limit share the "*" bucket, so a client cannot make
+// the limiter keep a bucket for every type name it invents.
+func (cfg RateLimitConfig) limitFor(limits map[string]Limit, msgType string) (Limit, string, bool) {
+	if l, ok := limits[msgType]; ok {
+		return l, msgType, true
+	}
+	l, ok := limits["*"]
+	return l, "*", ok
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+func newBucket(l Limit, now time.Time) *bucket {
+	return &bucket{tokens: float64(l.Burst), last: now, limit: l}
+}
+
+// take consumes a token if one is available, otherwise it reports how long
+// until the next token.
+func (b *bucket) take(now time.Time) (bool, time.Duration) {
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if b.limit.Rate <= 0 {
+		return false, time.Minute
+	}
+	return false, time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst)
+}
+
+type ipState struct {
+	conns   int
+	buckets map[string]*bucket
+}
+
+// RateLimiter enforces RateLimitConfig and keeps the counters reported in
+// metrics. Per-connection buckets live on the Client and are only touched
+// from its readPump.
+type RateLimiter struct {
+	cfg     RateLimitConfig
+	proxies []*net.IPNet
+
+	mu            sync.Mutex
+	ips           map[string]*ipState
+	limited       map[string]uint64
+	rejectedConns uint64
+	oversizedTxs  uint64
+}
+
+func NewRateLimiter(cfg RateLimitConfig) (*RateLimiter, error) {
+	proxies, err := ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &RateLimiter{
+		cfg:     cfg,
+		proxies: proxies,
+		ips:     make(map[string]*ipState),
+		limited: make(map[string]uint64),
+	}, nil
+}
+
+// ParseTrustedProxies parses addresses such as 10.0.0.1 and ranges such
+// as 10.0.0.0/8.
+func ParseTrustedProxies(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, p := range list {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("trusted proxy %q is not an IP address or CIDR range", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q is not an IP address or CIDR range", p)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func (rl *RateLimiter) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range rl.proxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address r's limits are kept under. A request from
+// a trusted proxy is attributed to the nearest address in X-Forwarded-For
+// that is not itself a trusted proxy; the entries before it could have
+// been written by the client and are ignored.
+func (rl *RateLimiter) ClientIP(r *http.Request) string {
+	ip := clientIP(r.RemoteAddr)
+	if !rl.trusted(ip) {
+		return ip
+	}
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !rl.trusted(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func clientIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+func (rl *RateLimiter) ipLocked(ip string) *ipState {
+	st, ok := rl.ips[ip]
+	if !ok {
+		st = &ipState{buckets: make(map[string]*bucket)}
+		rl.ips[ip] = st
+	}
+	return st
+}
+
+// AcquireConn reserves a connection slot for ip.
+func (rl *RateLimiter) AcquireConn(ip string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	st := rl.ipLocked(ip)
+	if rl.cfg.MaxConnsPerIP > 0 && st.conns >= rl.cfg.MaxConnsPerIP {
+		rl.rejectedConns++
+		return false
+	}
+	st.conns++
+	return true
+}
+
+func (rl *RateLimiter) ReleaseConn(ip string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if st, ok := rl.ips[ip]; ok && st.conns > 0 {
+		st.conns--
+	}
+}
+
+// Allow charges one msgType message to the connection's buckets and to
+// its IP. scope names the limit that refused it.
+func (rl *RateLimiter) Allow(connBuckets map[string]*bucket, ip, msgType string) (ok bool, scope string, retryAfter time.Duration) {
+	now := time.Now()
+
+	if l, key, limited := rl.cfg.limitFor(rl.cfg.PerConn, msgType); limited {
+		b, exists := connBuckets[key]
+		if !exists {
+			b = newBucket(l, now)
+			connBuckets[key] = b
+		}
+		if ok, wait := b.take(now); !ok {
+			rl.countLimited(key)
+			return false, "connection", wait
+		}
+	}
+
+	if l, key, limited := rl.cfg.limitFor(rl.cfg.PerIP, msgType); limited {
+		rl.mu.Lock()
+		st := rl.ipLocked(ip)
+		b, exists := st.buckets[key]
+		if !exists {
+			b = newBucket(l, now)
+			st.buckets[key] = b
+		}
+		ok, wait := b.take(now)
+		if !ok {
+			rl.limited[key]++
+		}
+		rl.mu.Unlock()
+		if !ok {
+			return false, "ip", wait
+		}
+	}
+
+	return true, "", 0
+}
+
+func (rl *RateLimiter) countLimited(msgType string) {
+	rl.mu.Lock()
+	rl.limited[msgType]++
+	rl.mu.Unlock()
+}
+
+// CheckTxSize reports whether a transaction payload fits MaxTxSize.
+func (rl *RateLimiter) CheckTxSize(data string) bool {
+	if rl.cfg.MaxTxSize <= 0 || len(data) <= rl.cfg.MaxTxSize {
+		return true
+	}
+	rl.mu.Lock()
+	rl.oversizedTxs++
+	rl.mu.Unlock()
+	return false
+}
+
+func (rl *RateLimiter) MaxTxSize() int {
+	return rl.cfg.MaxTxSize
+}
+
+// Prune forgets IPs with no open connections whose buckets have refilled.
+func (rl *RateLimiter) Prune() {
+	now := time.Now()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for ip, st := range rl.ips {
+		if st.conns > 0 {
+			continue
+		}
+		idle := true
+		for _, b := range st.buckets {
+			if !b.full(now) {
+				idle = false
+				break
+			}
+		}
+		if idle {
+			delete(rl.ips, ip)
+		}
+	}
+}
+
+type RateLimitStats struct {
+	Limited       map[string]uint64 `json:"limited"`
+	RejectedConns uint64            `json:"rejected_conns"`
+	OversizedTxs  uint64            `json:"oversized_txs"`
+}
+
+func (rl *RateLimiter) Stats() RateLimitStats {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	limited := make(map[string]uint64, len(rl.limited))
+	for k, v := range rl.limited {
+		limited[k] = v
+	}
+	return RateLimitStats{
+		Limited:       limited,
+		RejectedConns: rl.rejectedConns,
+		OversizedTxs:  rl.oversizedTxs,
+	}
+}
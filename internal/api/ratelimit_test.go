@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	rl, err := NewRateLimiter(RateLimitConfig{TrustedProxies: []string{"10.0.0.0/8", "192.0.2.7", "2001:db8::1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"direct client", "203.0.113.5:4000", nil, "203.0.113.5"},
+		{"direct client forging the header", "203.0.113.5:4000", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"trusted proxy", "10.1.2.3:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy without the header", "10.1.2.3:4000", nil, "10.1.2.3"},
+		{"client prepends a fake address", "10.1.2.3:4000", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "192.0.2.7:4000", []string{"198.51.100.1, 10.9.9.9"}, "198.51.100.1"},
+		{"header split over lines", "192.0.2.7:4000", []string{"198.51.100.1", "10.9.9.9"}, "198.51.100.1"},
+		{"every hop trusted", "10.1.2.3:4000", []string{"10.0.0.2"}, "10.0.0.2"},
+		{"garbage stops the walk", "10.1.2.3:4000", []string{"198.51.100.1, unknown"}, "10.1.2.3"},
+		{"ipv6 proxy", "[2001:db8::1]:4000", []string{"2001:db8::99"}, "2001:db8::99"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/search", nil)
+			r.RemoteAddr = tt.remote
+			for _, h := range tt.xff {
+				r.Header.Add("X-Forwarded-For", h)
+			}
+			if got := rl.ClientIP(r); got != tt.want {
+				t.Fatalf("ClientIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewRateLimiter(RateLimitConfig{TrustedProxies: []string{"10.0.0.0/33"}}); err == nil {
+		t.Fatal("NewRateLimiter accepted an invalid CIDR range")
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+)
+
+// HandleSearch answers GET /search with a page of blockchain.SearchPage
+// JSON. Parameters mirror the WebSocket search_chain message: q, mode, from_height,
+// to_height, since, until (RFC 3339 or YYYY-MM-DD), author, tx_type, tag
+// (repeatable), miner, sort, cursor and limit. It shares the per-IP
+// search_chain rate limit.
+func (s *Server) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.hub.disabled["search_chain"] {
+		http.Error(w, "search is disabled on this server", http.StatusForbidden)
+		return
+	}
+	if ok, _, wait := s.hub.limiter.Allow(map[string]*bucket{}, s.hub.limiter.ClientIP(r), "search_chain"); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, "too many search requests", http.StatusTooManyRequests)
+		return
+	}
+
+	q, err := parseSearchParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := s.blockchain.Search(q)
+	if errors.Is(err, blockchain.ErrBadQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, blockchain.ErrSearchBudget) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(page)
+}
+
+func parseSearchParams(v url.Values) (blockchain.SearchQuery, error) {
+	q := blockchain.SearchQuery{
+		Text:   v.Get("q"),
+		Mode:   blockchain.SearchMode(v.Get("mode")),
+		Author: v.Get("author"),
+		TxType: v.Get("tx_type"),
+		Tags:   v["tag"],
+		Miner:  v.Get("miner"),
+		Sort:   v.Get("sort"),
+		Cursor: v.Get("cursor"),
+	}
+	var err error
+	if q.FromHeight, err = intParam(v, "from_height"); err != nil {
+		return q, err
+	}
+	if q.ToHeight, err = intParam(v, "to_height"); err != nil {
+		return q, err
+	}
+	if q.Since, err = blockchain.ParseSearchTime(v.Get("since"), false); err != nil {
+		return q, fmt.Errorf("since: %w", err)
+	}
+	if q.Until, err = blockchain.ParseSearchTime(v.Get("until"), true); err != nil {
+		return q, fmt.Errorf("until: %w", err)
+	}
+	if s := v.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil {
+			return q, fmt.Errorf("limit: not an integer: %q", s)
+		}
+	}
+	return q, nil
+}
+
+func intParam(v url.Values, name string) (*int, error) {
+	s := v.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: not an integer: %q", name, s)
+	}
+	return &n, nil
+}
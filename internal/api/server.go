@@ -1,39 +1,179 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/eshahhh/blogochain/internal/blockchain"
+	"github.com/eshahhh/blogochain/internal/notary"
+	"github.com/eshahhh/blogochain/internal/store"
+	"github.com/eshahhh/blogochain/web"
+	"github.com/gorilla/websocket"
 )
 
 type Server struct {
-	blockchain *blockchain.Blockchain
-	hub        *Hub
+	blockchain  *blockchain.Blockchain
+	hub         *Hub
+	auth        *Auth
+	upgrader    websocket.Upgrader
+	static      *staticFiles
+	blog        *blogPages
+	blobs       *store.Blobs
+	maxBlobSize int64
+	notary      *notary.Notary
+	httpServer  *http.Server
+	checks      []readinessCheck
+	started     time.Time
 }
 
-func NewServer(bc *blockchain.Blockchain) *Server {
-	s := &Server{blockchain: bc}
-	h := NewHub(bc)
+// Options configures a Server. A nil Auth lets every client act as admin;
+// nil RateLimits uses DefaultRateLimitConfig. An empty StaticDir serves the
+// web UI embedded in the binary; setting it serves that directory instead,
+// which is handy while editing the UI. Attachments are stored in Blobs, up
+// to MaxBlobSize bytes each; without Blobs the server has no /blobs
+// endpoints. Likewise Notary serves /notarize and /notary/receipts/.
+type Options struct {
+	Auth        *Auth
+	RateLimits  *RateLimitConfig
+	StaticDir   string
+	Blobs       *store.Blobs
+	MaxBlobSize int64
+	Notary      *notary.Notary
+
+	DisableMining            bool
+	DisableDifficultyChanges bool
+	DisableSearch            bool
+}
+
+func NewServer(bc *blockchain.Blockchain, opts Options) (*Server, error) {
+	auth := opts.Auth
+	if auth == nil {
+		auth = NewAuth(RoleAdmin, nil, nil)
+	}
+	var static *staticFiles
+	var err error
+	if opts.StaticDir == "" {
+		static, err = newStaticFiles(web.Static(), true)
+	} else {
+		static, err = newStaticFiles(os.DirFS(opts.StaticDir), false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	blog, err := newBlogPages(bc, web.Templates())
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		blockchain: bc,
+		auth:       auth,
+		static:     static,
+		blog:       blog,
+		blobs:      opts.Blobs,
+		notary:     opts.Notary,
+		started:    time.Now(),
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     auth.CheckOrigin,
+		},
+	}
+	limits := DefaultRateLimitConfig()
+	if opts.RateLimits != nil {
+		limits = *opts.RateLimits
+	}
+	limiter, err := NewRateLimiter(limits)
+	if err != nil {
+		return nil, err
+	}
+	h := NewHub(bc, auth, limiter)
+	h.blobs = opts.Blobs
+	s.maxBlobSize = opts.MaxBlobSize
+	if s.maxBlobSize <= 0 {
+		s.maxBlobSize = defaultMaxBlobSize
+	}
+	if opts.DisableMining {
+		h.Disable("mine_block", "cancel_mining")
+	}
+	if opts.DisableDifficultyChanges {
+		h.Disable("set_difficulty")
+	}
+	if opts.DisableSearch {
+		h.Disable("search_chain")
+	}
 	s.hub = h
+	// Built here rather than in ListenAndServe so Shutdown never races
+	// with its creation.
+	s.httpServer = &http.Server{Handler: s.SetupRoutes()}
+	s.addBuiltinChecks()
 	go h.Run()
+	go h.miner.Run()
 	h.StartTicker()
-	return s
+	return s, nil
 }
 
 func (s *Server) SetupRoutes() *http.ServeMux {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/ws", s.HandleWS)
+	mux.Handle("/metrics", s.auth.RequireRole(RoleViewer, http.HandlerFunc(s.HandleMetrics)))
+	mux.HandleFunc("/healthz", s.HandleHealthz)
+	mux.HandleFunc("/readyz", s.HandleReadyz)
+	mux.HandleFunc("/status", s.HandleStatus)
+	mux.Handle("/search", s.auth.RequireRole(RoleViewer, http.HandlerFunc(s.HandleSearch)))
+	mux.Handle("/posts", s.auth.RequireRole(RoleViewer, http.HandlerFunc(s.blog.HandlePosts)))
+	mux.Handle("/posts/", s.auth.RequireRole(RoleViewer, http.HandlerFunc(s.blog.HandlePosts)))
+	mux.Handle("/authors/", s.auth.RequireRole(RoleViewer, http.HandlerFunc(s.blog.HandleAuthor)))
+	mux.Handle("/tags/", s.auth.RequireRole(RoleViewer, http.HandlerFunc(s.blog.HandleTag)))
+	mux.Handle("/feed.atom", s.auth.RequireRole(RoleViewer, http.HandlerFunc(s.blog.HandleFeed)))
+	mux.Handle("/proof/", s.auth.RequireRole(RoleViewer, http.HandlerFunc(s.blog.HandleProof)))
+	if s.blobs != nil {
+		mux.Handle("/blobs", s.auth.RequireRole(RoleSubmitter, http.HandlerFunc(s.HandleUpload)))
+		mux.Handle("/blobs/", s.auth.RequireRole(RoleViewer, http.HandlerFunc(s.HandleBlob)))
+	}
+	if s.notary != nil {
+		mux.Handle("/notarize", s.auth.RequireRole(RoleSubmitter, http.HandlerFunc(s.HandleNotarize)))
+		mux.Handle("/notary/receipts/", s.auth.RequireRole(RoleViewer, http.HandlerFunc(s.HandleReceipt)))
+	}
 
-	fs := http.FileServer(http.Dir("web/static"))
-	mux.Handle("/static/", http.StripPrefix("/static/", fs))
+	mux.Handle("/static/", http.StripPrefix("/static/", s.static))
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			http.NotFound(w, r)
 			return
 		}
-		http.ServeFile(w, r, "web/static/index.html")
+		s.static.serveFile(w, r, "index.html")
 	})
 
 	return mux
 }
+
+// ListenAndServe serves SetupRoutes on addr until Shutdown is called, in
+// which case it returns nil. After Shutdown it returns nil at once.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if err := s.httpServer.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting connections, cancels mining, sends every
+// WebSocket client a close frame and waits for them until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.httpServer.Shutdown(ctx)
+	s.hub.miner.Close()
+	s.hub.Close()
+	if waitErr := s.hub.Wait(ctx); err == nil {
+		err = waitErr
+	}
+	return err
+}
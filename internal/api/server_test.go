@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+)
+
+func TestMain(m *testing.M) {
+	blockchain.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	s, err := NewServer(blockchain.NewBlockchain(1), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Shutdown may come before, during or after ListenAndServe starts; run
+// with -race.
+func TestShutdownRacesListen(t *testing.T) {
+	s := newTestServer(t)
+	served := make(chan error, 1)
+	go func() { served <- s.ListenAndServe("127.0.0.1:0") }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("ListenAndServe: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListenAndServe kept serving after Shutdown")
+	}
+}
+
+func TestListenAfterShutdown(t *testing.T) {
+	s := newTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := s.ListenAndServe("127.0.0.1:0"); err != nil {
+		t.Fatalf("ListenAndServe after Shutdown: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// staticFiles serves the web UI with strong ETags so browsers revalidate
+// instead of refetching. Embedded files cannot change, so their ETags are
+// computed once; files served from disk are hashed on every request.
+type staticFiles struct {
+	fsys  fs.FS
+	etags map[string]string
+}
+
+func newStaticFiles(fsys fs.FS, precompute bool) (*staticFiles, error) {
+	sf := &staticFiles{fsys: fsys}
+	if !precompute {
+		return sf, nil
+	}
+	sf.etags = make(map[string]string)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		etag, err := fileETag(fsys, name)
+		if err != nil {
+			return err
+		}
+		sf.etags[name] = etag
+		return nil
+	})
+	return sf, err
+}
+
+func fileETag(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, nil
+}
+
+func (sf *staticFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+	sf.serveFile(w, r, name)
+}
+
+func (sf *staticFiles) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := sf.fsys.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "file is not seekable", http.StatusInternalServerError)
+		return
+	}
+
+	etag, ok := sf.etags[name]
+	if !ok {
+		if etag, err = fileETag(sf.fsys, name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// Embedded files have a zero ModTime, which ServeContent ignores.
+	var modTime time.Time
+	if sf.etags == nil {
+		modTime = fi.ModTime()
+	}
+	http.ServeContent(w, r, name, modTime, content)
+}
@@ -1,13 +1,16 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/eshahhh/blogochain/internal/blockchain"
+	"github.com/eshahhh/blogochain/internal/logging"
+	"github.com/eshahhh/blogochain/internal/store"
 	"github.com/gorilla/websocket"
 )
 
@@ -20,25 +23,54 @@ type Hub struct {
 	hashrates map[*Client]float64
 	mu        sync.RWMutex
 
-	bc *blockchain.Blockchain
+	bc       *blockchain.Blockchain
+	miner    *Miner
+	auth     *Auth
+	limiter  *RateLimiter
+	metrics  *serverMetrics
+	disabled map[string]bool
+	blobs    *store.Blobs
+
+	quit      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	pumps     sync.WaitGroup
 }
 
-func NewHub(bc *blockchain.Blockchain) *Hub {
-	return &Hub{
+func NewHub(bc *blockchain.Blockchain, auth *Auth, limiter *RateLimiter) *Hub {
+	h := &Hub{
 		clients:    make(map[*Client]bool),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		broadcast:  make(chan []byte, 256),
 		hashrates:  make(map[*Client]float64),
 		bc:         bc,
+		auth:       auth,
+		limiter:    limiter,
+		metrics:    newServerMetrics(),
+		disabled:   make(map[string]bool),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
 	}
+	h.miner = NewMiner(h, bc)
+	return h
 }
 
 func (h *Hub) Run() {
+	defer close(h.done)
 	for {
 		select {
+		case <-h.quit:
+			h.mu.Lock()
+			for c := range h.clients {
+				delete(h.clients, c)
+				delete(h.hashrates, c)
+				close(c.send)
+			}
+			h.mu.Unlock()
+			return
 		case c := <-h.register:
-			log.Println("[WS] client registered")
+			logging.Debugf("[WS] client registered")
 			h.mu.Lock()
 			h.clients[c] = true
 			h.hashrates[c] = 0
@@ -46,7 +78,7 @@ func (h *Hub) Run() {
 			h.sendChainTo(c)
 			h.broadcastMetrics()
 		case c := <-h.unregister:
-			log.Println("[WS] client unregistered")
+			logging.Debugf("[WS] client unregistered")
 			h.mu.Lock()
 			if _, ok := h.clients[c]; ok {
 				delete(h.clients, c)
@@ -56,7 +88,7 @@ func (h *Hub) Run() {
 			h.mu.Unlock()
 			h.broadcastMetrics()
 		case msg := <-h.broadcast:
-			h.mu.RLock()
+			h.mu.Lock()
 			for c := range h.clients {
 				select {
 				case c.send <- msg:
@@ -66,17 +98,65 @@ func (h *Hub) Run() {
 					delete(h.hashrates, c)
 				}
 			}
-			h.mu.RUnlock()
+			h.mu.Unlock()
 		}
 	}
 }
 
+// Close stops Run and the ticker and closes every client's send channel,
+// which makes its writePump send a close frame. It does not wait for the
+// frames to be written; see Wait.
+func (h *Hub) Close() {
+	h.closeOnce.Do(func() { close(h.quit) })
+	<-h.done
+}
+
+// Wait blocks until every client's writePump has returned or ctx is done.
+func (h *Hub) Wait(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		h.pumps.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *Hub) closing() bool {
+	select {
+	case <-h.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// Disable turns off the given message types. Call before Run.
+func (h *Hub) Disable(msgTypes ...string) {
+	for _, t := range msgTypes {
+		h.disabled[t] = true
+	}
+}
+
 func (h *Hub) StartTicker() {
 	go func() {
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
-		for range ticker.C {
+		ticks := 0
+		for {
+			select {
+			case <-h.quit:
+				return
+			case <-ticker.C:
+			}
 			h.broadcastMetrics()
+			if ticks++; ticks%60 == 0 {
+				h.limiter.Prune()
+			}
 		}
 	}()
 }
@@ -104,13 +184,14 @@ func (h *Hub) MinerCount() int {
 }
 
 type outMetrics struct {
-	Type           string  `json:"type"`
-	Miners         int     `json:"miners"`
-	TotalHashrate  float64 `json:"total_hashrate"`
-	Pending        int     `json:"pending"`
-	ChainLen       int     `json:"chain_len"`
-	Difficulty     int     `json:"difficulty"`
-	ServerHashrate float64 `json:"server_hashrate"`
+	Type           string         `json:"type"`
+	Miners         int            `json:"miners"`
+	TotalHashrate  float64        `json:"total_hashrate"`
+	Pending        int            `json:"pending"`
+	ChainLen       int            `json:"chain_len"`
+	Difficulty     int            `json:"difficulty"`
+	ServerHashrate float64        `json:"server_hashrate"`
+	RateLimits     RateLimitStats `json:"rate_limits"`
 }
 
 type outChain struct {
@@ -119,12 +200,20 @@ type outChain struct {
 }
 
 type outResponse struct {
-	Type    string              `json:"type"`
-	Success bool                `json:"success"`
-	Message string              `json:"message"`
-	Block   *blockchain.Block   `json:"block,omitempty"`
-	Results []*blockchain.Block `json:"results,omitempty"`
-	Data    interface{}         `json:"data,omitempty"`
+	Type    string            `json:"type"`
+	Success bool              `json:"success"`
+	Message string            `json:"message"`
+	Block   *blockchain.Block `json:"block,omitempty"`
+	Data    interface{}       `json:"data,omitempty"`
+}
+
+type outSearchResponse struct {
+	Type       string                    `json:"type"`
+	Success    bool                      `json:"success"`
+	Message    string                    `json:"message"`
+	Results    []blockchain.SearchResult `json:"results"`
+	Total      int                       `json:"total"`
+	NextCursor string                    `json:"next_cursor,omitempty"`
 }
 
 type outPendingTransactions struct {
@@ -150,6 +239,7 @@ func (h *Hub) broadcastMetrics() {
 		ChainLen:       chainLen,
 		Difficulty:     h.bc.GetDifficulty(),
 		ServerHashrate: h.bc.LastHashrate(),
+		RateLimits:     h.limiter.Stats(),
 	}
 	h.BroadcastJSON(m)
 }
@@ -162,6 +252,17 @@ func (h *Hub) BroadcastChain() {
 func (h *Hub) sendChainTo(c *Client) {
 	payload := outChain{Type: "chain", Blocks: h.bc.GetChain()}
 	b, _ := json.Marshal(payload)
+	h.sendTo(c, b)
+}
+
+// sendTo queues b for c if it is still registered. Mining jobs reply after
+// their requester may have gone, and c.send is closed on unregister.
+func (h *Hub) sendTo(c *Client, b []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if !h.clients[c] {
+		return
+	}
 	select {
 	case c.send <- b:
 	default:
@@ -171,7 +272,7 @@ func (h *Hub) sendChainTo(c *Client) {
 func (h *Hub) BroadcastJSON(v any) {
 	b, err := json.Marshal(v)
 	if err != nil {
-		log.Println("broadcast marshal error:", err)
+		logging.Errorf("broadcast marshal error: %v", err)
 		return
 	}
 	select {
@@ -181,16 +282,14 @@ func (h *Hub) BroadcastJSON(v any) {
 }
 
 type Client struct {
-	hub  *Hub
-	conn *websocket.Conn
-	send chan []byte
-	name string
-}
-
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin:     func(r *http.Request) bool { return true },
+	hub       *Hub
+	conn      *websocket.Conn
+	send      chan []byte
+	name      string
+	principal Principal
+	remote    string
+	ip        string
+	buckets   map[string]*bucket
 }
 
 type inboundMsg struct {
@@ -199,17 +298,56 @@ type inboundMsg struct {
 	HPS        float64 `json:"hps,omitempty"`
 	Data       string  `json:"data,omitempty"`
 	Difficulty *int    `json:"difficulty,omitempty"`
-	Query      string  `json:"query,omitempty"`
+	JobID      string  `json:"job_id,omitempty"`
+	Token      string  `json:"token,omitempty"`
+	Hash       string  `json:"hash,omitempty"`
+	Height     *int    `json:"height,omitempty"`
+	TxID       string  `json:"tx_id,omitempty"`
+	PostID     string  `json:"post_id,omitempty"`
 }
 
 func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	principal, ok := s.auth.Authenticate(r)
+	if !ok {
+		s.auth.Audit(Principal{Name: "invalid-token"}, r.RemoteAddr, "connect", false, "unknown token")
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	if principal.Role < RoleViewer {
+		s.auth.Audit(principal, r.RemoteAddr, "connect", false, "requires viewer")
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	ip := s.hub.limiter.ClientIP(r)
+	if !s.hub.limiter.AcquireConn(ip) {
+		http.Error(w, "too many connections", http.StatusTooManyRequests)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		http.Error(w, "Upgrade failed", http.StatusBadRequest)
+		s.hub.limiter.ReleaseConn(ip)
+		return
+	}
+	client := &Client{
+		hub:       s.hub,
+		conn:      conn,
+		send:      make(chan []byte, 256),
+		principal: principal,
+		remote:    r.RemoteAddr,
+		ip:        ip,
+		buckets:   make(map[string]*bucket),
+	}
+	s.hub.pumps.Add(1)
+	select {
+	case s.hub.register <- client:
+	case <-s.hub.quit:
+		s.hub.pumps.Done()
+		s.hub.limiter.ReleaseConn(ip)
+		conn.Close()
 		return
 	}
-	client := &Client{hub: s.hub, conn: conn, send: make(chan []byte, 256)}
-	s.hub.register <- client
 
 	go client.writePump()
 	go client.readPump()
@@ -217,10 +355,15 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.quit:
+		}
+		c.hub.limiter.ReleaseConn(c.ip)
 		c.conn.Close()
 	}()
-	c.conn.SetReadLimit(1024)
+	// Leave room for JSON escaping of a maximum-size transaction.
+	c.conn.SetReadLimit(int64(2*c.hub.limiter.MaxTxSize() + 1024))
 	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -235,7 +378,13 @@ func (c *Client) readPump() {
 		if err := json.Unmarshal(data, &msg); err != nil {
 			continue
 		}
+		c.hub.metrics.countMessage(msg.Type)
+		if !c.allow(msg) || !c.authorize(msg) {
+			continue
+		}
 		switch msg.Type {
+		case "auth":
+			c.handleAuth(msg)
 		case "hello":
 			c.name = msg.Name
 		case "hashrate":
@@ -244,30 +393,120 @@ func (c *Client) readPump() {
 			c.handleAddTransaction(msg)
 		case "mine_block":
 			c.handleMineBlock()
+		case "cancel_mining":
+			c.handleCancelMining(msg)
 		case "set_difficulty":
 			c.handleSetDifficulty(msg)
 		case "search_chain":
-			c.handleSearchChain(msg)
+			c.handleSearchChain(data)
 		case "get_pending":
 			c.handleGetPending()
 		case "get_chain":
 			c.handleGetChain()
+		case "get_block":
+			c.handleGetBlock(msg)
+		case "get_transaction":
+			c.handleGetTransaction(msg)
+		case "get_posts":
+			c.handleGetPosts()
+		case "get_post":
+			c.handleGetPost(msg)
+		case "validate":
+			c.handleValidate()
+		case "gc_blobs":
+			c.handleGCBlobs()
 		}
 	}
 }
 
+type outRateLimited struct {
+	Type         string `json:"type"`
+	Success      bool   `json:"success"`
+	Message      string `json:"message"`
+	RequestType  string `json:"request_type"`
+	Scope        string `json:"scope"`
+	RetryAfterMs int64  `json:"retry_after_ms"`
+}
+
+// allow applies the connection and IP rate limits to msg.
+func (c *Client) allow(msg inboundMsg) bool {
+	ok, scope, wait := c.hub.limiter.Allow(c.buckets, c.ip, msg.Type)
+	if ok {
+		return true
+	}
+	if msg.Type == "add_transaction" {
+		c.hub.metrics.rejectTx("rate_limited")
+	}
+	c.sendJSON(outRateLimited{
+		Type:         "rate_limited",
+		Success:      false,
+		Message:      "Too many " + msg.Type + " requests",
+		RequestType:  msg.Type,
+		Scope:        scope,
+		RetryAfterMs: wait.Milliseconds(),
+	})
+	return false
+}
+
+// authorize checks msg against the connection's role, answering denials
+// with a "<type>_response" failure and auditing privileged messages.
+func (c *Client) authorize(msg inboundMsg) bool {
+	required, known := messageRoles[msg.Type]
+	if !known {
+		return false
+	}
+	if c.hub.disabled[msg.Type] {
+		if msg.Type == "add_transaction" {
+			c.hub.metrics.rejectTx("disabled")
+		}
+		c.sendResponse(msg.Type+"_response", false, "This feature is disabled on this server", nil)
+		return false
+	}
+	if c.principal.Role < required {
+		if msg.Type == "add_transaction" {
+			c.hub.metrics.rejectTx("forbidden")
+		}
+		c.hub.auth.Audit(c.principal, c.remote, msg.Type, false, "requires "+required.String())
+		c.sendResponse(msg.Type+"_response", false, "Forbidden: requires role "+required.String(), map[string]interface{}{"required_role": required.String()})
+		return false
+	}
+	if required >= RoleSubmitter {
+		c.hub.auth.Audit(c.principal, c.remote, msg.Type, true, auditDetail(msg))
+	}
+	return true
+}
+
+func auditDetail(msg inboundMsg) string {
+	switch msg.Type {
+	case "add_transaction":
+		return fmt.Sprintf("%d bytes", len(msg.Data))
+	case "set_difficulty":
+		if msg.Difficulty != nil {
+			return fmt.Sprintf("difficulty=%d", *msg.Difficulty)
+		}
+	case "cancel_mining":
+		return "job_id=" + msg.JobID
+	}
+	return ""
+}
+
 func (c *Client) writePump() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
+		c.hub.pumps.Done()
 	}()
 	for {
 		select {
 		case message, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				closeMsg := []byte{}
+				if c.hub.closing() {
+					closeMsg = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, closeMsg)
 				return
 			}
 			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
@@ -295,52 +534,78 @@ func (c *Client) sendResponse(msgType string, success bool, message string, data
 func (c *Client) sendJSON(v interface{}) {
 	b, err := json.Marshal(v)
 	if err != nil {
-		log.Println("client marshal error:", err)
+		logging.Errorf("client marshal error: %v", err)
 		return
 	}
-	select {
-	case c.send <- b:
-	default:
+	c.hub.sendTo(c, b)
+}
+
+func (c *Client) handleAuth(msg inboundMsg) {
+	p, ok := c.hub.auth.Lookup(msg.Token)
+	if !ok {
+		c.hub.auth.Audit(Principal{Name: "invalid-token"}, c.remote, "auth", false, "unknown token")
+		c.sendResponse("auth_response", false, "Invalid token", nil)
+		return
 	}
+	c.principal = p
+	c.hub.auth.Audit(p, c.remote, "auth", true, "")
+	c.sendResponse("auth_response", true, "Authenticated", map[string]interface{}{"name": p.Name, "role": p.Role.String()})
 }
 
 func (c *Client) handleAddTransaction(msg inboundMsg) {
 	if msg.Data == "" {
+		c.hub.metrics.rejectTx("empty")
 		c.sendResponse("add_transaction_response", false, "Transaction data cannot be empty", nil)
 		return
 	}
+	if !c.hub.limiter.CheckTxSize(msg.Data) {
+		c.hub.metrics.rejectTx("too_large")
+		c.sendResponse("add_transaction_response", false, fmt.Sprintf("Transaction exceeds %d bytes", c.hub.limiter.MaxTxSize()), nil)
+		return
+	}
 
-	c.hub.bc.AddTransaction(msg.Data)
+	if err := c.hub.bc.AddTransaction(msg.Data); err != nil {
+		c.hub.metrics.rejectTx("invalid")
+		c.sendResponse("add_transaction_response", false, err.Error(), nil)
+		return
+	}
 	c.sendResponse("add_transaction_response", true, "Transaction added successfully", nil)
-	log.Printf("[WS] Transaction added: %s", msg.Data)
+	logging.Debugf("[WS] Transaction added: %s", msg.Data)
 }
 
 func (c *Client) handleMineBlock() {
-	log.Println("[WS] Mining block requested")
+	logging.Debugf("[WS] Mining block requested")
 
-	chainLen := len(c.hub.bc.GetChain())
-	difficulty := c.hub.bc.GetDifficulty()
+	requestedBy := c.name
+	if requestedBy == "" {
+		requestedBy = c.conn.RemoteAddr().String()
+	}
 
-	miningStatus := outMiningStatus{
-		Type:       "mining_status",
-		Mining:     true,
-		BlockIndex: chainLen + 1,
-		Difficulty: difficulty,
+	// Blocks name the token holder, or what the client said in hello when
+	// it has no token; never its address.
+	miner := c.principal.Name
+	if miner == "anonymous" {
+		miner = c.name
 	}
-	c.hub.BroadcastJSON(miningStatus)
 
-	block := c.hub.bc.MineBlock()
+	job, position, err := c.hub.miner.Enqueue(c, requestedBy, miner)
+	if err != nil {
+		c.sendResponse("mine_block_response", false, err.Error(), nil)
+		return
+	}
 
-	miningStatus.Mining = false
-	c.hub.BroadcastJSON(miningStatus)
+	c.sendResponse("mine_block_queued", true, "Mining job queued", map[string]interface{}{"job_id": job.ID, "position": position})
+	c.hub.BroadcastJSON(outMiningJob{Type: "mining_job", JobID: job.ID, State: "queued", Position: position})
+}
 
-	if block == nil {
-		c.sendResponse("mine_block_response", false, "No pending transactions to mine", nil)
-	} else {
-		c.sendResponse("mine_block_response", true, "Block mined successfully", map[string]interface{}{"block": block})
-		c.hub.BroadcastChain()
-		log.Printf("[WS] Block mined: #%d", block.Index)
+func (c *Client) handleCancelMining(msg inboundMsg) {
+	id, err := c.hub.miner.Cancel(msg.JobID, c)
+	if err != nil {
+		c.sendResponse("cancel_mining_response", false, err.Error(), nil)
+		return
 	}
+	c.sendResponse("cancel_mining_response", true, "Mining job cancelled", map[string]interface{}{"job_id": id})
+	logging.Infof("[WS] Mining job cancelled: %s", id)
 }
 
 func (c *Client) handleSetDifficulty(msg inboundMsg) {
@@ -352,24 +617,32 @@ func (c *Client) handleSetDifficulty(msg inboundMsg) {
 	c.hub.bc.SetDifficulty(*msg.Difficulty)
 	newDifficulty := c.hub.bc.GetDifficulty()
 	c.sendResponse("set_difficulty_response", true, "Difficulty updated", map[string]interface{}{"difficulty": newDifficulty})
-	log.Printf("[WS] Difficulty set to: %d", newDifficulty)
+	logging.Infof("[WS] Difficulty set to: %d", newDifficulty)
 }
 
-func (c *Client) handleSearchChain(msg inboundMsg) {
-	if msg.Query == "" {
-		c.sendResponse("search_chain_response", false, "Query parameter is required", nil)
+// handleSearchChain decodes the whole message as a blockchain.SearchQuery,
+// so every filter can be given alongside "type".
+func (c *Client) handleSearchChain(data []byte) {
+	var q blockchain.SearchQuery
+	if err := json.Unmarshal(data, &q); err != nil {
+		c.sendResponse("search_chain_response", false, "Invalid search: "+err.Error(), nil)
 		return
 	}
 
-	results := c.hub.bc.SearchData(msg.Query)
-	response := outResponse{
-		Type:    "search_chain_response",
-		Success: true,
-		Message: "Search completed",
-		Results: results,
+	page, err := c.hub.bc.Search(q)
+	if err != nil {
+		c.sendResponse("search_chain_response", false, err.Error(), nil)
+		return
 	}
-	c.sendJSON(response)
-	log.Printf("[WS] Search query: %s, results: %d", msg.Query, len(results))
+	c.sendJSON(outSearchResponse{
+		Type:       "search_chain_response",
+		Success:    true,
+		Message:    "Search completed",
+		Results:    page.Results,
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+	})
+	logging.Debugf("[WS] Search query: %s, results: %d of %d", q.Text, len(page.Results), page.Total)
 }
 
 func (c *Client) handleGetPending() {
@@ -381,6 +654,79 @@ func (c *Client) handleGetPending() {
 	c.sendJSON(response)
 }
 
+func (c *Client) handleValidate() {
+	report := c.hub.bc.Validate()
+	message := "Chain is valid"
+	if !report.Valid {
+		message = fmt.Sprintf("Block #%d is invalid", report.Blocks[report.FirstInvalid].Index)
+	}
+	c.sendResponse("validate_response", true, message, report)
+}
+
 func (c *Client) handleGetChain() {
 	c.hub.sendChainTo(c)
 }
+
+// handleGetBlock looks a block up by hash, or by height if no hash is given.
+func (c *Client) handleGetBlock(msg inboundMsg) {
+	var block *blockchain.Block
+	var err error
+	switch {
+	case msg.Hash != "":
+		block, err = c.hub.bc.GetBlockByHash(msg.Hash)
+	case msg.Height != nil:
+		block, err = c.hub.bc.GetBlockByHeight(*msg.Height)
+	default:
+		c.sendResponse("get_block_response", false, "get_block needs a hash or height", nil)
+		return
+	}
+	if err != nil {
+		c.sendResponse("get_block_response", false, err.Error(), nil)
+		return
+	}
+	c.sendJSON(outResponse{Type: "get_block_response", Success: true, Message: fmt.Sprintf("Block #%d", block.Index), Block: block})
+}
+
+func (c *Client) handleGetTransaction(msg inboundMsg) {
+	if msg.TxID == "" {
+		c.sendResponse("get_transaction_response", false, "get_transaction needs a tx_id", nil)
+		return
+	}
+	tx, err := c.hub.bc.GetTransaction(msg.TxID)
+	if err != nil {
+		c.sendResponse("get_transaction_response", false, err.Error(), nil)
+		return
+	}
+	c.sendResponse("get_transaction_response", true, fmt.Sprintf("Transaction in block #%d", tx.Height), tx)
+}
+
+func (c *Client) handleGetPosts() {
+	posts := c.hub.bc.Posts()
+	c.sendResponse("get_posts_response", true, fmt.Sprintf("%d posts", len(posts)), posts)
+}
+
+func (c *Client) handleGetPost(msg inboundMsg) {
+	post, err := c.hub.bc.Post(msg.PostID)
+	if err != nil {
+		c.sendResponse("get_post_response", false, err.Error(), nil)
+		return
+	}
+	c.sendResponse("get_post_response", true, "Post "+post.ID, post)
+}
+
+// handleGCBlobs removes the stored attachments that no mined or pending
+// transaction refers to, once they are older than store.BlobGracePeriod.
+func (c *Client) handleGCBlobs() {
+	if c.hub.blobs == nil {
+		c.sendResponse("gc_blobs_response", false, "This server does not store attachments", nil)
+		return
+	}
+	stats, err := c.hub.blobs.GC(c.hub.bc.ReferencedAttachments(), store.BlobGracePeriod)
+	if err != nil {
+		logging.Errorf("[BLOBS] GC failed: %v", err)
+		c.sendResponse("gc_blobs_response", false, err.Error(), nil)
+		return
+	}
+	logging.Infof("[BLOBS] GC removed %d objects (%d bytes), kept %d", stats.Removed, stats.FreedBytes, stats.Kept)
+	c.sendResponse("gc_blobs_response", true, fmt.Sprintf("Removed %d attachment objects (%d bytes), kept %d", stats.Removed, stats.FreedBytes, stats.Kept), stats)
+}
@@ -0,0 +1,43 @@
+package blockchain
+
+import (
+	"regexp"
+	"strings"
+)
+
+// attachmentRef matches a reference to an attachment, sha256:<hex ID>.
+var attachmentRef = regexp.MustCompile(`(?i)\bsha256:([0-9a-f]{64})\b`)
+
+// AttachmentRefs returns the IDs of the attachments tx refers to. Any
+// transaction, and any field of a blog transaction, can refer to one by
+// writing sha256:<ID>, as Markdown images do.
+func AttachmentRefs(tx string) []string {
+	var ids []string
+	for _, m := range attachmentRef.FindAllStringSubmatch(tx, -1) {
+		ids = append(ids, strings.ToLower(m[1]))
+	}
+	return ids
+}
+
+// ReferencedAttachments returns the IDs of the attachments referred to by
+// mined and pending transactions: those the attachment store must keep.
+func (bc *Blockchain) ReferencedAttachments() map[string]bool {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	refs := make(map[string]bool)
+	add := func(tx string) {
+		for _, id := range AttachmentRefs(tx) {
+			refs[id] = true
+		}
+	}
+	for _, b := range bc.Chain {
+		for _, tx := range b.Transactions {
+			add(tx)
+		}
+	}
+	for _, tx := range bc.PendingTxs {
+		add(tx)
+	}
+	return refs
+}
@@ -1,15 +1,25 @@
 package blockchain
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// BlockVersion is the header format NewBlock produces and the only one
+// validation accepts. The header commits to the transactions only through
+// MerkleRoot and names the Miner, and blog transactions and notes must
+// follow the rules.
+const BlockVersion = 1
+
 type Block struct {
+	Version      int       `json:"version"`
 	Index        int       `json:"index"`
 	Timestamp    time.Time `json:"timestamp"`
 	Transactions []string  `json:"transactions"`
@@ -18,25 +28,36 @@ type Block struct {
 	Nonce        int       `json:"nonce"`
 	MerkleRoot   string    `json:"merkle_root"`
 	Difficulty   int       `json:"difficulty"`
+	Miner        string    `json:"miner,omitempty"` // who mined it, if known
+
+	// clock, if set, restamps the block while it is mined.
+	clock Clock
 }
 
-func NewBlock(index int, transactions []string, prevHash string) *Block {
+// NewBlock builds an unmined block stamped with clock's current time; a nil
+// clock means SystemClock.
+func NewBlock(clock Clock, index int, transactions []string, prevHash string) *Block {
+	clock = clockOrSystem(clock)
 	block := &Block{
+		Version:      BlockVersion,
 		Index:        index,
-		Timestamp:    time.Now(),
+		Timestamp:    clock.Now(),
 		Transactions: transactions,
 		PrevHash:     prevHash,
 		Nonce:        0,
+		clock:        clock,
 	}
 
 	block.MerkleRoot = block.calculateMerkleRoot()
 	block.Hash = block.calculateHash()
-	fmt.Printf("Block.hash is: %s", block.Hash)
+	fmt.Fprintf(output, "Block.hash is: %s", block.Hash)
 	return block
 }
 
 func (b *Block) calculateHash() string {
-	data := fmt.Sprintf("%d%s%s%d%s%s", b.Index, b.Timestamp.String(), strings.Join(b.Transactions, ""), b.Nonce, b.PrevHash, b.MerkleRoot)
+	// UnixNano rather than Timestamp.String(): the latter includes the
+	// monotonic clock reading, which does not survive a save and reload.
+	data := fmt.Sprintf("%d|%d|%d|%s|%s|%d|%d|%q", b.Version, b.Index, b.Timestamp.UnixNano(), b.PrevHash, b.MerkleRoot, b.Difficulty, b.Nonce, b.Miner)
 	hash := sha256.Sum256([]byte(data))
 	return hex.EncodeToString(hash[:])
 }
@@ -50,6 +71,18 @@ func (b *Block) calculateMerkleRoot() string {
 	return merkleTree.GetRoot()
 }
 
+// touch moves the timestamp forward to the block's clock, so a block that
+// takes a while to mine records when it was found rather than when it was
+// built. The mining loops call it every progressInterval attempts.
+func (b *Block) touch() {
+	if b.clock == nil {
+		return
+	}
+	if now := b.clock.Now(); now.After(b.Timestamp) {
+		b.Timestamp = now
+	}
+}
+
 func (b *Block) Mine(difficulty int) {
 	b.Difficulty = difficulty
 
@@ -58,13 +91,16 @@ func (b *Block) Mine(difficulty int) {
 	for {
 		b.Hash = b.calculateHash()
 		if strings.HasPrefix(b.Hash, target) {
-			fmt.Printf("Block %d mined! Nonce: %d, Diff: %d, Hash: %s\n", b.Index, b.Nonce, b.Difficulty, b.Hash)
+			fmt.Fprintf(output, "Block %d mined! Nonce: %d, Diff: %d, Hash: %s\n", b.Index, b.Nonce, b.Difficulty, b.Hash)
 			break
 		}
 		b.Nonce++
+		if b.Nonce%progressInterval == 0 {
+			b.touch()
+		}
 
 		if difficulty > 0 && b.Nonce%10000 == 0 {
-			fmt.Printf("Mining block %d... Nonce: %d, Current hash: %s (diff %d)\n", b.Index, b.Nonce, b.Hash, b.Difficulty)
+			fmt.Fprintf(output, "Mining block %d... Nonce: %d, Current hash: %s (diff %d)\n", b.Index, b.Nonce, b.Hash, b.Difficulty)
 		}
 	}
 }
@@ -78,17 +114,110 @@ func (b *Block) MineCounted(difficulty int) int64 {
 		b.Hash = b.calculateHash()
 		attempts++
 		if strings.HasPrefix(b.Hash, target) {
-			fmt.Printf("Block %d mined! Nonce: %d, Diff: %d, Hash: %s (attempts=%d)\n", b.Index, b.Nonce, b.Difficulty, b.Hash, attempts)
+			fmt.Fprintf(output, "Block %d mined! Nonce: %d, Diff: %d, Hash: %s (attempts=%d)\n", b.Index, b.Nonce, b.Difficulty, b.Hash, attempts)
 			break
 		}
 		b.Nonce++
+		if attempts%progressInterval == 0 {
+			b.touch()
+		}
 		if difficulty > 0 && b.Nonce%10000 == 0 {
-			fmt.Printf("Mining block %d... Nonce: %d, Current hash: %s (diff %d)\n", b.Index, b.Nonce, b.Hash, b.Difficulty)
+			fmt.Fprintf(output, "Mining block %d... Nonce: %d, Current hash: %s (diff %d)\n", b.Index, b.Nonce, b.Hash, b.Difficulty)
 		}
 	}
 	return attempts
 }
 
+// MineContext searches for a nonce like MineCounted but stops with ctx.Err()
+// when ctx is cancelled. progress, if non-nil, is called every
+// progressInterval attempts with the current nonce and attempt count.
+func (b *Block) MineContext(ctx context.Context, difficulty int, progress func(nonce int, attempts int64)) (int64, error) {
+	b.Difficulty = difficulty
+
+	target := strings.Repeat("0", difficulty)
+	var attempts int64
+	for {
+		b.Hash = b.calculateHash()
+		attempts++
+		if strings.HasPrefix(b.Hash, target) {
+			fmt.Fprintf(output, "Block %d mined! Nonce: %d, Diff: %d, Hash: %s (attempts=%d)\n", b.Index, b.Nonce, b.Difficulty, b.Hash, attempts)
+			return attempts, nil
+		}
+		b.Nonce++
+		if attempts%progressInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return attempts, err
+			}
+			b.touch()
+			if progress != nil {
+				progress(b.Nonce, attempts)
+			}
+		}
+	}
+}
+
+const progressInterval = 10000
+
+// MineParallel splits the nonce space across threads workers, each stepping
+// by threads from its own offset. progress is only called from worker 0 and
+// receives the total attempts across all workers.
+func (b *Block) MineParallel(parent context.Context, difficulty, threads int, progress func(nonce int, attempts int64)) (int64, error) {
+	if threads <= 1 {
+		return b.MineContext(parent, difficulty, progress)
+	}
+	b.Difficulty = difficulty
+
+	target := strings.Repeat("0", difficulty)
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var attempts atomic.Int64
+	found := make(chan Block, threads)
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			candidate := *b
+			candidate.Nonce = b.Nonce + worker
+			var n int64
+			for {
+				candidate.Hash = candidate.calculateHash()
+				n++
+				if strings.HasPrefix(candidate.Hash, target) {
+					attempts.Add(n % progressInterval)
+					found <- candidate
+					cancel()
+					return
+				}
+				candidate.Nonce += threads
+				if n%progressInterval == 0 {
+					total := attempts.Add(progressInterval)
+					if ctx.Err() != nil {
+						return
+					}
+					candidate.touch()
+					if worker == 0 && progress != nil {
+						progress(candidate.Nonce, total)
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	select {
+	case winner := <-found:
+		b.Nonce = winner.Nonce
+		b.Timestamp = winner.Timestamp
+		b.Hash = winner.Hash
+		fmt.Fprintf(output, "Block %d mined! Nonce: %d, Diff: %d, Hash: %s (attempts=%d, threads=%d)\n", b.Index, b.Nonce, b.Difficulty, b.Hash, attempts.Load(), threads)
+		return attempts.Load(), nil
+	default:
+		return attempts.Load(), parent.Err()
+	}
+}
+
 func (b *Block) IsValid(difficulty int) bool {
 	target := strings.Repeat("0", difficulty)
 	return strings.HasPrefix(b.Hash, target) && b.Hash == b.calculateHash()
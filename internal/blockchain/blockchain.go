@@ -1,36 +1,157 @@
 package blockchain
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"sync"
 	"time"
 )
 
+// output receives the chain's progress messages: new blocks, mining and
+// difficulty changes.
+var output io.Writer = os.Stdout
+
+// SetOutput sends progress messages to w instead of stdout. Call it before
+// creating or restoring a chain.
+func SetOutput(w io.Writer) {
+	output = w
+}
+
 type Blockchain struct {
-	Chain        []*Block
-	PendingTxs   []string
-	Difficulty   int
-	lastHashrate float64
-	mutex        sync.RWMutex
+	Chain      []*Block
+	PendingTxs []string
+	Difficulty int
+	// difficulties is the history of Difficulty by height, which
+	// validation holds every block to.
+	difficulties   []DifficultyChange
+	lastHashrate   float64
+	miningThreads  int
+	retarget       RetargetPolicy
+	genesisHash    string
+	index          *searchIndex
+	lookup         *lookupIndex
+	blog           *blogView
+	clock          Clock
+	maxFutureDrift time.Duration
+	version        uint64
+	reorgs         uint64
+	mutex          sync.RWMutex
+}
+
+// State is the persistent part of a Blockchain.
+type State struct {
+	Difficulty   int                `json:"difficulty"`
+	Difficulties []DifficultyChange `json:"difficulties,omitempty"`
+	Chain        []*Block           `json:"chain"`
+	Pending      []string           `json:"pending"`
+}
+
+// DifficultyChange records that blocks from Height on need at least
+// Difficulty, until the next change.
+type DifficultyChange struct {
+	Height     int `json:"height"`
+	Difficulty int `json:"difficulty"`
+}
+
+// RetargetPolicy adjusts Difficulty every Interval blocks: one step up when
+// those blocks took less than half of Interval*TargetBlockTime, one step down
+// when they took more than twice that. A zero Interval keeps it fixed.
+type RetargetPolicy struct {
+	Interval        int
+	TargetBlockTime time.Duration
+	MaxDifficulty   int
 }
 
 func NewBlockchain(difficulty int) *Blockchain {
+	return NewBlockchainWithClock(difficulty, SystemClock)
+}
+
+// NewBlockchainWithClock is NewBlockchain with the genesis block and
+// everything after it timed by clock.
+func NewBlockchainWithClock(difficulty int, clock Clock) *Blockchain {
 	bc := &Blockchain{
-		Chain:      make([]*Block, 0),
-		PendingTxs: make([]string, 0),
-		Difficulty: difficulty,
+		Chain:          make([]*Block, 0),
+		PendingTxs:     make([]string, 0),
+		clock:          clockOrSystem(clock),
+		maxFutureDrift: DefaultMaxFutureDrift,
 	}
+	bc.setDifficultyLocked(difficulty)
 
 	genesisBlock := bc.createGenesisBlock()
 	bc.Chain = append(bc.Chain, genesisBlock)
-	fmt.Println("Blockchain created with genesis block")
-	fmt.Println("Difficulty:", bc.Difficulty)
+	bc.index = newSearchIndex(bc.Chain)
+	bc.lookup = newLookupIndex(bc.Chain)
+	bc.blog = newBlogView(bc.Chain)
+	fmt.Fprintln(output, "Blockchain created with genesis block")
+	fmt.Fprintln(output, "Difficulty:", bc.Difficulty)
 	return bc
 }
 
+// Restore rebuilds a Blockchain from a saved State. The chain is not
+// validated here; call IsValid to check it. st's slices are copied, not
+// kept or modified.
+func Restore(st State) (*Blockchain, error) {
+	if len(st.Chain) == 0 {
+		return nil, errors.New("saved chain has no blocks")
+	}
+	chain := append([]*Block(nil), st.Chain...)
+	bc := &Blockchain{
+		Chain:          chain,
+		Difficulty:     st.Difficulty,
+		clock:          SystemClock,
+		maxFutureDrift: DefaultMaxFutureDrift,
+		index:          newSearchIndex(chain),
+		lookup:         newLookupIndex(chain),
+		blog:           newBlogView(chain),
+	}
+	// The chain and pending pool are saved separately, so a crash between
+	// the two can leave mined transactions pending; drop them rather than
+	// mine them again.
+	kept := make([]string, 0, len(st.Pending))
+	for _, tx := range st.Pending {
+		if len(bc.lookup.txs[TxID(tx)]) == 0 {
+			kept = append(kept, tx)
+		}
+	}
+	bc.PendingTxs = kept
+	bc.difficulties = append([]DifficultyChange(nil), st.Difficulties...)
+	if len(bc.difficulties) == 0 {
+		bc.difficulties = difficultiesFromChain(chain, st.Difficulty)
+	}
+	fmt.Fprintf(output, "Blockchain restored with %d blocks and %d pending transactions\n", len(bc.Chain), len(bc.PendingTxs))
+	return bc, nil
+}
+
+// Snapshot copies the chain, pending pool and difficulty together with the
+// version they correspond to.
+func (bc *Blockchain) Snapshot() (State, uint64) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	st := State{
+		Difficulty:   bc.Difficulty,
+		Difficulties: append([]DifficultyChange(nil), bc.difficulties...),
+		Chain:        make([]*Block, len(bc.Chain)),
+		Pending:      make([]string, len(bc.PendingTxs)),
+	}
+	copy(st.Chain, bc.Chain)
+	copy(st.Pending, bc.PendingTxs)
+	return st, bc.version
+}
+
+// Version increases whenever the chain, pending pool or difficulty changes.
+func (bc *Blockchain) Version() uint64 {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	return bc.version
+}
+
 func (bc *Blockchain) createGenesisBlock() *Block {
 	genesisTx := []string{"Genesis Transaction - Blockchain Created"}
-	block := NewBlock(0, genesisTx, "0")
+	block := NewBlock(bc.clock, 0, genesisTx, "0")
 	block.Mine(bc.Difficulty)
 	return block
 }
@@ -45,76 +166,301 @@ func (bc *Blockchain) GetLatestBlock() *Block {
 	return bc.Chain[len(bc.Chain)-1]
 }
 
-func (bc *Blockchain) AddTransaction(tx string) {
+// AddTransaction adds tx to the pending pool. Blog transactions are
+// checked against the chain and the pool first; see BlogTx.
+func (bc *Blockchain) AddTransaction(tx string) error {
 	bc.mutex.Lock()
 	defer bc.mutex.Unlock()
 
+	if err := bc.checkBlogTxLocked(tx); err != nil {
+		return err
+	}
 	bc.PendingTxs = append(bc.PendingTxs, tx)
-	fmt.Printf("Transaction added to pending pool: %s (Total pending: %d)\n", tx, len(bc.PendingTxs))
+	bc.version++
+	fmt.Fprintf(output, "Transaction added to pending pool: %s (Total pending: %d)\n", tx, len(bc.PendingTxs))
+	return nil
 }
 
 func (bc *Blockchain) MineBlock() *Block {
-	bc.mutex.Lock()
-	defer bc.mutex.Unlock()
+	newBlock := bc.NewBlockTemplate()
+	if newBlock == nil {
+		fmt.Fprintln(output, "No pending transactions to mine")
+		return nil
+	}
 
-	if len(bc.PendingTxs) == 0 {
-		fmt.Println("No pending transactions to mine")
+	fmt.Fprintf(output, "Mining new block with %d pending transactions\n", len(newBlock.Transactions))
+
+	clock := bc.Clock()
+	start := clock.Now()
+	hashes, _ := newBlock.MineParallel(context.Background(), newBlock.Difficulty, bc.MiningThreads(), nil)
+	if err := bc.SubmitBlock(newBlock, hashes, clock.Now().Sub(start)); err != nil {
+		fmt.Fprintf(output, "Mined block %d rejected: %v\n", newBlock.Index, err)
 		return nil
 	}
 
-	fmt.Printf("Mining new block with %d pending transactions\n", len(bc.PendingTxs))
+	return newBlock
+}
+
+// NewBlockTemplate snapshots the pending pool, tip and difficulty into an
+// unmined block. The caller mines it without holding the chain lock and
+// hands it back through SubmitBlock. It returns nil when nothing is pending.
+func (bc *Blockchain) NewBlockTemplate() *Block {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	if len(bc.PendingTxs) == 0 || len(bc.Chain) == 0 {
+		return nil
+	}
 
-	var latestBlock *Block
-	if len(bc.Chain) > 0 {
-		latestBlock = bc.Chain[len(bc.Chain)-1]
-	} else {
-		fmt.Println("No blocks in chain for mining")
+	// A block may not repeat a transaction; repeats stay pending for the
+	// next one.
+	txs := make([]string, 0, len(bc.PendingTxs))
+	seen := make(map[string]bool, len(bc.PendingTxs))
+	for _, tx := range bc.PendingTxs {
+		if !seen[tx] {
+			seen[tx] = true
+			txs = append(txs, tx)
+		}
+	}
+	// Blog transactions pending since before a reorg, or behind a delete
+	// of their post, may no longer apply; they are left out.
+	if valid := bc.blog.overlay().addPending(txs); len(valid) < len(txs) {
+		fmt.Fprintf(output, "Leaving out %d blog transactions that no longer apply\n", len(txs)-len(valid))
+		txs = valid
+	}
+	if len(txs) == 0 {
 		return nil
 	}
 
-	newBlock := NewBlock(latestBlock.Index+1, bc.PendingTxs, latestBlock.Hash)
-	start := nowUnixNano()
-	hashes := newBlock.MineCounted(bc.Difficulty)
-	dur := float64(nowUnixNano()-start) / 1e9
-	if dur > 0 {
-		bc.lastHashrate = float64(hashes) / dur
+	latestBlock := bc.Chain[len(bc.Chain)-1]
+	block := NewBlock(bc.clock, latestBlock.Index+1, txs, latestBlock.Hash)
+	block.Difficulty = bc.Difficulty
+	// A clock running behind the chain would produce a block the time
+	// rules reject; stamp it just after the median time past instead.
+	if mtp := medianTimePast(bc.Chain); !block.Timestamp.After(mtp) {
+		block.Timestamp = mtp.Add(time.Nanosecond)
+		block.Hash = block.calculateHash()
 	}
+	return block
+}
 
-	bc.Chain = append(bc.Chain, newBlock)
-	bc.PendingTxs = []string{}
-	fmt.Printf("Block %d added to chain. Pending transactions cleared.\n", newBlock.Index)
+// SubmitBlock appends a block mined from a template. The block must extend
+// the current tip and satisfy its own difficulty, which may not be below
+// the chain's at its height; its transactions are removed from the pending
+// pool. attempts and dur feed LastHashrate.
+func (bc *Blockchain) SubmitBlock(b *Block, attempts int64, dur time.Duration) error {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
 
-	return newBlock
+	latestBlock := bc.Chain[len(bc.Chain)-1]
+	if b.PrevHash != latestBlock.Hash || b.Index != latestBlock.Index+1 {
+		return ErrStaleBlock
+	}
+	if !b.IsValid(b.Difficulty) {
+		return ErrInvalidBlock
+	}
+	if want, ok := expectedDifficulty(bc.difficulties, len(bc.Chain)); ok && b.Difficulty < want {
+		return fmt.Errorf("%w: mined at %d, the chain requires %d", ErrLowDifficulty, b.Difficulty, want)
+	}
+	if issues := checkTimestamp(b, bc.Chain, bc.rulesLocked()); len(issues) > 0 {
+		return fmt.Errorf("%w: %s", ErrBadTimestamp, issues[0].Message)
+	}
+
+	if secs := dur.Seconds(); secs > 0 {
+		bc.lastHashrate = float64(attempts) / secs
+	}
+
+	bc.Chain = append(bc.Chain, b)
+	bc.index.add(b)
+	bc.lookup.add(len(bc.Chain)-1, b)
+	bc.blog.add(len(bc.Chain)-1, b)
+	bc.PendingTxs = removeTransactions(bc.PendingTxs, b.Transactions)
+	bc.version++
+	fmt.Fprintf(output, "Block %d added to chain. %d pending transactions remain.\n", b.Index, len(bc.PendingTxs))
+	bc.retargetLocked()
+
+	return nil
 }
 
-func (bc *Blockchain) IsValid() bool {
+func (bc *Blockchain) retargetLocked() {
+	p := bc.retarget
+	if p.Interval <= 0 || p.TargetBlockTime <= 0 || len(bc.Chain) <= p.Interval {
+		return
+	}
+	tip := bc.Chain[len(bc.Chain)-1]
+	if tip.Index%p.Interval != 0 {
+		return
+	}
+
+	// A tip stamped ahead of the clock, within the allowed drift, must not
+	// make the interval look slower than it has been so far.
+	end := tip.Timestamp
+	if now := bc.clock.Now(); end.After(now) {
+		end = now
+	}
+	first := bc.Chain[len(bc.Chain)-1-p.Interval]
+	actual := end.Sub(first.Timestamp)
+	expected := p.TargetBlockTime * time.Duration(p.Interval)
+
+	old := bc.Difficulty
+	switch {
+	case actual < expected/2 && (p.MaxDifficulty <= 0 || old < p.MaxDifficulty):
+		bc.setDifficultyLocked(old + 1)
+	case actual > expected*2 && old > 0:
+		bc.setDifficultyLocked(old - 1)
+	}
+	if bc.Difficulty != old {
+		fmt.Fprintf(output, "[DIFFICULTY] Retargeted from %d to %d (last %d blocks took %v, target %v)\n", old, bc.Difficulty, p.Interval, actual, expected)
+	}
+}
+
+func (bc *Blockchain) SetRetargetPolicy(p RetargetPolicy) {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+	bc.retarget = p
+}
+
+// SetClock replaces the clock used for new blocks, mining, retargeting and
+// the future drift check.
+func (bc *Blockchain) SetClock(c Clock) {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+	bc.clock = clockOrSystem(c)
+}
+
+func (bc *Blockchain) Clock() Clock {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
+	return bc.clock
+}
 
-	for i := 1; i < len(bc.Chain); i++ {
-		currentBlock := bc.Chain[i]
-		prevBlock := bc.Chain[i-1]
+// SetMaxFutureDrift sets how far ahead of the clock a block may be stamped;
+// 0 disables the check.
+func (bc *Blockchain) SetMaxFutureDrift(d time.Duration) {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+	bc.maxFutureDrift = d
+}
 
-		if currentBlock.Hash != currentBlock.calculateHash() {
-			return false
-		}
+func (bc *Blockchain) SetMiningThreads(n int) {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+	bc.miningThreads = n
+}
 
-		if currentBlock.PrevHash != prevBlock.Hash {
-			return false
-		}
+func (bc *Blockchain) MiningThreads() int {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	if bc.miningThreads < 1 {
+		return 1
+	}
+	return bc.miningThreads
+}
+
+var (
+	ErrStaleBlock   = errors.New("block does not extend the current tip")
+	ErrInvalidBlock = errors.New("block hash does not satisfy its difficulty")
+	ErrBadTimestamp = errors.New("block timestamp breaks the time rules")
+	// ErrLowDifficulty is returned for a block mined below the difficulty
+	// in force, e.g. one that was being mined when the difficulty rose.
+	ErrLowDifficulty = errors.New("block difficulty is below the chain's")
+)
 
-		diff := currentBlock.Difficulty
-		if diff == 0 && currentBlock.Index == 0 {
-			diff = bc.Difficulty
-		} else if diff == 0 {
-			diff = bc.Difficulty
+// removeTransactions drops one occurrence of each mined transaction from
+// pending, keeping anything that arrived while the block was being mined.
+func removeTransactions(pending, mined []string) []string {
+	counts := make(map[string]int, len(mined))
+	for _, tx := range mined {
+		counts[tx]++
+	}
+	remaining := make([]string, 0, len(pending))
+	for _, tx := range pending {
+		if counts[tx] > 0 {
+			counts[tx]--
+			continue
 		}
-		if !currentBlock.IsValid(diff) {
-			return false
+		remaining = append(remaining, tx)
+	}
+	return remaining
+}
+
+// IsValid reports whether every block passes Validate.
+func (bc *Blockchain) IsValid() bool {
+	return bc.Validate().Valid
+}
+
+var (
+	ErrChainNotLonger  = errors.New("candidate chain is not longer than the current chain")
+	ErrGenesisMismatch = errors.New("candidate chain has a different genesis block")
+	ErrInvalidChain    = errors.New("candidate chain failed validation")
+)
+
+// ReplaceChain adopts candidate if it is longer than the current chain,
+// starts from the same genesis block and is valid. Transactions from blocks
+// that drop off the old branch and are not in the new one go back to the
+// pending pool; switching branches counts as a reorg. Blocks past the fork
+// are held to the difficulty in force there, and the difficulty history
+// after it is taken from the blocks adopted.
+func (bc *Blockchain) ReplaceChain(candidate []*Block) error {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	if len(candidate) <= len(bc.Chain) {
+		return ErrChainNotLonger
+	}
+	if candidate[0].Hash != bc.Chain[0].Hash {
+		return ErrGenesisMismatch
+	}
+	fork := 0
+	for fork < len(bc.Chain) && bc.Chain[fork].Hash == candidate[fork].Hash {
+		fork++
+	}
+	history := difficultiesUpTo(bc.difficulties, fork)
+	rules := bc.rulesLocked()
+	rules.genesisHash = bc.Chain[0].Hash
+	rules.difficulties = history
+	if !validateChain(candidate, rules).Valid {
+		return ErrInvalidChain
+	}
+
+	var orphaned, adopted []string
+	for _, b := range bc.Chain[fork:] {
+		orphaned = append(orphaned, b.Transactions...)
+	}
+	for _, b := range candidate[fork:] {
+		adopted = append(adopted, b.Transactions...)
+	}
+	pending := append(removeTransactions(orphaned, adopted), bc.PendingTxs...)
+
+	if fork < len(bc.Chain) {
+		bc.reorgs++
+		fmt.Fprintf(output, "[REORG] Switched branches at block %d, %d blocks orphaned\n", fork, len(bc.Chain)-fork)
+	}
+	bc.index.truncate(fork, bc.Chain[fork:])
+	bc.lookup.truncate(fork, bc.Chain[fork:])
+	for i, b := range candidate[fork:] {
+		bc.index.add(b)
+		bc.lookup.add(fork+i, b)
+	}
+	bc.Chain = append(make([]*Block, 0, len(candidate)), candidate...)
+	bc.blog = newBlogView(bc.Chain)
+	bc.PendingTxs = removeTransactions(pending, adopted)
+	for i, b := range candidate[fork:] {
+		if d, _ := expectedDifficulty(history, fork+i); b.Difficulty != d {
+			history = append(history, DifficultyChange{Height: fork + i, Difficulty: b.Difficulty})
 		}
 	}
+	bc.difficulties = history
+	bc.setDifficultyLocked(bc.Difficulty)
+	bc.version++
+	return nil
+}
 
-	return true
+// ReorgCount is the number of times ReplaceChain switched branches.
+func (bc *Blockchain) ReorgCount() uint64 {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	return bc.reorgs
 }
 
 func (bc *Blockchain) GetChain() []*Block {
@@ -132,8 +478,87 @@ func (bc *Blockchain) SetDifficulty(d int) {
 	if d < 0 {
 		d = 0
 	}
+	if max := bc.retarget.MaxDifficulty; max > 0 && d > max {
+		d = max
+	}
+	bc.setDifficultyLocked(d)
+	bc.version++
+	fmt.Fprintf(output, "[DIFFICULTY] Chain difficulty set to %d\n", d)
+}
+
+// setDifficultyLocked makes d the difficulty of the next block and records
+// it in the history.
+func (bc *Blockchain) setDifficultyLocked(d int) {
 	bc.Difficulty = d
-	fmt.Printf("[DIFFICULTY] Chain difficulty set to %d\n", d)
+	height := len(bc.Chain)
+	if n := len(bc.difficulties); n > 0 && bc.difficulties[n-1].Height == height {
+		bc.difficulties = bc.difficulties[:n-1]
+	}
+	if n := len(bc.difficulties); n > 0 && bc.difficulties[n-1].Difficulty == d {
+		return
+	}
+	bc.difficulties = append(bc.difficulties, DifficultyChange{Height: height, Difficulty: d})
+}
+
+// difficultiesFromChain rebuilds the history of a chain saved before it
+// was kept, taking each block's difficulty as it was recorded and current
+// for the next block.
+func difficultiesFromChain(chain []*Block, current int) []DifficultyChange {
+	var history []DifficultyChange
+	add := func(height, d int) {
+		if n := len(history); n == 0 || history[n-1].Difficulty != d {
+			history = append(history, DifficultyChange{Height: height, Difficulty: d})
+		}
+	}
+	for i, b := range chain {
+		add(i, b.Difficulty)
+	}
+	add(len(chain), current)
+	return history
+}
+
+// difficultiesUpTo returns a copy of the changes in history that take
+// effect at or before height.
+func difficultiesUpTo(history []DifficultyChange, height int) []DifficultyChange {
+	var kept []DifficultyChange
+	for _, c := range history {
+		if c.Height > height {
+			break
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// expectedDifficulty returns the least difficulty history requires of the
+// block at height; ok is false if the history does not cover it.
+func expectedDifficulty(history []DifficultyChange, height int) (d int, ok bool) {
+	for _, c := range history {
+		if c.Height > height {
+			break
+		}
+		d, ok = c.Difficulty, true
+	}
+	return d, ok
+}
+
+// SetGenesisHash pins the hash the first block must have; Validate and
+// ReplaceChain reject chains that start elsewhere. Empty accepts any
+// genesis block.
+func (bc *Blockchain) SetGenesisHash(h string) {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+	bc.genesisHash = h
+}
+
+// GenesisHash returns the hash of the first block.
+func (bc *Blockchain) GenesisHash() string {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	if len(bc.Chain) == 0 {
+		return ""
+	}
+	return bc.Chain[0].Hash
 }
 
 func (bc *Blockchain) GetDifficulty() int {
@@ -148,8 +573,6 @@ func (bc *Blockchain) LastHashrate() float64 {
 	return bc.lastHashrate
 }
 
-func nowUnixNano() int64 { return time.Now().UnixNano() }
-
 func (bc *Blockchain) GetPendingTransactions() []string {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
@@ -158,50 +581,3 @@ func (bc *Blockchain) GetPendingTransactions() []string {
 	copy(pending, bc.PendingTxs)
 	return pending
 }
-
-func (bc *Blockchain) SearchData(query string) []*Block {
-	bc.mutex.RLock()
-	defer bc.mutex.RUnlock()
-
-	var results []*Block
-	for _, block := range bc.Chain {
-		for _, tx := range block.Transactions {
-			if containsString(tx, query) {
-				results = append(results, block)
-				break
-			}
-		}
-	}
-	return results
-}
-
-func containsString(str, substr string) bool {
-	return len(str) >= len(substr) && (str == substr || containsIgnoreCase(str, substr))
-}
-
-func containsIgnoreCase(str, substr string) bool {
-	str = toLower(str)
-	substr = toLower(substr)
-	return len(str) >= len(substr) && findSubstring(str, substr)
-}
-
-func toLower(s string) string {
-	result := make([]byte, len(s))
-	for i, c := range s {
-		if c >= 'A' && c <= 'Z' {
-			result[i] = byte(c + 32)
-		} else {
-			result[i] = byte(c)
-		}
-	}
-	return string(result)
-}
-
-func findSubstring(str, substr string) bool {
-	for i := 0; i <= len(str)-len(substr); i++ {
-		if str[i:i+len(substr)] == substr {
-			return true
-		}
-	}
-	return false
-}
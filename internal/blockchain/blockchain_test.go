@@ -0,0 +1,168 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+// fork returns a chain that shares bc's first n blocks and then mines txs,
+// one block each.
+func fork(t *testing.T, bc *Blockchain, n int, txs ...string) []*Block {
+	t.Helper()
+	st, _ := bc.Snapshot()
+	other, err := Restore(State{Difficulty: st.Difficulty, Chain: st.Chain[:n]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range txs {
+		mineTx(t, other, tx)
+	}
+	return other.GetChain()
+}
+
+func TestReplaceChainReorg(t *testing.T) {
+	bc := NewBlockchain(1)
+	mineTx(t, bc, "shared")
+	orphan := mineTx(t, bc, "orphaned apple")
+	mineTx(t, bc, "kept banana")
+	if err := bc.AddTransaction("waiting"); err != nil {
+		t.Fatal(err)
+	}
+
+	candidate := fork(t, bc, 2, "kept banana", "new cherry", "new damson")
+	if err := bc.ReplaceChain(candidate); err != nil {
+		t.Fatalf("ReplaceChain: %v", err)
+	}
+	if bc.ReorgCount() != 1 {
+		t.Errorf("ReorgCount = %d, want 1", bc.ReorgCount())
+	}
+	if !bc.IsValid() {
+		t.Error("chain is invalid after the reorg")
+	}
+
+	pending := bc.GetPendingTransactions()
+	if len(pending) != 2 || pending[0] != "orphaned apple" || pending[1] != "waiting" {
+		t.Errorf("pending = %q, want the orphaned transaction and the one waiting", pending)
+	}
+
+	// The lookup index forgets the orphaned block and moves the
+	// transaction both branches mined.
+	if _, err := bc.GetBlockByHash(orphan.Hash); !errors.Is(err, ErrNotFound) {
+		t.Errorf("orphaned block: %v, want ErrNotFound", err)
+	}
+	if _, err := bc.GetTransaction(TxID("orphaned apple")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("orphaned transaction: %v, want ErrNotFound", err)
+	}
+	if rec, err := bc.GetTransaction(TxID("kept banana")); err != nil || rec.Height != 2 || rec.BlockHash != candidate[2].Hash {
+		t.Errorf("kept transaction: %+v, %v; want it in block 2 of the new branch", rec, err)
+	}
+	if b, err := bc.GetBlockByHash(candidate[4].Hash); err != nil || b.Index != 4 {
+		t.Errorf("new tip: %v, %v", b, err)
+	}
+
+	// So does the search index.
+	for query, want := range map[string]int{"apple": 0, "banana": 1, "cherry": 1, "damson": 1} {
+		results, err := bc.SearchData(query, SearchText)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != want {
+			t.Errorf("search %q: %d results, want %d", query, len(results), want)
+		}
+		for _, r := range results {
+			if r.BlockHash != candidate[r.Height].Hash {
+				t.Errorf("search %q: result in block %s, not on the new branch", query, r.BlockHash)
+			}
+		}
+	}
+
+	// Extending the current branch is not a reorg.
+	if err := bc.ReplaceChain(fork(t, bc, 5, "more")); err != nil {
+		t.Fatal(err)
+	}
+	if bc.ReorgCount() != 1 {
+		t.Errorf("ReorgCount = %d after an extension, want 1", bc.ReorgCount())
+	}
+}
+
+func TestReplaceChainRejects(t *testing.T) {
+	bc := NewBlockchain(1)
+	mineTx(t, bc, "a")
+	mineTx(t, bc, "b")
+
+	if err := bc.ReplaceChain(fork(t, bc, 1, "c")); !errors.Is(err, ErrChainNotLonger) {
+		t.Errorf("shorter chain: %v, want ErrChainNotLonger", err)
+	}
+
+	elsewhere := NewBlockchain(1)
+	for _, tx := range []string{"c", "d", "e"} {
+		mineTx(t, elsewhere, tx)
+	}
+	if err := bc.ReplaceChain(elsewhere.GetChain()); !errors.Is(err, ErrGenesisMismatch) {
+		t.Errorf("other genesis: %v, want ErrGenesisMismatch", err)
+	}
+
+	tampered := fork(t, bc, 1, "c", "d", "e")
+	tampered[2].Transactions = []string{"forged"}
+	if err := bc.ReplaceChain(tampered); !errors.Is(err, ErrInvalidChain) {
+		t.Errorf("tampered chain: %v, want ErrInvalidChain", err)
+	}
+
+	// Blocks past the fork must meet the difficulty in force there.
+	bc.SetDifficulty(3)
+	tip := bc.GetLatestBlock()
+	b1 := NewBlock(bc.Clock(), tip.Index+1, []string{"cheap"}, tip.Hash)
+	b1.Mine(1)
+	b2 := NewBlock(bc.Clock(), b1.Index+1, []string{"cheaper"}, b1.Hash)
+	b2.Mine(1)
+	cheap := append(bc.GetChain(), b1, b2)
+	if err := bc.ReplaceChain(cheap); !errors.Is(err, ErrInvalidChain) {
+		t.Errorf("chain below the difficulty at the fork: %v, want ErrInvalidChain", err)
+	}
+	if bc.ReorgCount() != 0 || len(bc.GetChain()) != 3 {
+		t.Errorf("rejected chains changed the chain: %d reorgs, %d blocks", bc.ReorgCount(), len(bc.GetChain()))
+	}
+}
+
+// A difficulty raised on the branch being dropped does not bind the new
+// one.
+func TestReplaceChainTakesDifficultyFromNewBranch(t *testing.T) {
+	bc := NewBlockchain(1)
+	mineTx(t, bc, "a")
+	candidate := fork(t, bc, 2, "c", "d", "e")
+	mineTx(t, bc, "b")
+	bc.SetDifficulty(2)
+
+	if err := bc.ReplaceChain(candidate); err != nil {
+		t.Fatalf("ReplaceChain: %v", err)
+	}
+	if report := bc.Validate(); !report.Valid {
+		t.Fatalf("chain invalid after the reorg from block %d", report.FirstInvalid)
+	}
+	if d := bc.GetDifficulty(); d != 2 {
+		t.Errorf("difficulty = %d, want the node's 2 for the next block", d)
+	}
+}
+
+func TestRestoreDoesNotModifyState(t *testing.T) {
+	bc := NewBlockchain(1)
+	mineTx(t, bc, "mined")
+	st, _ := bc.Snapshot()
+	st.Pending = []string{"mined", "waiting"}
+	st.Chain = append(make([]*Block, 0, len(st.Chain)+1), st.Chain...)
+
+	restored, err := Restore(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := restored.GetPendingTransactions(); len(pending) != 1 || pending[0] != "waiting" {
+		t.Errorf("pending = %q, want only the transaction not yet mined", pending)
+	}
+	if st.Pending[0] != "mined" || st.Pending[1] != "waiting" {
+		t.Errorf("caller's pending pool became %q", st.Pending)
+	}
+	mineTx(t, restored, "next")
+	if spare := st.Chain[:cap(st.Chain)]; spare[len(spare)-1] != nil {
+		t.Error("mining after Restore wrote into the caller's chain")
+	}
+}
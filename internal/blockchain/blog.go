@@ -0,0 +1,157 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Blog transaction types. A transaction whose JSON "type" is one of these
+// must be a valid, signed BlogTx; anything else stays an opaque payload.
+const (
+	TxPost    = "post"
+	TxEdit    = "edit"
+	TxDelete  = "delete"
+	TxComment = "comment"
+	// TxNote is a signed message that belongs to no post, as add-tx
+	// sends with a wallet account.
+	TxNote = "note"
+)
+
+// Content types a post or edit may declare.
+const (
+	ContentPlain    = "text/plain"
+	ContentMarkdown = "text/markdown"
+)
+
+const (
+	MaxTitleLength = 200
+	MaxTags        = 10
+	MaxTagLength   = 32
+)
+
+var ErrInvalidBlogTx = errors.New("invalid blog transaction")
+
+// BlogTx is a blog transaction. Author is the hex ed25519 public key that
+// produced Sig over the transaction's JSON encoding without Sig. Post is
+// the ID (TxID) of the post an edit, delete or comment refers to; a post's
+// own ID is the TxID of its transaction. Time, the Unix time it was
+// signed, keeps two otherwise identical transactions apart.
+type BlogTx struct {
+	Type        string   `json:"type"`
+	Author      string   `json:"author"`
+	Post        string   `json:"post,omitempty"`
+	Title       string   `json:"title,omitempty"`
+	Body        string   `json:"body,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	ContentType string   `json:"content_type,omitempty"`
+	Time        int64    `json:"time"`
+	Sig         string   `json:"sig,omitempty"`
+}
+
+func isBlogType(t string) bool {
+	switch t {
+	case TxPost, TxEdit, TxDelete, TxComment, TxNote:
+		return true
+	}
+	return false
+}
+
+// ParseBlogTx decodes tx if it is a blog transaction; ok is false for any
+// other payload. A blog transaction that does not decode, is malformed or
+// badly signed, or is not exactly its Encode form returns an error
+// wrapping ErrInvalidBlogTx.
+func ParseBlogTx(tx string) (t BlogTx, ok bool, err error) {
+	if !isBlogType(txType(tx)) {
+		return t, false, nil
+	}
+	if err := json.Unmarshal([]byte(tx), &t); err != nil {
+		return t, true, fmt.Errorf("%w: %v", ErrInvalidBlogTx, err)
+	}
+	if err := t.check(); err != nil {
+		return t, true, err
+	}
+	// The signature covers the re-encoded fields, not the text, so any
+	// other spelling of the same transaction would get a new TxID and
+	// slip past the replay check.
+	if tx != t.Encode() {
+		return t, true, fmt.Errorf("%w: not in canonical form", ErrInvalidBlogTx)
+	}
+	return t, true, nil
+}
+
+// Sign fills in Author and Time and signs t with key.
+func (t *BlogTx) Sign(key ed25519.PrivateKey) {
+	t.Author = hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	if t.Time == 0 {
+		t.Time = time.Now().Unix()
+	}
+	t.Sig = hex.EncodeToString(ed25519.Sign(key, t.signedBytes()))
+}
+
+// Encode returns t as transaction text.
+func (t BlogTx) Encode() string {
+	data, _ := json.Marshal(t)
+	return string(data)
+}
+
+func (t BlogTx) signedBytes() []byte {
+	t.Sig = ""
+	data, _ := json.Marshal(t)
+	return data
+}
+
+// check applies the rules that need nothing but the transaction itself.
+func (t BlogTx) check() error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidBlogTx, fmt.Sprintf(format, args...))
+	}
+	pub, err := hex.DecodeString(t.Author)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return invalid("author must be a hex ed25519 public key")
+	}
+	sig, err := hex.DecodeString(t.Sig)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(pub), t.signedBytes(), sig) {
+		return invalid("bad signature")
+	}
+
+	if t.Type == TxPost || t.Type == TxNote {
+		if t.Post != "" {
+			return invalid("a %s cannot refer to a post", t.Type)
+		}
+	} else if len(t.Post) != 64 || strings.Trim(t.Post, "0123456789abcdef") != "" {
+		return invalid("%s must refer to a post ID", t.Type)
+	}
+
+	switch t.Type {
+	case TxPost, TxEdit:
+		if t.Title == "" && t.Body == "" {
+			return invalid("%s needs a title or body", t.Type)
+		}
+		switch t.ContentType {
+		case "", ContentPlain, ContentMarkdown:
+		default:
+			return invalid("content type %q is not supported", t.ContentType)
+		}
+	case TxComment, TxNote:
+		if t.Body == "" {
+			return invalid("%s needs a body", t.Type)
+		}
+	}
+	if len(t.Title) > MaxTitleLength {
+		return invalid("title is longer than %d bytes", MaxTitleLength)
+	}
+	if len(t.Tags) > MaxTags {
+		return invalid("more than %d tags", MaxTags)
+	}
+	for _, tag := range t.Tags {
+		if tag == "" || len(tag) > MaxTagLength {
+			return invalid("tags must be 1 to %d bytes", MaxTagLength)
+		}
+	}
+	return nil
+}
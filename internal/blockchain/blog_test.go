@@ -0,0 +1,169 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBlogRules(t *testing.T) {
+	alice, bob := testKey(1), testKey(2)
+	bc := NewBlockchain(1)
+	post := signed(BlogTx{Type: TxPost, Title: "Hello", Body: "First"}, alice).Encode()
+	mineTx(t, bc, post)
+	id := TxID(post)
+
+	tests := []struct {
+		name string
+		tx   BlogTx
+		key  ed25519.PrivateKey
+		ok   bool
+	}{
+		{"edit by the author", BlogTx{Type: TxEdit, Post: id, Body: "Second"}, alice, true},
+		{"edit by someone else", BlogTx{Type: TxEdit, Post: id, Body: "Mine now"}, bob, false},
+		{"delete by someone else", BlogTx{Type: TxDelete, Post: id}, bob, false},
+		{"comment by anyone", BlogTx{Type: TxComment, Post: id, Body: "Nice"}, bob, true},
+		{"comment on a missing post", BlogTx{Type: TxComment, Post: TxID("nothing"), Body: "?"}, bob, false},
+		{"note", BlogTx{Type: TxNote, Body: "signed"}, bob, true},
+		{"note referring to a post", BlogTx{Type: TxNote, Post: id, Body: "signed"}, bob, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.tx.Time = int64(1760000000 + i)
+			tt.tx.Sign(tt.key)
+			err := bc.AddTransaction(tt.tx.Encode())
+			if tt.ok && err != nil {
+				t.Fatalf("AddTransaction: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidBlogTx) {
+				t.Fatalf("AddTransaction = %v, want ErrInvalidBlogTx", err)
+			}
+		})
+	}
+}
+
+func TestBlogDeletedPostTakesNoChanges(t *testing.T) {
+	alice := testKey(1)
+	bc := NewBlockchain(1)
+	post := signed(BlogTx{Type: TxPost, Title: "Short lived"}, alice).Encode()
+	mineTx(t, bc, post)
+	mineTx(t, bc, signed(BlogTx{Type: TxDelete, Post: TxID(post)}, alice).Encode())
+
+	edit := signed(BlogTx{Type: TxEdit, Post: TxID(post), Title: "Back"}, alice).Encode()
+	if err := bc.AddTransaction(edit); !errors.Is(err, ErrInvalidBlogTx) {
+		t.Fatalf("edit of a deleted post: %v, want ErrInvalidBlogTx", err)
+	}
+	p, err := bc.Post(TxID(post))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Deleted || len(p.Revisions) != 2 {
+		t.Fatalf("post = %+v, want deleted with 2 revisions", p)
+	}
+}
+
+func TestBlogTxCannotBeReplayed(t *testing.T) {
+	alice, bob := testKey(1), testKey(2)
+	bc := NewBlockchain(1)
+	post := signed(BlogTx{Type: TxPost, Title: "v1"}, alice).Encode()
+	mineTx(t, bc, post)
+	id := TxID(post)
+
+	edit := signed(BlogTx{Type: TxEdit, Post: id, Title: "v2"}, alice).Encode()
+	if err := bc.AddTransaction(edit); err != nil {
+		t.Fatal(err)
+	}
+	// A second copy while the first is pending.
+	if err := bc.AddTransaction(edit); !errors.Is(err, ErrInvalidBlogTx) {
+		t.Fatalf("pending replay: %v, want ErrInvalidBlogTx", err)
+	}
+	bc.MineBlock()
+	mineTx(t, bc, signed(BlogTx{Type: TxEdit, Post: id, Title: "v3"}, alice).Encode())
+
+	// Replaying the v2 edit would revert the post.
+	for _, tx := range []string{edit, post} {
+		if err := bc.AddTransaction(tx); !errors.Is(err, ErrInvalidBlogTx) {
+			t.Fatalf("replay of a mined transaction: %v, want ErrInvalidBlogTx", err)
+		}
+	}
+	comment := signed(BlogTx{Type: TxComment, Post: id, Body: "+1"}, bob).Encode()
+	mineTx(t, bc, comment)
+	if err := bc.AddTransaction(comment); !errors.Is(err, ErrInvalidBlogTx) {
+		t.Fatalf("comment replay: %v, want ErrInvalidBlogTx", err)
+	}
+
+	// Respelling the edit gives it a new TxID but the same signed fields.
+	for _, respelled := range []string{" " + edit, edit + "\n", strings.Replace(edit, ",", ", ", 1)} {
+		if err := bc.AddTransaction(respelled); !errors.Is(err, ErrInvalidBlogTx) {
+			t.Fatalf("respelled replay %q: %v, want ErrInvalidBlogTx", respelled, err)
+		}
+	}
+
+	// A block that carries the replay anyway is invalid.
+	forged := forgeBlock(bc, 1, edit)
+	bc.Chain = append(bc.Chain, forged)
+	report := bc.Validate()
+	if report.Valid || !hasIssue(report.Blocks[forged.Index], IssueBadBlogTx) {
+		t.Fatalf("block replaying an edit: issues %+v, want %s", report.Blocks[forged.Index].Issues, IssueBadBlogTx)
+	}
+
+	p, _ := bc.Post(id)
+	if p.Title != "v3" {
+		t.Fatalf("title = %q, want v3", p.Title)
+	}
+}
+
+func TestParseBlogTx(t *testing.T) {
+	key := testKey(1)
+	post := signed(BlogTx{Type: TxPost, Title: "Hello", Tags: []string{"go"}}, key)
+	id := TxID(post.Encode())
+	withSig := func(tx BlogTx) string { return signed(tx, key).Encode() }
+	tampered := post
+	tampered.Body = "added"
+	reordered := `{"author":"` + post.Author + `","type":"post","title":"Hello","tags":["go"],"time":` + strconv.FormatInt(post.Time, 10) + `,"sig":"` + post.Sig + `"}`
+
+	tests := []struct {
+		name    string
+		tx      string
+		ok      bool
+		invalid bool
+	}{
+		{"plain text", "hello", false, false},
+		{"other json", `{"type":"notarize","root":"ab"}`, false, false},
+		{"signed post", post.Encode(), true, false},
+		{"signed edit", withSig(BlogTx{Type: TxEdit, Post: id, Body: "x"}), true, false},
+		{"signed delete", withSig(BlogTx{Type: TxDelete, Post: id}), true, false},
+		{"signed note", withSig(BlogTx{Type: TxNote, Body: "x"}), true, false},
+		{"tampered post", tampered.Encode(), true, true},
+		{"signed post with extra whitespace", post.Encode() + " ", true, true},
+		{"signed post with fields reordered", reordered, true, true},
+		{"unsigned post", `{"type":"post","author":"` + post.Author + `","title":"x","time":1}`, true, true},
+		{"author is not a key", `{"type":"post","author":"bob","title":"x","time":1,"sig":"00"}`, true, true},
+		{"fields of the wrong type", `{"type":"post","time":"soon"}`, true, true},
+		{"empty post", withSig(BlogTx{Type: TxPost}), true, true},
+		{"post referring to a post", withSig(BlogTx{Type: TxPost, Post: id, Title: "x"}), true, true},
+		{"edit without a post", withSig(BlogTx{Type: TxEdit, Body: "x"}), true, true},
+		{"edit of a short post ID", withSig(BlogTx{Type: TxEdit, Post: "abc", Body: "x"}), true, true},
+		{"comment without a body", withSig(BlogTx{Type: TxComment, Post: id}), true, true},
+		{"note without a body", withSig(BlogTx{Type: TxNote}), true, true},
+		{"unknown content type", withSig(BlogTx{Type: TxPost, Title: "x", ContentType: "text/html"}), true, true},
+		{"long title", withSig(BlogTx{Type: TxPost, Title: strings.Repeat("x", MaxTitleLength+1)}), true, true},
+		{"too many tags", withSig(BlogTx{Type: TxPost, Title: "x", Tags: make([]string, MaxTags+1)}), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok, err := ParseBlogTx(tt.tx)
+			if ok != tt.ok {
+				t.Errorf("ok = %t, want %t", ok, tt.ok)
+			}
+			if tt.invalid && !errors.Is(err, ErrInvalidBlogTx) {
+				t.Errorf("err = %v, want ErrInvalidBlogTx", err)
+			}
+			if !tt.invalid && err != nil {
+				t.Errorf("err = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package blockchain
+
+import (
+	"fmt"
+	"time"
+)
+
+// Post is the current state of a blog post, rebuilt from the chain. Its
+// title, body, tags and content type are those of the latest revision; a
+// deleted post keeps its history but has them cleared.
+type Post struct {
+	ID          string     `json:"id"`
+	Author      string     `json:"author"`
+	Title       string     `json:"title"`
+	Body        string     `json:"body"`
+	Tags        []string   `json:"tags,omitempty"`
+	ContentType string     `json:"content_type"`
+	Height      int        `json:"height"`
+	Created     time.Time  `json:"created"`
+	Updated     time.Time  `json:"updated"`
+	Deleted     bool       `json:"deleted,omitempty"`
+	Revisions   []Revision `json:"revisions"`
+	Comments    []Comment  `json:"comments,omitempty"`
+}
+
+// Revision is one post, edit or delete transaction in a post's history.
+type Revision struct {
+	TxID        string    `json:"tx_id"`
+	Type        string    `json:"type"`
+	Height      int       `json:"height"`
+	TxIndex     int       `json:"tx_index"`
+	Timestamp   time.Time `json:"timestamp"`
+	Title       string    `json:"title,omitempty"`
+	Body        string    `json:"body,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+}
+
+// Comment is a comment on a post.
+type Comment struct {
+	TxID      string    `json:"tx_id"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	Height    int       `json:"height"`
+	TxIndex   int       `json:"tx_index"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// IssueBadBlogTx is reported for blog transactions in a block that break
+// the rules.
+const IssueBadBlogTx = "bad_blog_transaction"
+
+// blogView holds every post on the chain. An overlay view, with a parent,
+// stacks pending transactions on top of the chain's view without
+// changing it.
+type blogView struct {
+	parent *blogView
+	posts  map[string]*Post
+	// order is the IDs of posts created in this view, oldest first.
+	order []string
+	// applied holds the TxID of every blog transaction in this view.
+	applied map[string]bool
+}
+
+func newBlogView(chain []*Block) *blogView {
+	v := &blogView{posts: make(map[string]*Post), applied: make(map[string]bool)}
+	for height, b := range chain {
+		v.add(height, b)
+	}
+	return v
+}
+
+func (v *blogView) overlay() *blogView {
+	return &blogView{parent: v, posts: make(map[string]*Post), applied: make(map[string]bool)}
+}
+
+// seen reports whether the blog transaction with TxID id is in the view.
+func (v *blogView) seen(id string) bool {
+	for ; v != nil; v = v.parent {
+		if v.applied[id] {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *blogView) post(id string) *Post {
+	for ; v != nil; v = v.parent {
+		if p, ok := v.posts[id]; ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// add applies the blog transactions of b, the block at height, in order,
+// and reports those that break the rules.
+func (v *blogView) add(height int, b *Block) []Issue {
+	var issues []Issue
+	for i, tx := range b.Transactions {
+		t, ok, err := ParseBlogTx(tx)
+		if !ok {
+			continue
+		}
+		if err == nil {
+			err = v.check(t, TxID(tx))
+		}
+		if err != nil {
+			issues = append(issues, Issue{Code: IssueBadBlogTx, Message: fmt.Sprintf("transaction %d: %v", i, err)})
+			continue
+		}
+		v.apply(t, TxID(tx), height, i, b.Timestamp)
+	}
+	return issues
+}
+
+// check applies the rules that depend on earlier transactions to t, whose
+// TxID is id: no transaction may be repeated, so a signed edit, delete,
+// comment or note cannot be replayed; edits and deletes must come from the
+// post's author, and nothing may refer to a missing or deleted post.
+func (v *blogView) check(t BlogTx, id string) error {
+	if v.seen(id) {
+		if t.Type == TxPost {
+			return fmt.Errorf("%w: post %s already exists", ErrInvalidBlogTx, short(id))
+		}
+		return fmt.Errorf("%w: %s %s is already on the chain or pending", ErrInvalidBlogTx, t.Type, short(id))
+	}
+	if t.Type == TxPost || t.Type == TxNote {
+		return nil
+	}
+	p := v.post(t.Post)
+	switch {
+	case p == nil:
+		return fmt.Errorf("%w: post %s does not exist", ErrInvalidBlogTx, short(t.Post))
+	case p.Deleted:
+		return fmt.Errorf("%w: post %s is deleted", ErrInvalidBlogTx, short(t.Post))
+	case t.Type != TxComment && t.Author != p.Author:
+		return fmt.Errorf("%w: only the author of post %s may %s it", ErrInvalidBlogTx, short(t.Post), t.Type)
+	}
+	return nil
+}
+
+// apply records t, which has passed check, as transaction index of the
+// block at height stamped ts.
+func (v *blogView) apply(t BlogTx, id string, height, index int, ts time.Time) {
+	v.applied[id] = true
+	if t.Type == TxNote {
+		return
+	}
+	contentType := t.ContentType
+	if contentType == "" {
+		contentType = ContentPlain
+	}
+	rev := Revision{TxID: id, Type: t.Type, Height: height, TxIndex: index, Timestamp: ts}
+	if t.Type != TxDelete {
+		rev.Title, rev.Body, rev.Tags, rev.ContentType = t.Title, t.Body, t.Tags, contentType
+	}
+
+	if t.Type == TxPost {
+		v.posts[id] = &Post{
+			ID:          id,
+			Author:      t.Author,
+			Title:       t.Title,
+			Body:        t.Body,
+			Tags:        t.Tags,
+			ContentType: contentType,
+			Height:      height,
+			Created:     ts,
+			Updated:     ts,
+			Revisions:   []Revision{rev},
+		}
+		v.order = append(v.order, id)
+		return
+	}
+
+	// Copy rather than modify a post that belongs to the parent view.
+	p := v.post(t.Post).clone()
+	v.posts[p.ID] = p
+	switch t.Type {
+	case TxEdit:
+		p.Title, p.Body, p.Tags, p.ContentType = t.Title, t.Body, t.Tags, contentType
+		p.Updated = ts
+		p.Revisions = append(p.Revisions, rev)
+	case TxDelete:
+		p.Title, p.Body, p.Tags, p.ContentType = "", "", nil, ""
+		p.Deleted = true
+		p.Updated = ts
+		p.Revisions = append(p.Revisions, rev)
+	case TxComment:
+		p.Comments = append(p.Comments, Comment{TxID: id, Author: t.Author, Body: t.Body, Height: height, TxIndex: index, Timestamp: ts})
+	}
+}
+
+// clone copies p so that appending to the copy's history cannot touch
+// p's.
+func (p *Post) clone() *Post {
+	c := *p
+	c.Revisions = append([]Revision(nil), p.Revisions...)
+	c.Comments = append([]Comment(nil), p.Comments...)
+	return &c
+}
+
+// Posts returns every post that has not been deleted, newest first.
+func (bc *Blockchain) Posts() []Post {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	posts := make([]Post, 0, len(bc.blog.order))
+	for i := len(bc.blog.order) - 1; i >= 0; i-- {
+		if p := bc.blog.posts[bc.blog.order[i]]; !p.Deleted {
+			posts = append(posts, *p.clone())
+		}
+	}
+	return posts
+}
+
+// Post returns the post with the given ID, including deleted ones, with
+// its full history and comments.
+func (bc *Blockchain) Post(id string) (Post, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	p := bc.blog.post(id)
+	if p == nil {
+		return Post{}, fmt.Errorf("post %s: %w", id, ErrNotFound)
+	}
+	return *p.clone(), nil
+}
+
+// checkBlogTxLocked checks a blog transaction offered to the pending pool
+// against the chain and the transactions already pending.
+func (bc *Blockchain) checkBlogTxLocked(tx string) error {
+	t, ok, err := ParseBlogTx(tx)
+	if !ok || err != nil {
+		return err
+	}
+	pending := bc.blog.overlay()
+	pending.addPending(bc.PendingTxs)
+	return pending.check(t, TxID(tx))
+}
+
+// addPending applies the valid blog transactions among txs as if they
+// were the next block, and returns txs without the invalid ones.
+func (v *blogView) addPending(txs []string) []string {
+	valid := make([]string, 0, len(txs))
+	for i, tx := range txs {
+		t, ok, err := ParseBlogTx(tx)
+		if ok && err == nil {
+			err = v.check(t, TxID(tx))
+		}
+		if err != nil {
+			continue
+		}
+		if ok {
+			v.apply(t, TxID(tx), -1, i, time.Time{})
+		}
+		valid = append(valid, tx)
+	}
+	return valid
+}
@@ -0,0 +1,62 @@
+package blockchain
+
+import (
+	"sort"
+	"time"
+)
+
+// Clock supplies the current time to block creation, mining, retargeting
+// and timestamp validation, so tests and simulations can control it.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
+
+// OffsetClock is Base shifted by Offset, for a node whose own clock is
+// known to be off, e.g. by the median difference reported by its peers.
+type OffsetClock struct {
+	Base   Clock
+	Offset time.Duration
+}
+
+func (c OffsetClock) Now() time.Time { return c.Base.Now().Add(c.Offset) }
+
+const (
+	// MedianTimeSpan is how many preceding blocks the median time past is
+	// taken over.
+	MedianTimeSpan = 11
+	// DefaultMaxFutureDrift is how far ahead of the node's clock a block
+	// timestamp may be.
+	DefaultMaxFutureDrift = 2 * time.Hour
+)
+
+// medianTimePast is the median timestamp of the last MedianTimeSpan blocks
+// of chain, or the zero time for an empty chain.
+func medianTimePast(chain []*Block) time.Time {
+	if len(chain) == 0 {
+		return time.Time{}
+	}
+	start := len(chain) - MedianTimeSpan
+	if start < 0 {
+		start = 0
+	}
+	times := make([]time.Time, 0, len(chain)-start)
+	for _, b := range chain[start:] {
+		times = append(times, b.Timestamp)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times[len(times)/2]
+}
+
+func clockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
@@ -0,0 +1,163 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// TxRecord is a mined transaction and where it sits in the chain.
+type TxRecord struct {
+	TxID          string    `json:"tx_id"`
+	Height        int       `json:"height"`
+	TxIndex       int       `json:"tx_index"`
+	BlockHash     string    `json:"block_hash"`
+	Timestamp     time.Time `json:"timestamp"`
+	Confirmations int       `json:"confirmations"`
+	Transaction   string    `json:"transaction"`
+}
+
+// lookupIndex maps block hashes to heights and transaction IDs to where
+// they were mined. Like searchIndex it grows and unwinds from the tip.
+type lookupIndex struct {
+	heights map[string]int
+	// txs lists every occurrence of a transaction ID in chain order; the
+	// same text may be mined again in a later block.
+	txs map[string][]txRef
+}
+
+func newLookupIndex(chain []*Block) *lookupIndex {
+	ix := &lookupIndex{
+		heights: make(map[string]int, len(chain)),
+		txs:     make(map[string][]txRef),
+	}
+	for height, b := range chain {
+		ix.add(height, b)
+	}
+	return ix
+}
+
+// add indexes b as the block at height.
+func (ix *lookupIndex) add(height int, b *Block) {
+	ix.heights[b.Hash] = height
+	for i, tx := range b.Transactions {
+		id := TxID(tx)
+		ix.txs[id] = append(ix.txs[id], txRef{height, i})
+	}
+}
+
+// truncate drops removed, the blocks from height on.
+func (ix *lookupIndex) truncate(height int, removed []*Block) {
+	for _, b := range removed {
+		delete(ix.heights, b.Hash)
+		for _, tx := range b.Transactions {
+			id := TxID(tx)
+			refs := ix.txs[id]
+			n := len(refs)
+			for n > 0 && refs[n-1].height >= height {
+				n--
+			}
+			if n == 0 {
+				delete(ix.txs, id)
+			} else {
+				ix.txs[id] = refs[:n]
+			}
+		}
+	}
+}
+
+// GetBlockByHash returns the block in the current chain with the given
+// hash.
+func (bc *Blockchain) GetBlockByHash(hash string) (*Block, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	height, ok := bc.lookup.heights[strings.ToLower(hash)]
+	if !ok {
+		return nil, fmt.Errorf("block %s: %w", hash, ErrNotFound)
+	}
+	return bc.Chain[height], nil
+}
+
+// GetBlockByHeight returns the block at height, the genesis block being 0.
+func (bc *Blockchain) GetBlockByHeight(height int) (*Block, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	if height < 0 || height >= len(bc.Chain) {
+		return nil, fmt.Errorf("block at height %d: %w", height, ErrNotFound)
+	}
+	return bc.Chain[height], nil
+}
+
+// GetTransaction returns the mined transaction whose TxID is id. If it was
+// mined more than once, the earliest occurrence is returned.
+func (bc *Blockchain) GetTransaction(id string) (TxRecord, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	id = strings.ToLower(id)
+	ref, err := bc.findTxLocked(id)
+	if err != nil {
+		return TxRecord{}, err
+	}
+	b := bc.Chain[ref.height]
+	return TxRecord{
+		TxID:          id,
+		Height:        ref.height,
+		TxIndex:       ref.tx,
+		BlockHash:     b.Hash,
+		Timestamp:     b.Timestamp,
+		Confirmations: len(bc.Chain) - ref.height,
+		Transaction:   b.Transactions[ref.tx],
+	}, nil
+}
+
+func (bc *Blockchain) findTxLocked(id string) (txRef, error) {
+	refs := bc.lookup.txs[id]
+	if len(refs) == 0 {
+		return txRef{}, fmt.Errorf("transaction %s: %w", id, ErrNotFound)
+	}
+	return refs[0], nil
+}
+
+// TxProof shows that a transaction is committed to by a block: Path leads
+// from TxID, the Merkle leaf, to the block's MerkleRoot.
+type TxProof struct {
+	TxID       string      `json:"tx_id"`
+	Height     int         `json:"height"`
+	TxIndex    int         `json:"tx_index"`
+	BlockHash  string      `json:"block_hash"`
+	MerkleRoot string      `json:"merkle_root"`
+	Path       []ProofStep `json:"path"`
+}
+
+// Verify reports whether the proof's path leads to its Merkle root.
+func (p TxProof) Verify() bool {
+	return VerifyMerkleProof(p.TxID, p.MerkleRoot, p.Path)
+}
+
+// GetTxProof returns the Merkle inclusion proof of the transaction
+// GetTransaction would return for id.
+func (bc *Blockchain) GetTxProof(id string) (TxProof, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	id = strings.ToLower(id)
+	ref, err := bc.findTxLocked(id)
+	if err != nil {
+		return TxProof{}, err
+	}
+	b := bc.Chain[ref.height]
+	return TxProof{
+		TxID:       id,
+		Height:     ref.height,
+		TxIndex:    ref.tx,
+		BlockHash:  b.Hash,
+		MerkleRoot: b.MerkleRoot,
+		Path:       NewMerkleTree(b.Transactions).Proof(ref.tx),
+	}, nil
+}
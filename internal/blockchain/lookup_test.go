@@ -0,0 +1,25 @@
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Unwinding blocks from the tip leaves the index as if they had never
+// been added, including a transaction mined both before and after the
+// cut.
+func TestLookupIndexTruncate(t *testing.T) {
+	bc := NewBlockchain(1)
+	mineTx(t, bc, "again")
+	mineTx(t, bc, "once")
+	mineTx(t, bc, "again")
+	chain := bc.GetChain()
+
+	for height := len(chain); height >= 1; height-- {
+		ix := newLookupIndex(chain)
+		ix.truncate(height, chain[height:])
+		if want := newLookupIndex(chain[:height]); !reflect.DeepEqual(ix, want) {
+			t.Errorf("truncated to %d blocks: %+v, want %+v", height, ix, want)
+		}
+	}
+}
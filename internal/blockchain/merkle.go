@@ -6,21 +6,48 @@ import (
 )
 
 type MerkleTree struct {
-	Root   string
+	Root string
+	// Leaves are the TxIDs the tree is built over.
 	Leaves []string
 }
 
+// TxID identifies a transaction: the hex SHA-256 of its text, from which
+// its leaf in the block's Merkle tree is hashed.
+func TxID(tx string) string {
+	hash := sha256.Sum256([]byte(tx))
+	return hex.EncodeToString(hash[:])
+}
+
+// Leaves and interior nodes are hashed behind different prefixes. Were
+// they not, the text of two sibling hashes would be a transaction whose
+// TxID is their parent, and a proof could pass it off as included.
+const (
+	merkleLeafPrefix = "\x00"
+	merkleNodePrefix = "\x01"
+)
+
+// merkleLeaf returns the leaf hash of the transaction with TxID id.
+func merkleLeaf(id string) string {
+	hash := sha256.Sum256([]byte(merkleLeafPrefix + id))
+	return hex.EncodeToString(hash[:])
+}
+
+// merkleNode returns the hash of the interior node over left and right.
+func merkleNode(left, right string) string {
+	hash := sha256.Sum256([]byte(merkleNodePrefix + left + right))
+	return hex.EncodeToString(hash[:])
+}
+
 func NewMerkleTree(transactions []string) *MerkleTree {
 	tree := &MerkleTree{
 		Leaves: make([]string, len(transactions)),
 	}
 
 	for i, tx := range transactions {
-		hash := sha256.Sum256([]byte(tx))
-		tree.Leaves[i] = hex.EncodeToString(hash[:])
+		tree.Leaves[i] = TxID(tx)
 	}
 
-	tree.Root = tree.buildTree(tree.Leaves)
+	tree.Root = tree.buildTree(leafHashes(tree.Leaves))
 	return tree
 }
 
@@ -40,14 +67,68 @@ func (mt *MerkleTree) buildTree(nodes []string) string {
 	}
 
 	for i := 0; i < len(nodes); i += 2 {
-		combined := nodes[i] + nodes[i+1]
-		hash := sha256.Sum256([]byte(combined))
-		newLevel = append(newLevel, hex.EncodeToString(hash[:]))
+		newLevel = append(newLevel, merkleNode(nodes[i], nodes[i+1]))
 	}
 
 	return mt.buildTree(newLevel)
 }
 
+func leafHashes(ids []string) []string {
+	hashes := make([]string, len(ids))
+	for i, id := range ids {
+		hashes[i] = merkleLeaf(id)
+	}
+	return hashes
+}
+
 func (mt *MerkleTree) GetRoot() string {
 	return mt.Root
 }
+
+// ProofStep is one sibling on the path from a leaf to the Merkle root.
+// Left means the sibling is hashed before the running hash.
+type ProofStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left,omitempty"`
+}
+
+// Proof returns the path from leaf index to the root, or nil if there is
+// no such leaf.
+func (mt *MerkleTree) Proof(index int) []ProofStep {
+	if index < 0 || index >= len(mt.Leaves) {
+		return nil
+	}
+	path := []ProofStep{}
+	level := leafHashes(mt.Leaves)
+	for len(level) > 1 {
+		if len(level)%2 != 0 {
+			level = append(level[:len(level):len(level)], level[len(level)-1])
+		}
+		if index%2 == 0 {
+			path = append(path, ProofStep{Hash: level[index+1]})
+		} else {
+			path = append(path, ProofStep{Hash: level[index-1], Left: true})
+		}
+		next := make([]string, 0, len(level)/2)
+		for i := 0; i < len(level); i += 2 {
+			next = append(next, merkleNode(level[i], level[i+1]))
+		}
+		level = next
+		index /= 2
+	}
+	return path
+}
+
+// VerifyMerkleProof reports whether path leads from the leaf of the
+// transaction with TxID id to root.
+func VerifyMerkleProof(id, root string, path []ProofStep) bool {
+	hash := merkleLeaf(id)
+	for _, step := range path {
+		if step.Left {
+			hash = merkleNode(step.Hash, hash)
+		} else {
+			hash = merkleNode(hash, step.Hash)
+		}
+	}
+	return hash == root
+}
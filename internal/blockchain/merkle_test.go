@@ -0,0 +1,62 @@
+package blockchain
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMerkleProofs(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		txs := make([]string, n)
+		for i := range txs {
+			txs[i] = fmt.Sprintf("tx %d", i)
+		}
+		tree := NewMerkleTree(txs)
+		for i, tx := range txs {
+			path := tree.Proof(i)
+			if !VerifyMerkleProof(TxID(tx), tree.Root, path) {
+				t.Errorf("%d txs: proof of tx %d does not verify", n, i)
+			}
+			if VerifyMerkleProof(TxID(tx+"!"), tree.Root, path) {
+				t.Errorf("%d txs: proof of tx %d verifies another transaction", n, i)
+			}
+			if len(path) > 0 {
+				path[0].Left = !path[0].Left
+				if VerifyMerkleProof(TxID(tx), tree.Root, path) && path[0].Hash != merkleLeaf(TxID(tx)) {
+					t.Errorf("%d txs: proof of tx %d verifies with a flipped step", n, i)
+				}
+			}
+		}
+	}
+}
+
+// An interior node must not pass for a transaction: the text of two
+// sibling hashes would otherwise hash to their parent.
+func TestMerkleInteriorNodeIsNotATransaction(t *testing.T) {
+	txs := []string{"a", "b", "c", "d"}
+	tree := NewMerkleTree(txs)
+	left := merkleNode(merkleLeaf(TxID("a")), merkleLeaf(TxID("b")))
+	right := merkleNode(merkleLeaf(TxID("c")), merkleLeaf(TxID("d")))
+	if merkleNode(left, right) != tree.Root {
+		t.Fatal("test does not rebuild the tree's root")
+	}
+
+	forged := left + right
+	if VerifyMerkleProof(TxID(forged), tree.Root, nil) {
+		t.Fatal("the concatenated children of the root verify as a transaction")
+	}
+	forged = merkleLeaf(TxID("a")) + merkleLeaf(TxID("b"))
+	if VerifyMerkleProof(TxID(forged), tree.Root, []ProofStep{{Hash: right}}) {
+		t.Fatal("the concatenated children of an interior node verify as a transaction")
+	}
+}
+
+func TestMerkleSingleTransaction(t *testing.T) {
+	tree := NewMerkleTree([]string{"only"})
+	if tree.Root == TxID("only") {
+		t.Fatal("a single transaction's root is its unprefixed TxID")
+	}
+	if !VerifyMerkleProof(TxID("only"), tree.Root, tree.Proof(0)) {
+		t.Fatal("proof of the only transaction does not verify")
+	}
+}
@@ -0,0 +1,847 @@
+package blockchain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SearchResult is one transaction matching a search query.
+type SearchResult struct {
+	Height      int       `json:"height"`
+	BlockHash   string    `json:"block_hash"`
+	Timestamp   time.Time `json:"timestamp"`
+	Miner       string    `json:"miner,omitempty"`
+	TxIndex     int       `json:"tx_index"`
+	TxID        string    `json:"tx_id"`
+	Transaction string    `json:"transaction"`
+	Type        string    `json:"tx_type"`
+	Author      string    `json:"author,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Snippet     string    `json:"snippet"`
+}
+
+// SearchQuery selects transactions by Text, read according to Mode, and
+// filters; empty fields do not filter. Heights and times are inclusive, every tag
+// must be present, and Sort is "oldest" (the default) or "newest". Cursor
+// continues from the NextCursor of a previous page.
+type SearchQuery struct {
+	Text       string     `json:"query,omitempty"`
+	Mode       SearchMode `json:"mode,omitempty"`
+	FromHeight *int       `json:"from_height,omitempty"`
+	ToHeight   *int       `json:"to_height,omitempty"`
+	Since      time.Time  `json:"since,omitempty"`
+	Until      time.Time  `json:"until,omitempty"`
+	Author     string     `json:"author,omitempty"`
+	TxType     string     `json:"tx_type,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	Miner      string     `json:"miner,omitempty"`
+	Sort       string     `json:"sort,omitempty"`
+	Cursor     string     `json:"cursor,omitempty"`
+	Limit      int        `json:"limit,omitempty"`
+}
+
+// SearchPage is one page of results. Total counts every match, not just
+// this page; NextCursor is empty on the last page.
+type SearchPage struct {
+	Results    []SearchResult `json:"results"`
+	Total      int            `json:"total"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 500
+)
+
+var ErrBadQuery = errors.New("invalid search query")
+
+// Search runs q and returns a page of at most q.Limit results, between 1
+// and MaxSearchLimit with DefaultSearchLimit if unset.
+func (bc *Blockchain) Search(q SearchQuery) (SearchPage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+	return bc.search(q, limit)
+}
+
+// SearchData returns every transaction matching query, in chain order. In
+// SearchText mode words match case-insensitively and whole (ignoring
+// punctuation); word* matches a prefix, "quoted words" match a phrase, and
+// terms combine with AND (the default between terms), OR, NOT or a leading
+// -, grouped by parentheses. The other modes are described at SearchMode.
+func (bc *Blockchain) SearchData(query string, mode SearchMode) ([]SearchResult, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("%w: nothing to search for", ErrBadQuery)
+	}
+	page, err := bc.search(SearchQuery{Text: query, Mode: mode}, 0)
+	return page.Results, err
+}
+
+// search runs q, returning every match when limit is 0.
+func (bc *Blockchain) search(q SearchQuery, limit int) (SearchPage, error) {
+	var (
+		text  queryNode
+		match matcher
+		err   error
+	)
+	switch {
+	case q.Mode != "" && q.Mode != SearchText:
+		if match, err = newMatcher(q.Mode, q.Text); err != nil {
+			return SearchPage{}, err
+		}
+	case strings.TrimSpace(q.Text) != "":
+		if text, err = parseQuery(q.Text); err != nil {
+			return SearchPage{}, err
+		}
+	}
+	newest := false
+	switch q.Sort {
+	case "", "oldest":
+	case "newest":
+		newest = true
+	default:
+		return SearchPage{}, fmt.Errorf("%w: sort must be oldest or newest, not %q", ErrBadQuery, q.Sort)
+	}
+	after, err := parseCursor(q.Cursor)
+	if err != nil {
+		return SearchPage{}, err
+	}
+
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	var refs []txRef
+	if text != nil {
+		refs = text.eval(bc.index).sorted()
+	} else {
+		refs = bc.index.all()
+	}
+	matched := refs[:0]
+	locs := make(map[txRef][]int)
+	deadline := time.Now().Add(SearchBudget)
+	for i, ref := range refs {
+		if match != nil && i%256 == 0 && time.Now().After(deadline) {
+			return SearchPage{}, ErrSearchBudget
+		}
+		if !bc.matchesFilters(ref, q) {
+			continue
+		}
+		if match != nil {
+			b := bc.Chain[ref.height]
+			ok, loc := match(b, b.Transactions[ref.tx], bc.index.meta[ref.height][ref.tx])
+			if !ok {
+				continue
+			}
+			if loc != nil {
+				locs[ref] = loc
+			}
+		}
+		matched = append(matched, ref)
+	}
+	if newest {
+		for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+			matched[i], matched[j] = matched[j], matched[i]
+		}
+	}
+
+	page := SearchPage{Total: len(matched), Results: []SearchResult{}}
+	if after != nil {
+		n := sort.Search(len(matched), func(i int) bool {
+			if newest {
+				return matched[i].less(*after)
+			}
+			return after.less(matched[i])
+		})
+		matched = matched[n:]
+	}
+	if limit > 0 && len(matched) > limit {
+		matched = matched[:limit]
+		page.NextCursor = matched[limit-1].cursor()
+	}
+
+	var hl []highlight
+	if text != nil {
+		hl = highlights(text, false)
+	}
+	for _, ref := range matched {
+		b := bc.Chain[ref.height]
+		tx := b.Transactions[ref.tx]
+		meta := bc.index.meta[ref.height][ref.tx]
+		page.Results = append(page.Results, SearchResult{
+			Height:      ref.height,
+			BlockHash:   b.Hash,
+			Timestamp:   b.Timestamp,
+			Miner:       b.Miner,
+			TxIndex:     ref.tx,
+			TxID:        meta.ID,
+			Transaction: tx,
+			Type:        meta.Type,
+			Author:      meta.Author,
+			Tags:        meta.Tags,
+			Snippet:     snippet(tx, hl, locs[ref]),
+		})
+	}
+	return page, nil
+}
+
+func (bc *Blockchain) matchesFilters(ref txRef, q SearchQuery) bool {
+	if q.FromHeight != nil && ref.height < *q.FromHeight {
+		return false
+	}
+	if q.ToHeight != nil && ref.height > *q.ToHeight {
+		return false
+	}
+	b := bc.Chain[ref.height]
+	if !q.Since.IsZero() && b.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && b.Timestamp.After(q.Until) {
+		return false
+	}
+	if q.Miner != "" && b.Miner != q.Miner {
+		return false
+	}
+	meta := bc.index.meta[ref.height][ref.tx]
+	if q.TxType != "" && !strings.EqualFold(meta.Type, q.TxType) {
+		return false
+	}
+	if q.Author != "" && !strings.EqualFold(meta.Author, q.Author) {
+		return false
+	}
+	for _, want := range q.Tags {
+		if !meta.hasTag(want) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSearchTime reads an RFC 3339 time or a YYYY-MM-DD date; as the end
+// of a range a date means the end of that day. Empty is the zero time.
+func ParseSearchTime(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time or a YYYY-MM-DD date", s)
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// TxMeta is what search knows about a transaction beyond its text.
+// Transactions that are JSON objects may set "type" and "tags"; anything
+// else has type "text". Author is only known for blog transactions whose
+// signature verifies, and those take their tags from the signed object.
+type TxMeta struct {
+	ID     string
+	Type   string
+	Author string
+	Tags   []string
+}
+
+func ParseTxMeta(tx string) TxMeta {
+	var v struct {
+		Type string   `json:"type"`
+		Tags []string `json:"tags"`
+	}
+	if !decodeTxObject(tx, &v) || v.Type == "" {
+		return TxMeta{ID: TxID(tx), Type: "text"}
+	}
+	if !isBlogType(v.Type) {
+		return TxMeta{ID: TxID(tx), Type: v.Type, Tags: v.Tags}
+	}
+	meta := TxMeta{ID: TxID(tx), Type: v.Type}
+	if t, _, err := ParseBlogTx(tx); err == nil {
+		meta.Author, meta.Tags = t.Author, t.Tags
+	}
+	return meta
+}
+
+// txType returns the "type" of a transaction that is a JSON object, or "".
+func txType(tx string) string {
+	var v struct {
+		Type string `json:"type"`
+	}
+	decodeTxObject(tx, &v)
+	return v.Type
+}
+
+func decodeTxObject(tx string, v interface{}) bool {
+	return strings.HasPrefix(strings.TrimSpace(tx), "{") && json.Unmarshal([]byte(tx), v) == nil
+}
+
+func (m TxMeta) hasTag(tag string) bool {
+	tag = fold(tag)
+	for _, t := range m.Tags {
+		if fold(t) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// txRef locates a transaction by block height and position in the block.
+type txRef struct {
+	height, tx int
+}
+
+func (r txRef) less(o txRef) bool {
+	return r.height < o.height || (r.height == o.height && r.tx < o.tx)
+}
+
+// cursor encodes r as an opaque page cursor.
+func (r txRef) cursor() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", r.height, r.tx)))
+}
+
+func parseCursor(s string) (*txRef, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var r txRef
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		_, err = fmt.Sscanf(string(b), "%d.%d", &r.height, &r.tx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad cursor %q", ErrBadQuery, s)
+	}
+	return &r, nil
+}
+
+type posting struct {
+	ref       txRef
+	positions []int
+}
+
+// searchIndex maps folded terms to the transactions containing them, with
+// word positions for phrase queries. Postings are kept in chain order, so
+// blocks are added to and unwound from the end.
+type searchIndex struct {
+	postings map[string][]posting
+	// terms is every indexed term, sorted, for prefix queries.
+	terms []string
+	// txCounts is the number of transactions in each indexed block.
+	txCounts []int
+	// meta holds each transaction's TxMeta, by height and position.
+	meta [][]TxMeta
+}
+
+func newSearchIndex(chain []*Block) *searchIndex {
+	ix := &searchIndex{postings: make(map[string][]posting)}
+	for _, b := range chain {
+		ix.add(b)
+	}
+	return ix
+}
+
+// add indexes b as the next block.
+func (ix *searchIndex) add(b *Block) {
+	height := len(ix.txCounts)
+	meta := make([]TxMeta, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		meta[i] = ParseTxMeta(tx)
+		positions := make(map[string][]int)
+		var order []string
+		for _, t := range tokenize(tx) {
+			if _, ok := positions[t.term]; !ok {
+				order = append(order, t.term)
+			}
+			positions[t.term] = append(positions[t.term], t.pos)
+		}
+		for _, term := range order {
+			if _, ok := ix.postings[term]; !ok {
+				n := sort.SearchStrings(ix.terms, term)
+				ix.terms = append(ix.terms, "")
+				copy(ix.terms[n+1:], ix.terms[n:])
+				ix.terms[n] = term
+			}
+			ix.postings[term] = append(ix.postings[term], posting{ref: txRef{height, i}, positions: positions[term]})
+		}
+	}
+	ix.txCounts = append(ix.txCounts, len(b.Transactions))
+	ix.meta = append(ix.meta, meta)
+}
+
+// truncate unwinds the index to its first height blocks; removed are the
+// blocks being dropped, whose terms are the only ones affected.
+func (ix *searchIndex) truncate(height int, removed []*Block) {
+	for _, b := range removed {
+		for _, tx := range b.Transactions {
+			for _, t := range tokenize(tx) {
+				ps, ok := ix.postings[t.term]
+				if !ok {
+					continue
+				}
+				n := len(ps)
+				for n > 0 && ps[n-1].ref.height >= height {
+					n--
+				}
+				if n > 0 {
+					ix.postings[t.term] = ps[:n]
+					continue
+				}
+				delete(ix.postings, t.term)
+				if i := sort.SearchStrings(ix.terms, t.term); i < len(ix.terms) && ix.terms[i] == t.term {
+					ix.terms = append(ix.terms[:i], ix.terms[i+1:]...)
+				}
+			}
+		}
+	}
+	ix.txCounts = ix.txCounts[:height]
+	ix.meta = ix.meta[:height]
+}
+
+// all lists every indexed transaction in chain order.
+func (ix *searchIndex) all() []txRef {
+	var refs []txRef
+	for height, count := range ix.txCounts {
+		for i := 0; i < count; i++ {
+			refs = append(refs, txRef{height, i})
+		}
+	}
+	return refs
+}
+
+type refSet map[txRef]struct{}
+
+func (s refSet) sorted() []txRef {
+	refs := make([]txRef, 0, len(s))
+	for r := range s {
+		refs = append(refs, r)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].height != refs[j].height {
+			return refs[i].height < refs[j].height
+		}
+		return refs[i].tx < refs[j].tx
+	})
+	return refs
+}
+
+type token struct {
+	term       string
+	pos        int
+	start, end int // byte offsets in the original text
+}
+
+// tokenize splits s into words of letters, digits and combining marks and
+// case-folds them. Han, Hiragana and Katakana characters, which are
+// written without spaces, are each a word of their own.
+func tokenize(s string) []token {
+	var toks []token
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			toks = append(toks, token{term: fold(s[start:end]), pos: len(toks), start: start, end: end})
+			start = -1
+		}
+	}
+	for i, r := range s {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana):
+			flush(i)
+			start = i
+			flush(i + utf8.RuneLen(r))
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r):
+			if start < 0 {
+				start = i
+			}
+		default:
+			flush(i)
+		}
+	}
+	flush(len(s))
+	return toks
+}
+
+func fold(s string) string {
+	return strings.Map(foldRune, s)
+}
+
+// foldRune maps every case variant of r to the same rune, including ones
+// that ToLower keeps apart such as final sigma or the Kelvin sign.
+func foldRune(r rune) rune {
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return unicode.ToLower(min)
+}
+
+// queryNode is a parsed search query.
+type queryNode interface {
+	eval(ix *searchIndex) refSet
+}
+
+type termNode struct{ term string }
+
+type prefixNode struct{ prefix string }
+
+type phraseNode struct{ terms []string }
+
+type andNode struct{ left, right queryNode }
+
+type orNode struct{ left, right queryNode }
+
+type notNode struct{ inner queryNode }
+
+func (n termNode) eval(ix *searchIndex) refSet {
+	set := refSet{}
+	for _, p := range ix.postings[n.term] {
+		set[p.ref] = struct{}{}
+	}
+	return set
+}
+
+func (n prefixNode) eval(ix *searchIndex) refSet {
+	set := refSet{}
+	for i := sort.SearchStrings(ix.terms, n.prefix); i < len(ix.terms) && strings.HasPrefix(ix.terms[i], n.prefix); i++ {
+		for _, p := range ix.postings[ix.terms[i]] {
+			set[p.ref] = struct{}{}
+		}
+	}
+	return set
+}
+
+// eval finds transactions where the terms occur at consecutive positions.
+func (n phraseNode) eval(ix *searchIndex) refSet {
+	positions := make([]map[txRef][]int, len(n.terms))
+	for i, term := range n.terms {
+		positions[i] = make(map[txRef][]int)
+		for _, p := range ix.postings[term] {
+			positions[i][p.ref] = p.positions
+		}
+	}
+	set := refSet{}
+	for ref, starts := range positions[0] {
+	next:
+		for _, start := range starts {
+			for i := 1; i < len(n.terms); i++ {
+				if !containsInt(positions[i][ref], start+i) {
+					continue next
+				}
+			}
+			set[ref] = struct{}{}
+			break
+		}
+	}
+	return set
+}
+
+func containsInt(xs []int, x int) bool {
+	for _, v := range xs {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
+
+func (n andNode) eval(ix *searchIndex) refSet {
+	left, right := n.left.eval(ix), n.right.eval(ix)
+	set := refSet{}
+	for r := range left {
+		if _, ok := right[r]; ok {
+			set[r] = struct{}{}
+		}
+	}
+	return set
+}
+
+func (n orNode) eval(ix *searchIndex) refSet {
+	set := n.left.eval(ix)
+	for r := range n.right.eval(ix) {
+		set[r] = struct{}{}
+	}
+	return set
+}
+
+func (n notNode) eval(ix *searchIndex) refSet {
+	excluded := n.inner.eval(ix)
+	set := refSet{}
+	for _, ref := range ix.all() {
+		if _, ok := excluded[ref]; !ok {
+			set[ref] = struct{}{}
+		}
+	}
+	return set
+}
+
+// parseQuery parses the query syntax described at SearchData. NOT binds
+// tightest, then AND, then OR.
+func parseQuery(query string) (queryNode, error) {
+	words, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{words: words}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.words) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrBadQuery, p.words[p.pos].text)
+	}
+	if node == nil {
+		return nil, fmt.Errorf("%w: nothing to search for", ErrBadQuery)
+	}
+	return node, nil
+}
+
+type queryWord struct {
+	text   string
+	quoted bool
+}
+
+func lexQuery(query string) ([]queryWord, error) {
+	var words []queryWord
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			words = append(words, queryWord{text: string(r)})
+			i++
+		case r == '"' || (r == '-' && i+1 < len(runes) && runes[i+1] == '"'):
+			if r == '-' {
+				words = append(words, queryWord{text: "NOT"})
+				i++
+			}
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("%w: unterminated quote", ErrBadQuery)
+			}
+			words = append(words, queryWord{text: string(runes[i+1 : end]), quoted: true})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("()\"", runes[end]) {
+				end++
+			}
+			word := string(runes[i:end])
+			if strings.HasPrefix(word, "-") && len(word) > 1 {
+				words = append(words, queryWord{text: "NOT"})
+				word = word[1:]
+			}
+			words = append(words, queryWord{text: word})
+			i = end
+		}
+	}
+	return words, nil
+}
+
+type queryParser struct {
+	words []queryWord
+	pos   int
+}
+
+func (p *queryParser) peek() (queryWord, bool) {
+	if p.pos < len(p.words) {
+		return p.words[p.pos], true
+	}
+	return queryWord{}, false
+}
+
+func (p *queryParser) isOp(op string) bool {
+	w, ok := p.peek()
+	return ok && !w.quoted && w.text == op
+}
+
+// The parse functions return a nil node for input that holds no words,
+// such as punctuation, which the callers then skip.
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("OR") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = combine(left, right, func(l, r queryNode) queryNode { return orNode{l, r} })
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	var left queryNode
+	for {
+		w, ok := p.peek()
+		if !ok || (!w.quoted && (w.text == "OR" || w.text == ")")) {
+			return left, nil
+		}
+		if p.isOp("AND") {
+			p.pos++
+			continue
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = combine(left, right, func(l, r queryNode) queryNode { return andNode{l, r} })
+	}
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.isOp("NOT") {
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil || inner == nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	w, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("%w: query ends after an operator", ErrBadQuery)
+	}
+	p.pos++
+	if !w.quoted && w.text == "(" {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOp(")") {
+			return nil, fmt.Errorf("%w: missing )", ErrBadQuery)
+		}
+		p.pos++
+		return node, nil
+	}
+
+	prefix := !w.quoted && strings.HasSuffix(w.text, "*")
+	var terms []string
+	for _, t := range tokenize(strings.TrimSuffix(w.text, "*")) {
+		terms = append(terms, t.term)
+	}
+	switch {
+	case len(terms) == 0:
+		return nil, nil
+	case prefix && len(terms) > 1:
+		return nil, fmt.Errorf("%w: %q: a prefix must be a single word", ErrBadQuery, w.text)
+	case prefix:
+		return prefixNode{terms[0]}, nil
+	case len(terms) == 1:
+		return termNode{terms[0]}, nil
+	default:
+		return phraseNode{terms}, nil
+	}
+}
+
+func combine(left, right queryNode, op func(l, r queryNode) queryNode) queryNode {
+	switch {
+	case left == nil:
+		return right
+	case right == nil:
+		return left
+	default:
+		return op(left, right)
+	}
+}
+
+// highlight is a term or prefix a snippet should be centred on.
+type highlight struct {
+	text   string
+	prefix bool
+}
+
+// highlights collects the terms of q outside any NOT.
+func highlights(q queryNode, negated bool) []highlight {
+	switch n := q.(type) {
+	case termNode:
+		if !negated {
+			return []highlight{{text: n.term}}
+		}
+	case prefixNode:
+		if !negated {
+			return []highlight{{text: n.prefix, prefix: true}}
+		}
+	case phraseNode:
+		if !negated {
+			return []highlight{{text: n.terms[0]}}
+		}
+	case andNode:
+		return append(highlights(n.left, negated), highlights(n.right, negated)...)
+	case orNode:
+		return append(highlights(n.left, negated), highlights(n.right, negated)...)
+	case notNode:
+		return highlights(n.inner, !negated)
+	}
+	return nil
+}
+
+const snippetRadius = 40
+
+// snippet returns the part of tx around loc, a byte range, or else the
+// first highlighted word, or else its start, marking cut ends with "...".
+func snippet(tx string, hl []highlight, loc []int) string {
+	if loc == nil {
+		for _, t := range tokenize(tx) {
+			if matchesHighlight(t.term, hl) {
+				loc = []int{t.start, t.end}
+				break
+			}
+		}
+	}
+	runes := []rune(tx)
+	from, to := 0, 2*snippetRadius
+	if loc != nil {
+		start := utf8.RuneCountInString(tx[:loc[0]])
+		from = start - snippetRadius
+		to = start + utf8.RuneCountInString(tx[loc[0]:loc[1]]) + snippetRadius
+	}
+	if from < 0 {
+		from = 0
+	}
+	if to > len(runes) {
+		to = len(runes)
+	}
+	s := strings.TrimSpace(string(runes[from:to]))
+	if from > 0 {
+		s = "..." + s
+	}
+	if to < len(runes) {
+		s += "..."
+	}
+	return s
+}
+
+func matchesHighlight(term string, hl []highlight) bool {
+	for _, h := range hl {
+		if term == h.text || (h.prefix && strings.HasPrefix(term, h.text)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testKey returns a fixed signing key derived from seed.
+func testKey(seed byte) ed25519.PrivateKey {
+	s := make([]byte, ed25519.SeedSize)
+	for i := range s {
+		s[i] = seed
+	}
+	return ed25519.NewKeyFromSeed(s)
+}
+
+func signed(t BlogTx, key ed25519.PrivateKey) BlogTx {
+	t.Time = 1760000000
+	t.Sign(key)
+	return t
+}
+
+func TestParseTxMeta(t *testing.T) {
+	key := testKey(1)
+	post := signed(BlogTx{Type: TxPost, Title: "Hello", Tags: []string{"go"}}, key)
+	tampered := post
+	tampered.Title = "Changed"
+	forged := post
+	forged.Author = strings.Repeat("ab", ed25519.PublicKeySize)
+
+	tests := []struct {
+		name   string
+		tx     string
+		typ    string
+		author string
+		tags   []string
+	}{
+		{"plain text", "hello world", "text", "", nil},
+		{"json without type", `{"author":"x"}`, "text", "", nil},
+		{"other json type", `{"type":"notarize","author":"x","tags":["a"]}`, "notarize", "", []string{"a"}},
+		{"signed post", post.Encode(), TxPost, post.Author, []string{"go"}},
+		{"tampered post", tampered.Encode(), TxPost, "", nil},
+		{"post claiming another author", forged.Encode(), TxPost, "", nil},
+		{"unsigned post", `{"type":"post","author":"` + post.Author + `","title":"x","tags":["go"]}`, TxPost, "", nil},
+		{"blog type that does not decode", `{"type":"post","time":"soon"}`, TxPost, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := ParseTxMeta(tt.tx)
+			if meta.ID != TxID(tt.tx) {
+				t.Errorf("ID = %s, want %s", meta.ID, TxID(tt.tx))
+			}
+			if meta.Type != tt.typ {
+				t.Errorf("Type = %q, want %q", meta.Type, tt.typ)
+			}
+			if meta.Author != tt.author {
+				t.Errorf("Author = %q, want %q", meta.Author, tt.author)
+			}
+			if strings.Join(meta.Tags, ",") != strings.Join(tt.tags, ",") {
+				t.Errorf("Tags = %q, want %q", meta.Tags, tt.tags)
+			}
+		})
+	}
+}
+
+func TestSearchQuerySyntax(t *testing.T) {
+	txs := []string{
+		"Hello world",
+		"hello there, Köln",
+		"goodbye world",
+		"東京タワー",
+		"ΣΊΣΥΦΟΣ rolls",
+		"the world is big",
+	}
+	bc := NewBlockchain(1)
+	for _, tx := range txs {
+		if err := bc.AddTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bc.MineBlock()
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"hello", []int{0, 1}},
+		{"HELLO world", []int{0}},
+		{"hello AND world", []int{0}},
+		{"hello OR goodbye", []int{0, 1, 2}},
+		{"world -hello", []int{2, 5}},
+		{"world NOT (goodbye OR big)", []int{0}},
+		{`"world is"`, []int{5}},
+		{`"is world"`, nil},
+		{`world -"is big"`, []int{0, 2}},
+		{"hel*", []int{0, 1}},
+		{"wor", nil},
+		{"KÖLN", []int{1}},
+		{"京", []int{3}},
+		{"σίσυφος", []int{4}},
+		{"hello, world!", []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := bc.SearchData(tt.query, SearchText)
+			if err != nil {
+				t.Fatalf("SearchData: %v", err)
+			}
+			var got []string
+			for _, r := range results {
+				got = append(got, r.Transaction)
+			}
+			var want []string
+			for _, i := range tt.want {
+				want = append(want, txs[i])
+			}
+			if strings.Join(got, "|") != strings.Join(want, "|") {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+
+	for _, query := range []string{"", `"unterminated`, "(hello", "NOT", "foo-bar*", "hello)"} {
+		if _, err := bc.SearchData(query, SearchText); !errors.Is(err, ErrBadQuery) {
+			t.Errorf("SearchData(%q) = %v, want ErrBadQuery", query, err)
+		}
+	}
+}
+
+// Unwinding blocks from the tip leaves the index as if they had never
+// been added.
+func TestSearchIndexTruncate(t *testing.T) {
+	bc := NewBlockchain(1)
+	mineTx(t, bc, "alpha beta")
+	mineTx(t, bc, "beta gamma")
+	mineTx(t, bc, "gamma delta beta")
+	chain := bc.GetChain()
+
+	for height := len(chain); height >= 1; height-- {
+		ix := newSearchIndex(chain)
+		ix.truncate(height, chain[height:])
+		if want := newSearchIndex(chain[:height]); !reflect.DeepEqual(ix, want) {
+			t.Errorf("truncated to %d blocks: %+v, want %+v", height, ix, want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"time"
+)
+
+// SearchMode selects how SearchQuery.Text is matched.
+type SearchMode string
+
+const (
+	// SearchText is the full-text query language; it is the default.
+	SearchText SearchMode = "text"
+	// SearchBlockHash matches every transaction of blocks whose hash
+	// starts with the given hex.
+	SearchBlockHash SearchMode = "block_hash"
+	// SearchTxID matches transactions whose TxID starts with the given hex.
+	SearchTxID SearchMode = "tx_id"
+	// SearchMerkleRoot matches every transaction of blocks whose Merkle
+	// root starts with the given hex.
+	SearchMerkleRoot SearchMode = "merkle_root"
+	// SearchRegex matches transactions against an RE2 regular expression.
+	SearchRegex SearchMode = "regex"
+)
+
+const (
+	// MaxRegexLength and maxRegexProgram bound the size of a regex, and
+	// SearchBudget the time any non-text search may hold the chain's
+	// read lock.
+	MaxRegexLength  = 512
+	maxRegexProgram = 4000
+	SearchBudget    = 2 * time.Second
+)
+
+var ErrSearchBudget = errors.New("search took too long; narrow it with filters or a more specific pattern")
+
+// matcher reports whether a transaction matches a non-text mode, and the
+// byte range of the match to centre its snippet on, if any.
+type matcher func(b *Block, tx string, meta TxMeta) (ok bool, loc []int)
+
+func newMatcher(mode SearchMode, pattern string) (matcher, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("%w: %s search needs a pattern", ErrBadQuery, mode)
+	}
+	switch mode {
+	case SearchBlockHash, SearchTxID, SearchMerkleRoot:
+		prefix, err := hexPrefix(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return func(b *Block, tx string, meta TxMeta) (bool, []int) {
+			switch mode {
+			case SearchBlockHash:
+				return strings.HasPrefix(b.Hash, prefix), nil
+			case SearchTxID:
+				return strings.HasPrefix(meta.ID, prefix), nil
+			default:
+				return strings.HasPrefix(b.MerkleRoot, prefix), nil
+			}
+		}, nil
+	case SearchRegex:
+		re, err := compileSearchRegex(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return func(b *Block, tx string, meta TxMeta) (bool, []int) {
+			loc := re.FindStringIndex(tx)
+			return loc != nil, loc
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown mode %q", ErrBadQuery, mode)
+}
+
+func hexPrefix(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) > 64 || strings.Trim(s, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("%w: %q is not a hex hash or prefix", ErrBadQuery, s)
+	}
+	return s, nil
+}
+
+// compileSearchRegex compiles an RE2 pattern, whose matching time is linear
+// in the input, after rejecting ones whose compiled program is large
+// enough, through counted repetition such as (\w{40}){40}, to make each
+// step of that linear scan expensive.
+func compileSearchRegex(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > MaxRegexLength {
+		return nil, fmt.Errorf("%w: regex is longer than %d bytes", ErrBadQuery, MaxRegexLength)
+	}
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadQuery, err)
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadQuery, err)
+	}
+	if len(prog.Inst) > maxRegexProgram {
+		return nil, fmt.Errorf("%w: regex is too complex", ErrBadQuery)
+	}
+	return regexp.Compile(pattern)
+}
@@ -0,0 +1,227 @@
+package blockchain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Issue codes reported by Validate.
+const (
+	IssueHashMismatch       = "hash_mismatch"
+	IssueLinkageBreak       = "linkage_break"
+	IssueInsufficientWork   = "insufficient_pow"
+	IssueBadMerkleRoot      = "bad_merkle_root"
+	IssueMedianTimePast     = "median_time_past"
+	IssueFutureTimestamp    = "future_timestamp"
+	IssueDifficultyMismatch = "difficulty_mismatch"
+	IssueGenesisMismatch    = "genesis_mismatch"
+	IssueHeightMismatch     = "height_mismatch"
+	IssueBadTimestamp       = "bad_timestamp"
+	IssueUnknownVersion     = "unknown_version"
+	IssueDuplicateTx        = "duplicate_transaction"
+)
+
+// Issue is one rule a block breaks.
+type Issue struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// BlockReport lists the issues found in one block.
+type BlockReport struct {
+	Index  int     `json:"index"`
+	Hash   string  `json:"hash"`
+	Valid  bool    `json:"valid"`
+	Issues []Issue `json:"issues,omitempty"`
+}
+
+// ValidationReport is the result of checking every block of a chain.
+// FirstInvalid is the position of the first bad block, or -1.
+type ValidationReport struct {
+	Valid        bool          `json:"valid"`
+	FirstInvalid int           `json:"first_invalid"`
+	Blocks       []BlockReport `json:"blocks"`
+}
+
+// chainRules are the parameters a chain is checked against.
+type chainRules struct {
+	difficulty    int
+	maxDifficulty int
+	// difficulties, if set, is the history each block's difficulty must
+	// reach.
+	difficulties []DifficultyChange
+	// genesisHash, if set, is the hash the first block must have.
+	genesisHash string
+	// Blocks may be stamped at most maxFutureDrift after now.
+	now            time.Time
+	maxFutureDrift time.Duration
+}
+
+func (bc *Blockchain) rulesLocked() chainRules {
+	return chainRules{
+		difficulty:     bc.Difficulty,
+		maxDifficulty:  bc.retarget.MaxDifficulty,
+		difficulties:   bc.difficulties,
+		genesisHash:    bc.genesisHash,
+		now:            bc.clock.Now(),
+		maxFutureDrift: bc.maxFutureDrift,
+	}
+}
+
+// Validate checks every block and reports what is wrong with each one.
+func (bc *Blockchain) Validate() ValidationReport {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	return validateChain(bc.Chain, bc.rulesLocked())
+}
+
+// ValidateChain checks a chain received from elsewhere against difficulty,
+// the fallback for blocks that do not record their own, and genesisHash
+// if it is not empty. Timestamps are checked against the system clock.
+func ValidateChain(chain []*Block, difficulty int, genesisHash string) ValidationReport {
+	return validateChain(chain, chainRules{
+		difficulty:     difficulty,
+		genesisHash:    genesisHash,
+		now:            SystemClock.Now(),
+		maxFutureDrift: DefaultMaxFutureDrift,
+	})
+}
+
+// ValidateChainAtLeast checks a chain that nothing vouches for, such as an
+// export: every block after the first must show at least minDifficulty,
+// whatever the block or the export claims, and the first must have hash
+// genesisHash.
+func ValidateChainAtLeast(chain []*Block, minDifficulty int, genesisHash string) ValidationReport {
+	return validateChain(chain, chainRules{
+		difficulty:     minDifficulty,
+		difficulties:   []DifficultyChange{{Height: 1, Difficulty: minDifficulty}},
+		genesisHash:    genesisHash,
+		now:            SystemClock.Now(),
+		maxFutureDrift: DefaultMaxFutureDrift,
+	})
+}
+
+func validateChain(chain []*Block, rules chainRules) ValidationReport {
+	report := ValidationReport{Valid: true, FirstInvalid: -1, Blocks: make([]BlockReport, 0, len(chain))}
+	blog := newBlogView(nil)
+	for i, b := range chain {
+		br := BlockReport{Index: b.Index, Hash: b.Hash, Issues: checkBlock(b, chain[:i], rules)}
+		br.Issues = append(br.Issues, blog.add(i, b)...)
+		br.Valid = len(br.Issues) == 0
+		if !br.Valid && report.Valid {
+			report.Valid = false
+			report.FirstInvalid = i
+		}
+		report.Blocks = append(report.Blocks, br)
+	}
+	return report
+}
+
+// checkBlock checks b as the successor of prior, the blocks before it.
+func checkBlock(b *Block, prior []*Block, rules chainRules) []Issue {
+	var issues []Issue
+	add := func(code, format string, args ...interface{}) {
+		issues = append(issues, Issue{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+	var prev *Block
+	if len(prior) > 0 {
+		prev = prior[len(prior)-1]
+	}
+
+	if prev == nil {
+		if b.Index != 0 || b.PrevHash != "0" {
+			add(IssueGenesisMismatch, "genesis block must have index 0 and previous hash \"0\"")
+		}
+		if rules.genesisHash != "" && b.Hash != rules.genesisHash {
+			add(IssueGenesisMismatch, "genesis hash %s, expected %s", short(b.Hash), short(rules.genesisHash))
+		}
+	} else if b.Index != prev.Index+1 {
+		add(IssueHeightMismatch, "height %d follows block #%d", b.Index, prev.Index)
+	}
+
+	if b.Version != BlockVersion {
+		add(IssueUnknownVersion, "block version %d is not supported, want %d", b.Version, BlockVersion)
+	}
+
+	if computed := b.calculateHash(); b.Hash != computed {
+		add(IssueHashMismatch, "stored hash %s, computed %s", short(b.Hash), short(computed))
+	}
+
+	if prev != nil && b.PrevHash != prev.Hash {
+		add(IssueLinkageBreak, "previous hash %s does not match block #%d hash %s", short(b.PrevHash), prev.Index, short(prev.Hash))
+	}
+
+	// A block may be mined above the difficulty in force at its height,
+	// never below it.
+	want, known := expectedDifficulty(rules.difficulties, len(prior))
+	diff := b.Difficulty
+	if diff == 0 {
+		diff = rules.difficulty
+		if known {
+			diff = want
+		}
+	}
+	switch {
+	case diff < 0:
+		add(IssueDifficultyMismatch, "difficulty %d is negative", diff)
+	case rules.maxDifficulty > 0 && diff > rules.maxDifficulty:
+		add(IssueDifficultyMismatch, "difficulty %d is above the maximum %d", diff, rules.maxDifficulty)
+	case known && diff < want:
+		add(IssueDifficultyMismatch, "difficulty %d is below the %d required at height %d", diff, want, len(prior))
+	case !strings.HasPrefix(b.Hash, strings.Repeat("0", diff)):
+		add(IssueInsufficientWork, "hash %s does not have %d leading zeros", short(b.Hash), diff)
+	}
+
+	if root := b.calculateMerkleRoot(); b.MerkleRoot != root {
+		add(IssueBadMerkleRoot, "stored merkle root %s, computed %s", short(b.MerkleRoot), short(root))
+	}
+
+	// The Merkle tree pads odd levels by repeating the last leaf, so a
+	// block with a repeated transaction can share a root with one
+	// without it. Blocks commit to their transactions only through that
+	// root and must not repeat any.
+	seen := make(map[string]bool, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		if seen[tx] {
+			add(IssueDuplicateTx, "transaction %d repeats an earlier one", i)
+			break
+		}
+		seen[tx] = true
+	}
+
+	return append(issues, checkTimestamp(b, prior, rules)...)
+}
+
+// checkTimestamp applies the consensus time rules: a block must be stamped
+// after the median time past of the blocks before it, and no further than
+// maxFutureDrift ahead of the node's clock.
+func checkTimestamp(b *Block, prior []*Block, rules chainRules) []Issue {
+	const layout = "2006-01-02 15:04:05.000"
+	if b.Timestamp.IsZero() {
+		return []Issue{{Code: IssueBadTimestamp, Message: "block has no timestamp"}}
+	}
+	var issues []Issue
+	if len(prior) > 0 {
+		if mtp := medianTimePast(prior); !b.Timestamp.After(mtp) {
+			issues = append(issues, Issue{Code: IssueMedianTimePast, Message: fmt.Sprintf("timestamp %s is not after the median time past %s", b.Timestamp.Format(layout), mtp.Format(layout))})
+		}
+	}
+	if rules.maxFutureDrift > 0 && !rules.now.IsZero() {
+		if ahead := b.Timestamp.Sub(rules.now); ahead > rules.maxFutureDrift {
+			issues = append(issues, Issue{Code: IssueFutureTimestamp, Message: fmt.Sprintf("timestamp %s is %v ahead of the node clock, more than the allowed %v", b.Timestamp.Format(layout), ahead.Round(time.Second), rules.maxFutureDrift)})
+		}
+	}
+	return issues
+}
+
+func short(hash string) string {
+	if len(hash) > 16 {
+		return hash[:16] + "..."
+	}
+	if hash == "" {
+		return `""`
+	}
+	return hash
+}
@@ -0,0 +1,285 @@
+package blockchain
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// mineTx adds tx to bc and mines it into a block.
+func mineTx(t *testing.T, bc *Blockchain, tx string) *Block {
+	t.Helper()
+	if err := bc.AddTransaction(tx); err != nil {
+		t.Fatalf("AddTransaction(%q): %v", tx, err)
+	}
+	b := bc.MineBlock()
+	if b == nil {
+		t.Fatalf("MineBlock returned nil for %q", tx)
+	}
+	return b
+}
+
+// forgeBlock mines a block with txs on top of bc's tip at difficulty,
+// bypassing SubmitBlock.
+func forgeBlock(bc *Blockchain, difficulty int, txs ...string) *Block {
+	tip := bc.GetLatestBlock()
+	b := NewBlock(bc.Clock(), tip.Index+1, txs, tip.Hash)
+	b.Mine(difficulty)
+	return b
+}
+
+func hasIssue(br BlockReport, code string) bool {
+	for _, issue := range br.Issues {
+		if issue.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateRejectsLowDifficultyBlock(t *testing.T) {
+	bc := NewBlockchain(2)
+	mineTx(t, bc, "first")
+	if !bc.IsValid() {
+		t.Fatal("honestly mined chain is invalid")
+	}
+
+	forged := forgeBlock(bc, 1, "cheap")
+	bc.Chain = append(bc.Chain, forged)
+
+	report := bc.Validate()
+	if report.Valid {
+		t.Fatal("chain with a difficulty 1 block is valid")
+	}
+	if report.FirstInvalid != forged.Index {
+		t.Fatalf("FirstInvalid = %d, want %d", report.FirstInvalid, forged.Index)
+	}
+	if br := report.Blocks[forged.Index]; !hasIssue(br, IssueDifficultyMismatch) {
+		t.Fatalf("issues = %+v, want %s", br.Issues, IssueDifficultyMismatch)
+	}
+}
+
+func TestSubmitBlockRejectsLowDifficulty(t *testing.T) {
+	bc := NewBlockchain(2)
+	if err := bc.AddTransaction("tx"); err != nil {
+		t.Fatal(err)
+	}
+	b := bc.NewBlockTemplate()
+	b.Mine(1)
+	if err := bc.SubmitBlock(b, 1, time.Millisecond); !errors.Is(err, ErrLowDifficulty) {
+		t.Fatalf("SubmitBlock = %v, want ErrLowDifficulty", err)
+	}
+	if n := len(bc.GetChain()); n != 1 {
+		t.Fatalf("chain has %d blocks, want 1", n)
+	}
+}
+
+func TestValidateFollowsDifficultyChanges(t *testing.T) {
+	bc := NewBlockchain(2)
+	mineTx(t, bc, "at two")
+	bc.SetDifficulty(1)
+	mineTx(t, bc, "at one")
+	bc.SetDifficulty(3)
+	mineTx(t, bc, "at three")
+	if report := bc.Validate(); !report.Valid {
+		t.Fatalf("chain is invalid: %+v", report)
+	}
+
+	// Lowering the difficulty later must not make a block mined at 1
+	// acceptable where 3 was required.
+	forged := forgeBlock(bc, 1, "cheap")
+	bc.Chain = append(bc.Chain, forged)
+	bc.SetDifficulty(1)
+	report := bc.Validate()
+	if report.Valid || report.FirstInvalid != forged.Index {
+		t.Fatalf("block below the difficulty in force: valid %t, first invalid %d", report.Valid, report.FirstInvalid)
+	}
+}
+
+func TestValidateAcceptsBlockAboveDifficulty(t *testing.T) {
+	bc := NewBlockchain(1)
+	mineTx(t, bc, "first")
+	bc.Chain = append(bc.Chain, forgeBlock(bc, 2, "harder"))
+	if report := bc.Validate(); !report.Valid {
+		t.Fatalf("block above the required difficulty is invalid: %+v", report)
+	}
+}
+
+func TestValidateFollowsRetargets(t *testing.T) {
+	bc := NewBlockchain(1)
+	bc.SetRetargetPolicy(RetargetPolicy{Interval: 2, TargetBlockTime: time.Hour, MaxDifficulty: 3})
+	for _, tx := range []string{"a", "b", "c", "d"} {
+		mineTx(t, bc, tx)
+	}
+	if d := bc.GetDifficulty(); d != 3 {
+		t.Fatalf("difficulty after two fast intervals = %d, want 3", d)
+	}
+	if report := bc.Validate(); !report.Valid {
+		t.Fatalf("retargeted chain is invalid: %+v", report)
+	}
+	bc.Chain = append(bc.Chain, forgeBlock(bc, 2, "stale difficulty"))
+	if bc.IsValid() {
+		t.Fatal("block mined at the difficulty before the retarget is valid")
+	}
+}
+
+func TestRestoreKeepsDifficultyHistory(t *testing.T) {
+	bc := NewBlockchain(3)
+	mineTx(t, bc, "at three")
+	bc.SetDifficulty(2)
+	mineTx(t, bc, "at two")
+
+	st, _ := bc.Snapshot()
+	restored, err := Restore(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restored.IsValid() {
+		t.Fatal("restored chain is invalid")
+	}
+	restored.Chain = append(restored.Chain, forgeBlock(restored, 1, "cheap"))
+	if restored.IsValid() {
+		t.Fatal("restored chain accepts a block below its difficulty")
+	}
+
+	// A state saved before the history was kept takes it from the blocks.
+	st.Difficulties = nil
+	legacy, err := Restore(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DifficultyChange{{Height: 0, Difficulty: 3}, {Height: 2, Difficulty: 2}}
+	if got := legacy.difficulties; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("rebuilt history = %+v, want %+v", got, want)
+	}
+}
+
+func TestValidateRejectsOtherVersions(t *testing.T) {
+	for _, version := range []int{0, BlockVersion + 1} {
+		bc := NewBlockchain(1)
+		tip := bc.GetLatestBlock()
+		b := NewBlock(bc.Clock(), tip.Index+1, []string{"old format"}, tip.Hash)
+		b.Version = version
+		b.Mine(1)
+		bc.Chain = append(bc.Chain, b)
+
+		report := bc.Validate()
+		if report.Valid || !hasIssue(report.Blocks[1], IssueUnknownVersion) {
+			t.Errorf("version %d block: issues %+v, want %s", version, report.Blocks[1].Issues, IssueUnknownVersion)
+		}
+	}
+}
+
+func TestValidateBlockRules(t *testing.T) {
+	forgeAt := func(clock Clock, height int, prevHash string, txs ...string) *Block {
+		b := NewBlock(clock, height, txs, prevHash)
+		b.Mine(1)
+		return b
+	}
+	tests := []struct {
+		name  string
+		forge func(bc *Blockchain, tip *Block) *Block
+		code  string
+	}{
+		{"skipped height", func(bc *Blockchain, tip *Block) *Block {
+			return forgeAt(bc.Clock(), tip.Index+2, tip.Hash, "tx")
+		}, IssueHeightMismatch},
+		{"wrong previous hash", func(bc *Blockchain, tip *Block) *Block {
+			return forgeAt(bc.Clock(), tip.Index+1, TxID("elsewhere"), "tx")
+		}, IssueLinkageBreak},
+		{"tampered header", func(bc *Blockchain, tip *Block) *Block {
+			b := forgeBlock(bc, 1, "tx")
+			b.Nonce++
+			return b
+		}, IssueHashMismatch},
+		{"tampered transaction", func(bc *Blockchain, tip *Block) *Block {
+			b := forgeBlock(bc, 1, "tx")
+			b.Transactions = []string{"other tx"}
+			return b
+		}, IssueBadMerkleRoot},
+		{"repeated transaction", func(bc *Blockchain, tip *Block) *Block {
+			return forgeBlock(bc, 1, "tx", "tx")
+		}, IssueDuplicateTx},
+		{"not after the median time past", func(bc *Blockchain, tip *Block) *Block {
+			return forgeAt(OffsetClock{Base: SystemClock, Offset: -time.Hour}, tip.Index+1, tip.Hash, "tx")
+		}, IssueMedianTimePast},
+		{"too far ahead of the clock", func(bc *Blockchain, tip *Block) *Block {
+			return forgeAt(OffsetClock{Base: SystemClock, Offset: DefaultMaxFutureDrift + time.Hour}, tip.Index+1, tip.Hash, "tx")
+		}, IssueFutureTimestamp},
+		{"no timestamp", func(bc *Blockchain, tip *Block) *Block {
+			b := NewBlock(bc.Clock(), tip.Index+1, []string{"tx"}, tip.Hash)
+			b.Timestamp = time.Time{}
+			b.clock = nil
+			b.Mine(1)
+			return b
+		}, IssueBadTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := NewBlockchain(1)
+			mineTx(t, bc, "first")
+			b := tt.forge(bc, bc.GetLatestBlock())
+			bc.Chain = append(bc.Chain, b)
+
+			report := bc.Validate()
+			last := report.Blocks[len(report.Blocks)-1]
+			if report.Valid || report.FirstInvalid != len(bc.Chain)-1 || !hasIssue(last, tt.code) {
+				t.Fatalf("valid %t, first invalid %d, issues %+v; want %s in the last block", report.Valid, report.FirstInvalid, last.Issues, tt.code)
+			}
+		})
+	}
+}
+
+func TestValidatePinnedGenesis(t *testing.T) {
+	bc := NewBlockchain(1)
+	bc.SetGenesisHash(bc.GenesisHash())
+	if !bc.IsValid() {
+		t.Fatal("chain with its own genesis hash pinned is invalid")
+	}
+	bc.SetGenesisHash(TxID("another chain"))
+	report := bc.Validate()
+	if report.Valid || report.FirstInvalid != 0 || !hasIssue(report.Blocks[0], IssueGenesisMismatch) {
+		t.Fatalf("issues %+v, want %s in the genesis block", report.Blocks[0].Issues, IssueGenesisMismatch)
+	}
+}
+
+func TestSubmitBlockRejectsFutureTimestamp(t *testing.T) {
+	bc := NewBlockchain(1)
+	if err := bc.AddTransaction("tx"); err != nil {
+		t.Fatal(err)
+	}
+	b := bc.NewBlockTemplate()
+	b.Timestamp = time.Now().Add(DefaultMaxFutureDrift + time.Hour)
+	b.Mine(1)
+	if err := bc.SubmitBlock(b, 1, time.Millisecond); !errors.Is(err, ErrBadTimestamp) {
+		t.Fatalf("SubmitBlock = %v, want ErrBadTimestamp", err)
+	}
+}
+
+func TestValidateChainAtLeast(t *testing.T) {
+	bc := NewBlockchain(1)
+	mineTx(t, bc, "first")
+	mineTx(t, bc, "second")
+	chain := bc.GetChain()
+	genesis := bc.GenesisHash()
+
+	if report := ValidateChainAtLeast(chain, 1, genesis); !report.Valid {
+		t.Fatalf("chain mined at difficulty 1 fails a minimum of 1: %+v", report)
+	}
+	// Each block names its own difficulty, 1, so only the minimum asked
+	// for can reject it.
+	report := ValidateChainAtLeast(chain, 5, genesis)
+	if report.Valid || report.FirstInvalid != 1 || !hasIssue(report.Blocks[1], IssueDifficultyMismatch) {
+		t.Fatalf("minimum of 5: valid %v from %d, want block 1 to fail with %s", report.Valid, report.FirstInvalid, IssueDifficultyMismatch)
+	}
+	if report := ValidateChainAtLeast(chain, 1, TxID("another chain")); report.Valid {
+		t.Fatal("chain with another genesis block is valid")
+	}
+}
@@ -0,0 +1,399 @@
+package config
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eshahhh/blogochain/internal/logging"
+)
+
+// Config is the server configuration. Values are resolved in increasing
+// precedence from defaults, the JSON config file, BLOGOCHAIN_* environment
+// variables and command-line flags.
+type Config struct {
+	Listen         string   `json:"listen"`
+	DataDir        string   `json:"data_dir"`
+	Difficulty     int      `json:"difficulty"`
+	GenesisHash    string   `json:"genesis_hash"`
+	Retarget       Retarget `json:"retarget"`
+	MiningThreads  int      `json:"mining_threads"`
+	StaticDir      string   `json:"static_dir"`
+	AllowedOrigins []string `json:"allowed_origins"`
+	TokensFile     string   `json:"tokens_file"`
+	AnonymousRole  string   `json:"anonymous_role"`
+	LogLevel       string   `json:"log_level"`
+	MaxTxSize      int      `json:"max_tx_size"`
+	MaxBlobSize    int      `json:"max_blob_size"`
+	Features       Features `json:"features"`
+	TrustedProxies []string `json:"trusted_proxies"`
+	Peers          []string `json:"peers"`
+	MaxPeerLag     int      `json:"max_peer_lag"`
+
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	SaveInterval    Duration `json:"save_interval"`
+	ClockOffset     Duration `json:"clock_offset"`
+	MaxFutureDrift  Duration `json:"max_future_drift"`
+	NotaryInterval  Duration `json:"notary_interval"`
+
+	// Path is the config file that was loaded, if any.
+	Path        string `json:"-"`
+	PrintConfig bool   `json:"-"`
+}
+
+type Retarget struct {
+	Policy          string   `json:"policy"`
+	Interval        int      `json:"interval"`
+	TargetBlockTime Duration `json:"target_block_time"`
+	MaxDifficulty   int      `json:"max_difficulty"`
+}
+
+type Features struct {
+	Mining            bool `json:"mining"`
+	DifficultyChanges bool `json:"difficulty_changes"`
+	Search            bool `json:"search"`
+}
+
+// Duration is a time.Duration written as a string such as "30s" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func Default() *Config {
+	return &Config{
+		Listen:        ":8080",
+		DataDir:       "data",
+		Difficulty:    1,
+		Retarget:      Retarget{Policy: "fixed", Interval: 10, TargetBlockTime: Duration(30 * time.Second)},
+		MiningThreads: 1,
+		LogLevel:      "info",
+		MaxTxSize:     1024,
+		MaxBlobSize:   16 << 20,
+		Features:      Features{Mining: true, DifficultyChanges: true, Search: true},
+		MaxPeerLag:    2,
+
+		ShutdownTimeout: Duration(10 * time.Second),
+		SaveInterval:    Duration(5 * time.Second),
+		MaxFutureDrift:  Duration(2 * time.Hour),
+		NotaryInterval:  Duration(10 * time.Second),
+	}
+}
+
+type setting struct {
+	name   string
+	usage  string
+	isBool bool
+	set    func(c *Config, v string) error
+}
+
+func intSetting(name, usage string, field func(c *Config) *int) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("not an integer: %q", v)
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+// listSetting takes a comma-separated list.
+func listSetting(name, usage string, field func(c *Config) *[]string) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, v string) error {
+		var list []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}}
+}
+
+func stringSetting(name, usage string, field func(c *Config) *string) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}}
+}
+
+func boolSetting(name, usage string, field func(c *Config) *bool) setting {
+	return setting{name: name, usage: usage, isBool: true, set: func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("not a boolean: %q", v)
+		}
+		*field(c) = b
+		return nil
+	}}
+}
+
+func durationSetting(name, usage string, field func(c *Config) *Duration) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = Duration(d)
+		return nil
+	}}
+}
+
+var settings = []setting{
+	stringSetting("listen", "address to listen on", func(c *Config) *string { return &c.Listen }),
+	stringSetting("datadir", "directory for chain and mempool data", func(c *Config) *string { return &c.DataDir }),
+	intSetting("difficulty", "initial mining difficulty (leading hex zeros)", func(c *Config) *int { return &c.Difficulty }),
+	stringSetting("genesis-hash", "refuse chains whose genesis block has a different hash", func(c *Config) *string { return &c.GenesisHash }),
+	stringSetting("retarget", "difficulty retarget policy: fixed or interval", func(c *Config) *string { return &c.Retarget.Policy }),
+	intSetting("retarget-interval", "blocks between difficulty adjustments", func(c *Config) *int { return &c.Retarget.Interval }),
+	durationSetting("target-block-time", "target time between blocks for retargeting", func(c *Config) *Duration { return &c.Retarget.TargetBlockTime }),
+	intSetting("max-difficulty", "upper bound for retargeting (0 for none)", func(c *Config) *int { return &c.Retarget.MaxDifficulty }),
+	intSetting("mining-threads", "worker goroutines per mining job", func(c *Config) *int { return &c.MiningThreads }),
+	stringSetting("static-dir", "serve the web UI from this directory instead of the embedded copy", func(c *Config) *string { return &c.StaticDir }),
+	listSetting("allowed-origins", "comma-separated WebSocket origins, or * for any", func(c *Config) *[]string { return &c.AllowedOrigins }),
+	stringSetting("tokens-file", "JSON file of API tokens", func(c *Config) *string { return &c.TokensFile }),
+	stringSetting("anonymous-role", "role for clients without a token", func(c *Config) *string { return &c.AnonymousRole }),
+	stringSetting("log-level", "debug, info, warn or error", func(c *Config) *string { return &c.LogLevel }),
+	intSetting("max-tx-size", "maximum transaction size in bytes", func(c *Config) *int { return &c.MaxTxSize }),
+	intSetting("max-blob-size", "maximum attachment upload size in bytes", func(c *Config) *int { return &c.MaxBlobSize }),
+	boolSetting("feature-mining", "allow mine_block requests", func(c *Config) *bool { return &c.Features.Mining }),
+	boolSetting("feature-difficulty-changes", "allow set_difficulty requests", func(c *Config) *bool { return &c.Features.DifficultyChanges }),
+	boolSetting("feature-search", "allow search requests", func(c *Config) *bool { return &c.Features.Search }),
+	listSetting("trusted-proxies", "comma-separated addresses or CIDR ranges of proxies whose X-Forwarded-For is believed", func(c *Config) *[]string { return &c.TrustedProxies }),
+	listSetting("peers", "comma-separated base URLs of nodes readiness compares heights with", func(c *Config) *[]string { return &c.Peers }),
+	intSetting("max-peer-lag", "blocks the chain may trail the highest peer and stay ready", func(c *Config) *int { return &c.MaxPeerLag }),
+	durationSetting("shutdown-timeout", "how long to wait for clients and mining on shutdown", func(c *Config) *Duration { return &c.ShutdownTimeout }),
+	durationSetting("save-interval", "how often to write the chain and mempool to disk", func(c *Config) *Duration { return &c.SaveInterval }),
+	durationSetting("clock-offset", "correction added to the system clock for block timestamps", func(c *Config) *Duration { return &c.ClockOffset }),
+	durationSetting("max-future-drift", "how far ahead of the clock a block may be stamped (0 for no limit)", func(c *Config) *Duration { return &c.MaxFutureDrift }),
+	durationSetting("notary-interval", "how often queued document hashes are committed to the chain", func(c *Config) *Duration { return &c.NotaryInterval }),
+}
+
+// EnvName is the environment variable for a flag, e.g. BLOGOCHAIN_LOG_LEVEL
+// for --log-level.
+func EnvName(flagName string) string {
+	return "BLOGOCHAIN_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Load resolves the configuration from args (without the program name) and
+// getenv. The config file comes from --config or BLOGOCHAIN_CONFIG.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	var path string
+	fs.StringVar(&path, "config", "", "JSON config file (env "+EnvName("config")+")")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print the effective configuration and exit")
+
+	type flagValue struct {
+		s *setting
+		v string
+	}
+	var fromFlags []flagValue
+	for i := range settings {
+		s := &settings[i]
+		usage := fmt.Sprintf("%s (env %s)", s.usage, EnvName(s.name))
+		record := func(v string) error {
+			fromFlags = append(fromFlags, flagValue{s, v})
+			return nil
+		}
+		if s.isBool {
+			fs.BoolFunc(s.name, usage, record)
+		} else {
+			fs.Func(s.name, usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if path == "" {
+		path = getenv(EnvName("config"))
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range settings {
+		s := &settings[i]
+		if v := getenv(EnvName(s.name)); v != "" {
+			if err := s.set(cfg, v); err != nil {
+				return nil, fmt.Errorf("%s: %w", EnvName(s.name), err)
+			}
+		}
+	}
+	for _, fv := range fromFlags {
+		if err := fv.s.set(cfg, fv.v); err != nil {
+			return nil, fmt.Errorf("--%s: %w", fv.s.name, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	c.Path = path
+	return nil
+}
+
+var roles = []string{"none", "viewer", "submitter", "miner", "admin"}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		add("listen: %v", err)
+	}
+	if c.DataDir == "" {
+		add("data_dir: must not be empty")
+	}
+	if c.Difficulty < 0 || c.Difficulty > 64 {
+		add("difficulty: %d is outside 0..64", c.Difficulty)
+	}
+	switch c.Retarget.Policy {
+	case "fixed":
+	case "interval":
+		if c.Retarget.Interval <= 0 {
+			add("retarget.interval: must be positive for the interval policy")
+		}
+		if c.Retarget.TargetBlockTime <= 0 {
+			add("retarget.target_block_time: must be positive for the interval policy")
+		}
+	default:
+		add("retarget.policy: %q is not fixed or interval", c.Retarget.Policy)
+	}
+	if c.GenesisHash != "" {
+		if _, err := hex.DecodeString(c.GenesisHash); err != nil || len(c.GenesisHash) != 64 || strings.ToLower(c.GenesisHash) != c.GenesisHash {
+			add("genesis_hash: %q is not a 64-character lowercase hex hash", c.GenesisHash)
+		}
+	}
+	if c.Retarget.MaxDifficulty < 0 || c.Retarget.MaxDifficulty > 64 {
+		add("retarget.max_difficulty: %d is outside 0..64", c.Retarget.MaxDifficulty)
+	}
+	if c.MiningThreads < 1 || c.MiningThreads > 256 {
+		add("mining_threads: %d is outside 1..256", c.MiningThreads)
+	}
+	if c.StaticDir != "" {
+		if fi, err := os.Stat(c.StaticDir); err != nil {
+			add("static_dir: %v", err)
+		} else if !fi.IsDir() {
+			add("static_dir: %s is not a directory", c.StaticDir)
+		}
+	}
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			continue
+		}
+		if u, err := url.Parse(o); err != nil || u.Scheme == "" || u.Host == "" {
+			add("allowed_origins: %q is not an origin like https://example.com", o)
+		}
+	}
+	if c.TokensFile != "" {
+		if _, err := os.Stat(c.TokensFile); err != nil {
+			add("tokens_file: %v", err)
+		}
+	}
+	if c.AnonymousRole != "" && !contains(roles, strings.ToLower(c.AnonymousRole)) {
+		add("anonymous_role: %q is not one of %s", c.AnonymousRole, strings.Join(roles, ", "))
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		add("log_level: %v", err)
+	}
+	if c.MaxTxSize <= 0 {
+		add("max_tx_size: must be positive")
+	}
+	if c.MaxBlobSize <= 0 {
+		add("max_blob_size: must be positive")
+	}
+	for _, p := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(p); err != nil && net.ParseIP(p) == nil {
+			add("trusted_proxies: %q is not an IP address or CIDR range", p)
+		}
+	}
+	for _, p := range c.Peers {
+		if u, err := url.Parse(p); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("peers: %q is not a URL like http://node2:8080", p)
+		}
+	}
+	if c.MaxPeerLag < 0 {
+		add("max_peer_lag: must not be negative")
+	}
+	if c.ShutdownTimeout <= 0 {
+		add("shutdown_timeout: must be positive")
+	}
+	if c.SaveInterval <= 0 {
+		add("save_interval: must be positive")
+	}
+	if c.MaxFutureDrift < 0 {
+		add("max_future_drift: must not be negative")
+	}
+	if c.NotaryInterval <= 0 {
+		add("notary_interval: must be positive")
+	}
+
+	return errors.Join(errs...)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Write prints the configuration as indented JSON.
+func (c *Config) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c)
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l >= 0 && int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+}
+
+var current atomic.Int32
+
+func init() {
+	current.Store(int32(LevelInfo))
+}
+
+func SetLevel(l Level) {
+	current.Store(int32(l))
+}
+
+func Enabled(l Level) bool {
+	return int32(l) >= current.Load()
+}
+
+func logf(l Level, format string, args ...interface{}) {
+	if Enabled(l) {
+		log.Output(3, fmt.Sprintf(format, args...))
+	}
+}
+
+func Debugf(format string, args ...interface{}) { logf(LevelDebug, format, args...) }
+func Infof(format string, args ...interface{})  { logf(LevelInfo, format, args...) }
+func Warnf(format string, args ...interface{})  { logf(LevelWarn, format, args...) }
+func Errorf(format string, args ...interface{}) { logf(LevelError, format, args...) }
@@ -0,0 +1,304 @@
+// Package markdown renders the Markdown subset allowed in blog posts:
+// headings, paragraphs, emphasis, links, inline and fenced code, lists and
+// images and links to attachments referenced by content hash.
+//
+// The renderer never copies markup from its input. Every piece of text is
+// escaped and the only tags emitted are the ones it writes itself, so raw
+// HTML in a post shows up as text and cannot inject script. Links are kept
+// only for http, https and mailto URLs and for paths on this server.
+package markdown
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"strings"
+)
+
+// AttachmentPrefix is the path attachments are served from: an image
+// written ![alt](sha256:<hex>) becomes <img src="/blobs/<hex>">, and a
+// link to sha256:<hex> links there.
+const AttachmentPrefix = "/blobs/"
+
+// HTML renders src.
+func HTML(src string) template.HTML {
+	var b strings.Builder
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			i++
+		case strings.HasPrefix(trimmed, "```"):
+			i = codeBlock(&b, lines, i)
+		case headingLevel(trimmed) > 0:
+			level := headingLevel(trimmed)
+			text := strings.TrimSpace(strings.TrimRight(trimmed[level:], "#"))
+			tag := "h" + string(rune('0'+level))
+			b.WriteString("<" + tag + ">" + inline(text) + "</" + tag + ">\n")
+			i++
+		case listMarker(trimmed) != "":
+			i = list(&b, lines, i)
+		default:
+			i = paragraph(&b, lines, i)
+		}
+	}
+	return template.HTML(b.String())
+}
+
+func headingLevel(line string) int {
+	n := 0
+	for n < len(line) && line[n] == '#' {
+		n++
+	}
+	if n == 0 || n > 6 || (n < len(line) && line[n] != ' ') {
+		return 0
+	}
+	return n
+}
+
+// listMarker returns "ul" or "ol" if line starts a list item.
+func listMarker(line string) string {
+	if len(line) >= 2 && strings.ContainsRune("-*+", rune(line[0])) && line[1] == ' ' {
+		return "ul"
+	}
+	n := 0
+	for n < len(line) && line[n] >= '0' && line[n] <= '9' {
+		n++
+	}
+	if n > 0 && n < 10 && strings.HasPrefix(line[n:], ". ") {
+		return "ol"
+	}
+	return ""
+}
+
+func itemText(line string) string {
+	if listMarker(line) == "ul" {
+		return line[2:]
+	}
+	return line[strings.Index(line, ". ")+2:]
+}
+
+func codeBlock(b *strings.Builder, lines []string, i int) int {
+	var code []string
+	i++
+	for ; i < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "```") {
+			i++
+			break
+		}
+		code = append(code, lines[i])
+	}
+	b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+	return i
+}
+
+// list renders consecutive items of the same kind of list. A line that
+// does not start an item continues the previous one.
+func list(b *strings.Builder, lines []string, i int) int {
+	kind := listMarker(strings.TrimSpace(lines[i]))
+	var items []string
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || headingLevel(trimmed) > 0 || strings.HasPrefix(trimmed, "```") {
+			break
+		}
+		switch listMarker(trimmed) {
+		case kind:
+			items = append(items, itemText(trimmed))
+		case "":
+			items[len(items)-1] += " " + trimmed
+		default:
+			return finishList(b, kind, items, i)
+		}
+	}
+	return finishList(b, kind, items, i)
+}
+
+func finishList(b *strings.Builder, kind string, items []string, i int) int {
+	b.WriteString("<" + kind + ">\n")
+	for _, item := range items {
+		b.WriteString("<li>" + inline(item) + "</li>\n")
+	}
+	b.WriteString("</" + kind + ">\n")
+	return i
+}
+
+func paragraph(b *strings.Builder, lines []string, i int) int {
+	var text []string
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || headingLevel(trimmed) > 0 || listMarker(trimmed) != "" || strings.HasPrefix(trimmed, "```") {
+			break
+		}
+		text = append(text, trimmed)
+	}
+	b.WriteString("<p>" + inline(strings.Join(text, "\n")) + "</p>\n")
+	return i
+}
+
+// inline renders code spans, images, links, strong and emphasised text
+// and backslash escapes within s, escaping everything else.
+func inline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_[]()!#+-.", s[i+1]) >= 0:
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+		case c == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end >= 0 {
+				b.WriteString("<code>" + html.EscapeString(s[i+1:i+1+end]) + "</code>")
+				i += end + 2
+				continue
+			}
+		case c == '!' && strings.HasPrefix(s[i+1:], "["):
+			if text, target, n := linkParts(s[i+1:]); n > 0 {
+				b.WriteString(image(text, target))
+				i += n + 1
+				continue
+			}
+		case c == '[':
+			if text, target, n := linkParts(s[i:]); n > 0 {
+				b.WriteString(link(text, target))
+				i += n
+				continue
+			}
+		case strings.HasPrefix(s[i:], "**") || strings.HasPrefix(s[i:], "__"):
+			delim := s[i : i+2]
+			if end := strings.Index(s[i+2:], delim); end > 0 && s[i+2] != ' ' && s[i+1+end] != ' ' {
+				b.WriteString("<strong>" + inline(s[i+2:i+2+end]) + "</strong>")
+				i += end + 4
+				continue
+			}
+		case (c == '*' || c == '_') && i+1 < len(s) && s[i+1] != ' ' && (c == '*' || i == 0 || !isWordByte(s[i-1])):
+			if end := closingEmphasis(s[i+1:], c); end > 0 {
+				b.WriteString("<em>" + inline(s[i+1:i+1+end]) + "</em>")
+				i += end + 2
+				continue
+			}
+		}
+		b.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+	return b.String()
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// closingEmphasis finds the delimiter closing single-character emphasis
+// in s, skipping doubled delimiters, or returns -1.
+func closingEmphasis(s string, delim byte) int {
+	for j := 0; j < len(s); j++ {
+		if s[j] != delim {
+			continue
+		}
+		if j+1 < len(s) && s[j+1] == delim {
+			j++
+			continue
+		}
+		if s[j-1] != ' ' && (delim == '*' || j+1 == len(s) || !isWordByte(s[j+1])) {
+			return j
+		}
+	}
+	return -1
+}
+
+// linkParts parses "[text](target)" at the start of s and returns its
+// parts and length, or n == 0 if s does not start with one.
+func linkParts(s string) (text, target string, n int) {
+	depth := 0
+	for j := 0; j < len(s); j++ {
+		switch s[j] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				if !strings.HasPrefix(s[j+1:], "(") {
+					return "", "", 0
+				}
+				end := closingParen(s[j+2:])
+				if end < 0 {
+					return "", "", 0
+				}
+				return s[1:j], strings.TrimSpace(s[j+2 : j+2+end]), j + 3 + end
+			}
+		}
+	}
+	return "", "", 0
+}
+
+// closingParen finds the ")" ending a link target, allowing balanced
+// parentheses inside it, or returns -1.
+func closingParen(s string) int {
+	depth := 0
+	for j := 0; j < len(s); j++ {
+		switch s[j] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return j
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// link renders a link if target is a safe URL or an attachment, and just
+// its text if not.
+func link(text, target string) string {
+	href, ok := attachmentURL(target)
+	if !ok {
+		href, ok = safeURL(target)
+	}
+	if !ok {
+		return inline(text)
+	}
+	return `<a href="` + html.EscapeString(href) + `" rel="nofollow noopener">` + inline(text) + `</a>`
+}
+
+func safeURL(target string) (string, bool) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return u.String(), true
+	case "":
+		// Paths on this server only; "//host" would leave it.
+		if u.Host == "" && (strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//") || strings.HasPrefix(target, "#")) {
+			return u.String(), true
+		}
+	}
+	return "", false
+}
+
+// attachmentURL returns where the attachment target, written
+// sha256:<hex>, is served from.
+func attachmentURL(target string) (string, bool) {
+	hash := strings.ToLower(strings.TrimPrefix(target, "sha256:"))
+	if !strings.HasPrefix(target, "sha256:") || len(hash) != 64 || strings.Trim(hash, "0123456789abcdef") != "" {
+		return "", false
+	}
+	return AttachmentPrefix + hash, true
+}
+
+// image renders an attachment referenced as sha256:<hex>. Other sources
+// would let a post load content from elsewhere, so they show only the alt
+// text.
+func image(alt, target string) string {
+	src, ok := attachmentURL(target)
+	if !ok {
+		return html.EscapeString(alt)
+	}
+	return `<img src="` + src + `" alt="` + html.EscapeString(alt) + `">`
+}
@@ -0,0 +1,59 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+const hash = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		// Raw HTML is text wherever it appears.
+		{"script tag", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"html in a heading", "# <i>h</i>", "<h1>&lt;i&gt;h&lt;/i&gt;</h1>\n"},
+		{"html in a list", "- <img src=x onerror=alert(1)>\n- b", "<ul>\n<li>&lt;img src=x onerror=alert(1)&gt;</li>\n<li>b</li>\n</ul>\n"},
+		{"html in emphasis", "**<b>**", "<p><strong>&lt;b&gt;</strong></p>\n"},
+		{"html in a code span", "`<b>`", "<p><code>&lt;b&gt;</code></p>\n"},
+		{"html in a code block", "```\n<script>\n```", "<pre><code>&lt;script&gt;</code></pre>\n"},
+
+		// Unsafe link targets keep only their text.
+		{"javascript link", "[x](javascript:alert(1))", "<p>x</p>\n"},
+		{"javascript link in mixed case", "[x](JaVaScRiPt:alert(1))", "<p>x</p>\n"},
+		{"javascript link after a tab", "[x](\tjavascript:alert(1))", "<p>x</p>\n"},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD4=)", "<p>x</p>\n"},
+		{"vbscript link", "[x](vbscript:msgbox(1))", "<p>x</p>\n"},
+		{"protocol-relative link", "[x](//evil.example/a)", "<p>x</p>\n"},
+		{"relative link", "[x](evil.example)", "<p>x</p>\n"},
+		{"backslash path", `[x](/\evil.example/a)`, `<p><a href="/%5Cevil.example/a" rel="nofollow noopener">x</a></p>` + "\n"},
+
+		// Safe links, with quotes kept out of the attribute.
+		{"https link", "[x](https://example.com/a?b=1&c=2)", `<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener">x</a></p>` + "\n"},
+		{"quote in href", `[x](https://example.com/"onmouseover="alert(1))`, `<p><a href="https://example.com/%22onmouseover=%22alert%281%29" rel="nofollow noopener">x</a></p>` + "\n"},
+		{"quote in link text", `[a"b](/posts)`, `<p><a href="/posts" rel="nofollow noopener">a&#34;b</a></p>` + "\n"},
+		{"mailto link", "[m](mailto:a@example.com)", `<p><a href="mailto:a@example.com" rel="nofollow noopener">m</a></p>` + "\n"},
+		{"fragment link", "[top](#top)", `<p><a href="#top" rel="nofollow noopener">top</a></p>` + "\n"},
+		{"attachment link", "[file](sha256:" + hash + ")", `<p><a href="/blobs/` + hash + `" rel="nofollow noopener">file</a></p>` + "\n"},
+
+		// Images only load attachments.
+		{"attachment image", "![cat](sha256:" + hash + ")", `<p><img src="/blobs/` + hash + `" alt="cat"></p>` + "\n"},
+		{"quotes in alt", `![a" onerror="alert(1)](sha256:` + hash + ")", `<p><img src="/blobs/` + hash + `" alt="a&#34; onerror=&#34;alert(1)"></p>` + "\n"},
+		{"remote image", "![alt](https://evil.example/x.png)", "<p>alt</p>\n"},
+		{"local path image", "![alt](/blobs/" + hash + ")", "<p>alt</p>\n"},
+		{"javascript image", "![alt](javascript:alert(1))", "<p>alt</p>\n"},
+		{"short hash image", "![alt](sha256:abc)", "<p>alt</p>\n"},
+		{"non-hex hash image", "![alt](sha256:" + strings.Repeat("g", 64) + ")", "<p>alt</p>\n"},
+		{"uppercase hash image", "![alt](sha256:" + strings.ToUpper(hash) + ")", `<p><img src="/blobs/` + hash + `" alt="alt"></p>` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(HTML(tt.src)); got != tt.want {
+				t.Errorf("HTML(%q)\n got %q\nwant %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+// Package notary proves that documents existed at a point in time. It
+// collects document hashes, commits each batch of them to the chain as the
+// Merkle root of a single transaction, and issues receipts that can be
+// checked against a copy of the chain without trusting the server.
+package notary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+	"github.com/eshahhh/blogochain/internal/logging"
+)
+
+// TxNotarize is the type of batch transactions.
+const TxNotarize = "notarize"
+
+const (
+	// maxBatch is the most hashes committed by one transaction.
+	maxBatch = 4096
+	// maxQueued is the most hashes waiting for a batch.
+	maxQueued = 10 * maxBatch
+)
+
+// Statuses of a submitted hash.
+const (
+	StatusQueued    = "queued"
+	StatusCommitted = "committed"
+	StatusConfirmed = "confirmed"
+)
+
+var (
+	ErrBadHash   = errors.New("document hash must be 64 hex digits (SHA-256)")
+	ErrQueueFull = errors.New("too many document hashes waiting; try again shortly")
+	// ErrPending is returned for receipts whose batch is not mined yet.
+	ErrPending = errors.New("receipt not ready")
+)
+
+// Batch is a set of document hashes committed by one transaction.
+type Batch struct {
+	Root   string    `json:"root"`
+	TxID   string    `json:"tx_id"`
+	Hashes []string  `json:"hashes"`
+	Time   time.Time `json:"time"`
+}
+
+// Receipt shows that DocumentHash was committed to the chain: Path leads
+// from its leaf to BatchRoot, which transaction TxID in the block at
+// BlockHeight records.
+type Receipt struct {
+	DocumentHash string                 `json:"document_hash"`
+	BatchRoot    string                 `json:"batch_root"`
+	Path         []blockchain.ProofStep `json:"path"`
+	TxID         string                 `json:"tx_id"`
+	BlockHash    string                 `json:"block_hash"`
+	BlockHeight  int                    `json:"block_height"`
+	Timestamp    time.Time              `json:"timestamp"`
+}
+
+type batchTx struct {
+	Type  string `json:"type"`
+	Root  string `json:"root"`
+	Count int    `json:"count"`
+}
+
+// BatchTx returns the transaction committing to a batch with Merkle root
+// root of count hashes.
+func BatchTx(root string, count int) string {
+	b, _ := json.Marshal(batchTx{Type: TxNotarize, Root: root, Count: count})
+	return string(b)
+}
+
+// ParseBatchTx returns the batch root tx commits to, if it is a batch
+// transaction.
+func ParseBatchTx(tx string) (root string, ok bool) {
+	if blockchain.ParseTxMeta(tx).Type != TxNotarize {
+		return "", false
+	}
+	var t batchTx
+	if json.Unmarshal([]byte(tx), &t) != nil || !IsHash(t.Root) {
+		return "", false
+	}
+	return t.Root, true
+}
+
+// IsHash reports whether s is a lowercase hex SHA-256.
+func IsHash(s string) bool {
+	return len(s) == 64 && strings.Trim(s, "0123456789abcdef") == ""
+}
+
+// Notary queues document hashes and commits them to bc in batches. The
+// batches are handed to save whenever one is added, so receipts can still
+// be issued after a restart; hashes still queued are not saved.
+type Notary struct {
+	bc   *blockchain.Blockchain
+	save func([]Batch) error
+
+	mu      sync.Mutex
+	queue   []string
+	queued  map[string]bool
+	batches []Batch
+	// index maps each committed hash to its batch.
+	index map[string]int
+}
+
+// New returns a notary that issues receipts for the saved batches.
+func New(bc *blockchain.Blockchain, batches []Batch, save func([]Batch) error) *Notary {
+	n := &Notary{
+		bc:      bc,
+		save:    save,
+		queued:  make(map[string]bool),
+		batches: batches,
+		index:   make(map[string]int),
+	}
+	for i, b := range batches {
+		for _, h := range b.Hashes {
+			if _, ok := n.index[h]; !ok {
+				n.index[h] = i
+			}
+		}
+	}
+	return n
+}
+
+// Submit queues hash for the next batch and returns its status. A hash
+// that was submitted before is not queued again, so its receipt keeps the
+// earliest time.
+func (n *Notary) Submit(hash string) (string, error) {
+	hash = strings.ToLower(hash)
+	if !IsHash(hash) {
+		return "", ErrBadHash
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if status, ok := n.statusLocked(hash); ok {
+		return status, nil
+	}
+	if len(n.queue) >= maxQueued {
+		return "", ErrQueueFull
+	}
+	n.queue = append(n.queue, hash)
+	n.queued[hash] = true
+	return StatusQueued, nil
+}
+
+// Status returns the status of hash.
+func (n *Notary) Status(hash string) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	status, ok := n.statusLocked(strings.ToLower(hash))
+	if !ok {
+		return "", fmt.Errorf("document %s: %w", hash, blockchain.ErrNotFound)
+	}
+	return status, nil
+}
+
+func (n *Notary) statusLocked(hash string) (string, bool) {
+	if n.queued[hash] {
+		return StatusQueued, true
+	}
+	i, ok := n.index[hash]
+	if !ok {
+		return "", false
+	}
+	if _, err := n.bc.GetTransaction(n.batches[i].TxID); err != nil {
+		return StatusCommitted, true
+	}
+	return StatusConfirmed, true
+}
+
+// Commit puts the queued hashes, up to maxBatch of them, in a batch and
+// adds its transaction to the pending pool. First it resubmits any saved
+// batch whose transaction is neither mined nor pending, such as one that
+// was saved before the pool was and lost in a restart.
+func (n *Notary) Commit() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.resubmitLocked()
+	if len(n.queue) == 0 {
+		return nil
+	}
+	hashes := n.queue
+	if len(hashes) > maxBatch {
+		hashes = hashes[:maxBatch]
+	}
+	hashes = append([]string(nil), hashes...)
+	root := blockchain.NewMerkleTree(hashes).Root
+	tx := BatchTx(root, len(hashes))
+	if err := n.bc.AddTransaction(tx); err != nil {
+		return err
+	}
+
+	n.batches = append(n.batches, Batch{Root: root, TxID: blockchain.TxID(tx), Hashes: hashes, Time: time.Now().UTC()})
+	for _, h := range hashes {
+		n.index[h] = len(n.batches) - 1
+		delete(n.queued, h)
+	}
+	n.queue = n.queue[len(hashes):]
+	logging.Infof("[NOTARY] Committed %d document hashes in transaction %s", len(hashes), blockchain.TxID(tx))
+	return n.save(n.batches)
+}
+
+func (n *Notary) resubmitLocked() {
+	pending := make(map[string]bool)
+	for _, tx := range n.bc.GetPendingTransactions() {
+		pending[blockchain.TxID(tx)] = true
+	}
+	for _, b := range n.batches {
+		if pending[b.TxID] {
+			continue
+		}
+		if _, err := n.bc.GetTransaction(b.TxID); !errors.Is(err, blockchain.ErrNotFound) {
+			continue
+		}
+		tx := BatchTx(b.Root, len(b.Hashes))
+		if err := n.bc.AddTransaction(tx); err != nil {
+			logging.Errorf("[NOTARY] resubmitting transaction %s failed: %v", b.TxID, err)
+			continue
+		}
+		pending[b.TxID] = true
+		logging.Infof("[NOTARY] Resubmitted transaction %s, which was neither mined nor pending", b.TxID)
+	}
+}
+
+// Run commits the queue every interval until ctx is done.
+func (n *Notary) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := n.Commit(); err != nil {
+				logging.Errorf("[NOTARY] commit failed: %v", err)
+			}
+		}
+	}
+}
+
+// Receipt returns the receipt for hash once its batch is mined.
+func (n *Notary) Receipt(hash string) (Receipt, error) {
+	hash = strings.ToLower(hash)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.queued[hash] {
+		return Receipt{}, fmt.Errorf("%w: document %s is waiting for the next batch", ErrPending, hash)
+	}
+	i, ok := n.index[hash]
+	if !ok {
+		return Receipt{}, fmt.Errorf("document %s: %w", hash, blockchain.ErrNotFound)
+	}
+	batch := n.batches[i]
+	rec, err := n.bc.GetTransaction(batch.TxID)
+	if errors.Is(err, blockchain.ErrNotFound) {
+		return Receipt{}, fmt.Errorf("%w: batch transaction %s is not mined yet", ErrPending, batch.TxID)
+	}
+	if err != nil {
+		return Receipt{}, err
+	}
+	leaf := 0
+	for leaf < len(batch.Hashes) && batch.Hashes[leaf] != hash {
+		leaf++
+	}
+	return Receipt{
+		DocumentHash: hash,
+		BatchRoot:    batch.Root,
+		Path:         blockchain.NewMerkleTree(batch.Hashes).Proof(leaf),
+		TxID:         batch.TxID,
+		BlockHash:    rec.BlockHash,
+		BlockHeight:  rec.Height,
+		Timestamp:    rec.Timestamp,
+	}, nil
+}
+
+// Verify checks r against chain, a copy of the blockchain such as an
+// export: the document's leaf, the SHA-256 of its hex hash as with
+// transaction IDs, must lead to the batch root, and the block at
+// BlockHeight must have r's hash and timestamp and hold a transaction
+// committing to that root. Whether chain itself is valid is up to the
+// caller to check.
+func (r Receipt) Verify(chain []*blockchain.Block) error {
+	if !IsHash(r.DocumentHash) {
+		return ErrBadHash
+	}
+	if !blockchain.VerifyMerkleProof(blockchain.TxID(r.DocumentHash), r.BatchRoot, r.Path) {
+		return errors.New("the Merkle path does not lead from the document hash to the batch root")
+	}
+	if r.BlockHeight < 0 || r.BlockHeight >= len(chain) {
+		return fmt.Errorf("the chain has no block #%d", r.BlockHeight)
+	}
+	b := chain[r.BlockHeight]
+	if b.Hash != r.BlockHash {
+		return fmt.Errorf("block #%d has hash %s, not %s", r.BlockHeight, b.Hash, r.BlockHash)
+	}
+	if !b.Timestamp.Equal(r.Timestamp) {
+		return fmt.Errorf("block #%d was stamped %s, not %s", r.BlockHeight, b.Timestamp.Format(time.RFC3339), r.Timestamp.Format(time.RFC3339))
+	}
+	if blockchain.NewMerkleTree(b.Transactions).Root != b.MerkleRoot {
+		return fmt.Errorf("block #%d's transactions do not match its Merkle root", r.BlockHeight)
+	}
+	for _, tx := range b.Transactions {
+		if blockchain.TxID(tx) != r.TxID {
+			continue
+		}
+		if root, ok := ParseBatchTx(tx); !ok || root != r.BatchRoot {
+			return fmt.Errorf("transaction %s does not commit to batch root %s", r.TxID, r.BatchRoot)
+		}
+		return nil
+	}
+	return fmt.Errorf("block #%d does not contain transaction %s", r.BlockHeight, r.TxID)
+}
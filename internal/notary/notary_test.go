@@ -0,0 +1,70 @@
+package notary
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+)
+
+func TestMain(m *testing.M) {
+	blockchain.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// A batch saved before the pending pool was, and lost with it, must be
+// committed again rather than stay unmined for good.
+func TestCommitResubmitsLostBatch(t *testing.T) {
+	bc := blockchain.NewBlockchain(1)
+	var saved []Batch
+	n := New(bc, nil, func(b []Batch) error {
+		saved = append([]Batch(nil), b...)
+		return nil
+	})
+	hash := strings.Repeat("ab", 32)
+	if _, err := n.Submit(hash); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 {
+		t.Fatalf("saved %d batches, want 1", len(saved))
+	}
+
+	// Restart with the batches but without the pending pool.
+	bc.PendingTxs = nil
+	n = New(bc, saved, func([]Batch) error { return nil })
+	if err := n.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	pending := bc.GetPendingTransactions()
+	if len(pending) != 1 || blockchain.TxID(pending[0]) != saved[0].TxID {
+		t.Fatalf("pending %q, want the batch transaction %s", pending, saved[0].TxID)
+	}
+	if err := n.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(bc.GetPendingTransactions()) != 1 {
+		t.Fatal("a pending batch was resubmitted")
+	}
+
+	if bc.MineBlock() == nil {
+		t.Fatal("nothing mined")
+	}
+	if err := n.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(bc.GetPendingTransactions()) != 0 {
+		t.Fatal("a mined batch was resubmitted")
+	}
+	r, err := n.Receipt(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Verify(bc.GetChain()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,437 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	blobsDir = "blobs"
+	// ChunkSize is the largest file stored as a single object; larger ones
+	// are split into chunks of this size.
+	ChunkSize = 256 << 10
+	// treeFanout is the most children a tree object lists.
+	treeFanout = 1024
+	// treeMagic starts every tree object.
+	treeMagic = "blogochain-tree "
+	// treesDir holds tree objects, apart from chunks, so a chunk can never
+	// be read as a tree.
+	treesDir = "trees"
+	// maxTreeDepth is the most levels of trees above the chunks; Put needs
+	// three for a file of 256 TiB.
+	maxTreeDepth = 4
+	// BlobGracePeriod is how long GC keeps objects nothing refers to, so an
+	// attachment survives between its upload and the transaction that
+	// refers to it being mined.
+	BlobGracePeriod = 24 * time.Hour
+)
+
+var (
+	ErrBlobNotFound = errors.New("attachment not found")
+	// ErrBlobCorrupt is returned when a stored object no longer matches its
+	// hash.
+	ErrBlobCorrupt = errors.New("attachment is corrupt")
+)
+
+// Blobs is a content-addressed store of attachments. Every object is kept
+// in a file named by the hex SHA-256 of its contents. A file of up to
+// ChunkSize bytes is a single object, so its ID is its SHA-256. A larger
+// file is split into chunk objects listed by a tree object, and trees of
+// trees beyond treeFanout chunks; its ID is the hash of the root tree, so
+// every byte read can be checked against the ID.
+//
+// A tree object is the line "blogochain-tree <size>" followed by one line
+// "c <id> <size>" or "t <id> <size>" for each chunk or subtree. Trees are
+// kept under treesDir and only Put writes there, so an uploaded file that
+// looks like a tree is still served as it is.
+type Blobs struct {
+	dir string
+	// mu keeps GC from sweeping an object while an upload stores or
+	// refreshes it. It is held for one object at a time, never while the
+	// upload is read; objects stored earlier in an upload are new enough
+	// for GC's grace period to keep them.
+	mu sync.Mutex
+}
+
+// BlobInfo describes a stored attachment.
+type BlobInfo struct {
+	ID     string `json:"id"`
+	Size   int64  `json:"size"`
+	Chunks int    `json:"chunks"`
+}
+
+// Blobs returns the attachment store kept in the data directory.
+func (s *Store) Blobs() *Blobs {
+	return s.blobs
+}
+
+// IsBlobID reports whether id is a lowercase hex SHA-256.
+func IsBlobID(id string) bool {
+	if len(id) != 2*sha256.Size {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Blobs) path(id string, tree bool) string {
+	if tree {
+		return filepath.Join(b.dir, treesDir, id[:2], id)
+	}
+	return filepath.Join(b.dir, id[:2], id)
+}
+
+type treeEntry struct {
+	tree bool
+	id   string
+	size int64
+}
+
+// Put stores the contents of r and returns its ID. Objects that are
+// already stored are shared rather than written again.
+func (b *Blobs) Put(r io.Reader) (BlobInfo, error) {
+	var entries []treeEntry
+	var size int64
+	br := bufio.NewReader(r)
+	buf := make([]byte, ChunkSize)
+	for {
+		n, err := io.ReadFull(br, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return BlobInfo{}, err
+		}
+		last := err != nil
+		if !last {
+			// A full chunk may be the whole file.
+			if _, err := br.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return BlobInfo{}, err
+			}
+		}
+		if last && len(entries) == 0 {
+			// The file fits in one chunk, so it is stored as is.
+			id, err := b.writeObject(buf[:n], false)
+			return BlobInfo{ID: id, Size: int64(n), Chunks: 1}, err
+		}
+		if n > 0 {
+			id, err := b.writeObject(buf[:n], false)
+			if err != nil {
+				return BlobInfo{}, err
+			}
+			entries = append(entries, treeEntry{id: id, size: int64(n)})
+			size += int64(n)
+		}
+		if last {
+			break
+		}
+	}
+	chunks := len(entries)
+
+	for {
+		var level []treeEntry
+		for start := 0; start < len(entries); start += treeFanout {
+			end := start + treeFanout
+			if end > len(entries) {
+				end = len(entries)
+			}
+			e, err := b.writeTree(entries[start:end])
+			if err != nil {
+				return BlobInfo{}, err
+			}
+			level = append(level, e)
+		}
+		if len(level) == 1 {
+			return BlobInfo{ID: level[0].id, Size: size, Chunks: chunks}, nil
+		}
+		entries = level
+	}
+}
+
+func (b *Blobs) writeTree(children []treeEntry) (treeEntry, error) {
+	var size int64
+	for _, c := range children {
+		size += c.size
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s%d\n", treeMagic, size)
+	for _, c := range children {
+		kind := "c"
+		if c.tree {
+			kind = "t"
+		}
+		fmt.Fprintf(&buf, "%s %s %d\n", kind, c.id, c.size)
+	}
+	id, err := b.writeObject(buf.Bytes(), true)
+	return treeEntry{tree: true, id: id, size: size}, err
+}
+
+// writeObject stores data under its hash, among the trees if tree is set.
+// An object that already exists has its modification time refreshed so GC
+// counts it as new again.
+func (b *Blobs) writeObject(data []byte, tree bool) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:])
+	path := b.path(id, tree)
+	if _, err := os.Stat(path); err == nil {
+		now := time.Now()
+		return id, os.Chtimes(path, now, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	return id, writeFile(path, data)
+}
+
+// readObject returns the object id after checking it against its hash.
+func (b *Blobs) readObject(id string, tree bool) ([]byte, error) {
+	data, err := os.ReadFile(b.path(id, tree))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", id, ErrBlobNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != id {
+		return nil, fmt.Errorf("%s: %w", id, ErrBlobCorrupt)
+	}
+	return data, nil
+}
+
+// parseTree returns the size and children of a tree object, checking that
+// the children's sizes add up.
+func parseTree(id string, data []byte) (int64, []treeEntry, error) {
+	corrupt := fmt.Errorf("%s: malformed tree: %w", id, ErrBlobCorrupt)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	size, err := strconv.ParseInt(strings.TrimPrefix(lines[0], treeMagic), 10, 64)
+	if err != nil || len(lines) < 2 {
+		return 0, nil, corrupt
+	}
+	var total int64
+	entries := make([]treeEntry, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		f := strings.Fields(line)
+		if len(f) != 3 || (f[0] != "c" && f[0] != "t") || !IsBlobID(f[1]) {
+			return 0, nil, corrupt
+		}
+		n, err := strconv.ParseInt(f[2], 10, 64)
+		if err != nil || n < 0 {
+			return 0, nil, corrupt
+		}
+		entries = append(entries, treeEntry{tree: f[0] == "t", id: f[1], size: n})
+		total += n
+	}
+	if total != size {
+		return 0, nil, corrupt
+	}
+	return size, entries, nil
+}
+
+// Blob is an attachment opened for reading.
+type Blob struct {
+	ID   string
+	Size int64
+
+	b    *Blobs
+	data []byte
+	tree []treeEntry
+}
+
+// Open checks the root object of attachment id and returns it. The rest of
+// the attachment is checked as it is read.
+func (b *Blobs) Open(id string) (*Blob, error) {
+	data, err := b.readObject(id, true)
+	if errors.Is(err, ErrBlobNotFound) {
+		data, err = b.readObject(id, false)
+		if err != nil {
+			return nil, err
+		}
+		return &Blob{ID: id, Size: int64(len(data)), b: b, data: data}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	size, entries, err := parseTree(id, data)
+	if err != nil {
+		return nil, err
+	}
+	return &Blob{ID: id, Size: size, b: b, tree: entries}, nil
+}
+
+// Head returns up to the first n bytes of the attachment.
+func (bl *Blob) Head(n int) ([]byte, error) {
+	var buf bytes.Buffer
+	w := &limitedWriter{w: &buf, n: n}
+	_, err := bl.WriteTo(w)
+	if err != nil && err != errWriterFull {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo writes the attachment to w, checking each object before it is
+// written. If a later object is missing or corrupt, the error is returned
+// after the data before it has been written.
+func (bl *Blob) WriteTo(w io.Writer) (int64, error) {
+	if bl.tree == nil {
+		n, err := w.Write(bl.data)
+		return int64(n), err
+	}
+	return bl.b.writeTreeTo(w, bl.tree, 1)
+}
+
+// writeTreeTo writes the objects listed by a tree depth levels below the
+// root. Trees deeper than Put makes and chunks larger than ChunkSize are
+// corrupt.
+func (b *Blobs) writeTreeTo(w io.Writer, entries []treeEntry, depth int) (int64, error) {
+	var written int64
+	for _, e := range entries {
+		if e.tree && depth >= maxTreeDepth {
+			return written, fmt.Errorf("%s: trees nested more than %d deep: %w", e.id, maxTreeDepth, ErrBlobCorrupt)
+		}
+		if !e.tree && e.size > ChunkSize {
+			return written, fmt.Errorf("%s: chunk larger than %d bytes: %w", e.id, ChunkSize, ErrBlobCorrupt)
+		}
+		data, err := b.readObject(e.id, e.tree)
+		if err != nil {
+			return written, err
+		}
+		if e.tree {
+			size, children, err := parseTree(e.id, data)
+			if err != nil {
+				return written, err
+			}
+			if size != e.size {
+				return written, fmt.Errorf("%s: size does not match its parent: %w", e.id, ErrBlobCorrupt)
+			}
+			n, err := b.writeTreeTo(w, children, depth+1)
+			written += n
+			if err != nil {
+				return written, err
+			}
+			continue
+		}
+		if int64(len(data)) != e.size {
+			return written, fmt.Errorf("%s: size does not match its parent: %w", e.id, ErrBlobCorrupt)
+		}
+		n, err := w.Write(data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+var errWriterFull = errors.New("writer full")
+
+// limitedWriter keeps the first n bytes written to it and then fails, so
+// Head stops reading objects once it has enough.
+type limitedWriter struct {
+	w io.Writer
+	n int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > l.n {
+		l.w.Write(p[:l.n])
+		l.n = 0
+		return 0, errWriterFull
+	}
+	l.n -= len(p)
+	return l.w.Write(p)
+}
+
+// GCStats reports what a garbage collection did.
+type GCStats struct {
+	Kept       int   `json:"kept"`
+	Removed    int   `json:"removed"`
+	FreedBytes int64 `json:"freed_bytes"`
+}
+
+// GC removes the objects that are not part of an attachment in referenced
+// and are older than grace, along with temporary files left by failed
+// writes.
+func (b *Blobs) GC(referenced map[string]bool, grace time.Duration) (GCStats, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var stats GCStats
+	// live holds the paths of the objects to keep, since a tree and a
+	// chunk may share a hash.
+	live := make(map[string]bool)
+	for id := range referenced {
+		if IsBlobID(id) {
+			b.mark(live, id, true)
+			b.mark(live, id, false)
+		}
+	}
+
+	cutoff := time.Now().Add(-grace)
+	err := filepath.WalkDir(b.dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := d.Name()
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if live[path] || info.ModTime().After(cutoff) || (!IsBlobID(name) && !strings.Contains(name, ".tmp-")) {
+			stats.Kept++
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		stats.Removed++
+		stats.FreedBytes += info.Size()
+		return nil
+	})
+	return stats, err
+}
+
+// mark adds the object id and, if it is a tree, everything under it to
+// live. Missing or corrupt objects are left for GC to skip or remove.
+func (b *Blobs) mark(live map[string]bool, id string, tree bool) {
+	path := b.path(id, tree)
+	if live[path] {
+		return
+	}
+	live[path] = true
+	if !tree {
+		return
+	}
+	data, err := b.readObject(id, true)
+	if err != nil {
+		return
+	}
+	_, entries, err := parseTree(id, data)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		b.mark(live, e.id, e.tree)
+	}
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func openBlob(t *testing.T, b *Blobs, id string) []byte {
+	t.Helper()
+	bl, err := b.Open(id)
+	if err != nil {
+		t.Fatalf("open %s: %v", id, err)
+	}
+	var buf bytes.Buffer
+	if _, err := bl.WriteTo(&buf); err != nil {
+		t.Fatalf("read %s: %v", id, err)
+	}
+	return buf.Bytes()
+}
+
+func TestBlobsRoundTrip(t *testing.T) {
+	b := &Blobs{dir: t.TempDir()}
+	for _, size := range []int{0, 10, ChunkSize, ChunkSize + 1, 3*ChunkSize + 7} {
+		data := bytes.Repeat([]byte("blogochain"), size/10+1)[:size]
+		info, err := b.Put(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("put %d bytes: %v", size, err)
+		}
+		if info.Size != int64(size) {
+			t.Errorf("put %d bytes: size %d", size, info.Size)
+		}
+		// Up to ChunkSize bytes the file is one
+		// object named by its hash; beyond that, a tree of chunks.
+		sum := sha256.Sum256(data)
+		single := size <= ChunkSize
+		if (info.ID == hex.EncodeToString(sum[:])) != single || (info.Chunks == 1) != single {
+			t.Errorf("put %d bytes: ID %s with %d chunks, want a single object %t", size, info.ID, info.Chunks, single)
+		}
+		if got := openBlob(t, b, info.ID); !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: read back %d bytes that differ", size, len(got))
+		}
+	}
+}
+
+// An uploaded file shaped like a tree, whole or as a chunk of a larger
+// file, must be served as it is rather than expanded.
+func TestBlobsUploadedTreeIsNotFollowed(t *testing.T) {
+	b := &Blobs{dir: t.TempDir()}
+	inner, err := b.Put(bytes.NewReader(bytes.Repeat([]byte("x"), ChunkSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bomb bytes.Buffer
+	fmt.Fprintf(&bomb, "%s%d\n", treeMagic, 1000*int64(ChunkSize))
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&bomb, "c %s %d\n", inner.ID, ChunkSize)
+	}
+
+	small, err := b.Put(bytes.NewReader(bomb.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := openBlob(t, b, small.ID); !bytes.Equal(got, bomb.Bytes()) {
+		t.Errorf("file shaped like a tree was read as %d bytes, want it as uploaded", len(got))
+	}
+
+	padded := append(append([]byte{}, bomb.Bytes()...), bytes.Repeat([]byte("\n"), ChunkSize)...)
+	if _, err := b.Put(bytes.NewReader(padded)); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(padded[:ChunkSize])
+	chunk := hex.EncodeToString(sum[:])
+	if got := openBlob(t, b, chunk); len(got) != ChunkSize {
+		t.Errorf("chunk shaped like a tree was read as %d bytes, want %d", len(got), ChunkSize)
+	}
+}
+
+func TestBlobsTreeDepthLimit(t *testing.T) {
+	b := &Blobs{dir: t.TempDir()}
+	chunk, err := b.writeObject([]byte("x"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := b.writeTree([]treeEntry{{id: chunk, size: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for depth := 1; depth <= maxTreeDepth; depth++ {
+		got := openBlob(t, b, e.id)
+		if string(got) != "x" {
+			t.Fatalf("%d levels: read %q", depth, got)
+		}
+		if e, err = b.writeTree([]treeEntry{e}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bl, err := b.Open(e.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bl.WriteTo(&bytes.Buffer{}); !errors.Is(err, ErrBlobCorrupt) {
+		t.Errorf("%d levels of trees: got %v, want ErrBlobCorrupt", maxTreeDepth+1, err)
+	}
+}
+
+func TestBlobsGC(t *testing.T) {
+	b := &Blobs{dir: t.TempDir()}
+	keep, err := b.Put(bytes.NewReader(bytes.Repeat([]byte("k"), 2*ChunkSize+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	drop, err := b.Put(bytes.NewReader(bytes.Repeat([]byte("d"), 2*ChunkSize+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := b.GC(map[string]bool{keep.ID: true}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The kept file is a tree and two distinct chunks; so is the other.
+	if stats.Kept != 3 || stats.Removed != 3 {
+		t.Errorf("kept %d and removed %d objects, want 3 and 3", stats.Kept, stats.Removed)
+	}
+	if got := openBlob(t, b, keep.ID); len(got) != 2*ChunkSize+1 {
+		t.Errorf("kept file reads as %d bytes", len(got))
+	}
+	if _, err := b.Open(drop.ID); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("collected file: got %v, want ErrBlobNotFound", err)
+	}
+}
+
+// A slow upload must not hold the store's lock while it is read.
+func TestBlobsPutDoesNotBlockGC(t *testing.T) {
+	b := &Blobs{dir: t.TempDir()}
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.Put(pr)
+		done <- err
+	}()
+	if _, err := pw.Write(bytes.Repeat([]byte("s"), ChunkSize+10)); err != nil {
+		t.Fatal(err)
+	}
+
+	gc := make(chan error, 1)
+	go func() {
+		_, err := b.GC(nil, BlobGracePeriod)
+		gc <- err
+	}()
+	select {
+	case err := <-gc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GC waited for an upload still being read")
+	}
+
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
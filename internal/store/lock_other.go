@@ -0,0 +1,25 @@
+//go:build !unix
+
+package store
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// lockFile creates path exclusively. Unlike flock the file is left behind
+// if the process dies and must then be removed by hand.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, ErrLocked
+	}
+	return f, err
+}
+
+func unlockFile(f *os.File) error {
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
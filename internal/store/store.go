@@ -0,0 +1,235 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/eshahhh/blogochain/internal/blockchain"
+	"github.com/eshahhh/blogochain/internal/notary"
+)
+
+const (
+	chainFile   = "chain.json"
+	mempoolFile = "mempool.json"
+	notaryFile  = "notary.json"
+	lockName    = "LOCK"
+)
+
+var (
+	// ErrNoChain is returned by Load when the data directory holds no chain yet.
+	ErrNoChain = errors.New("no saved chain")
+	// ErrLocked is returned by Open when another process holds the directory.
+	ErrLocked = errors.New("data directory is in use by another process")
+)
+
+// Store keeps the chain and the pending pool as JSON files in a data
+// directory. Writes go to a temporary file that is renamed into place, so
+// a crash never leaves a half-written chain behind.
+type Store struct {
+	dir   string
+	lock  *os.File
+	blobs *Blobs
+
+	mu          sync.Mutex
+	lastChain   *blockchain.Blockchain
+	lastVersion uint64
+	lastErr     error
+}
+
+// ChainDoc is the format of chain.json and of chain exports.
+type ChainDoc struct {
+	Difficulty   int                           `json:"difficulty"`
+	Difficulties []blockchain.DifficultyChange `json:"difficulties,omitempty"`
+	Blocks       []*blockchain.Block           `json:"blocks"`
+}
+
+// Open creates dir if needed and locks it for this process until Close,
+// so a server and CLI invocations never write the same directory at once.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create data directory: %w", err)
+	}
+	lock, err := lockFile(filepath.Join(dir, lockName))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	return &Store{dir: dir, lock: lock, blobs: &Blobs{dir: filepath.Join(dir, blobsDir)}}, nil
+}
+
+// Close releases the directory lock.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lock == nil {
+		return nil
+	}
+	err := unlockFile(s.lock)
+	s.lock = nil
+	return err
+}
+
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Load reads the saved state. A missing mempool file is treated as empty.
+func (s *Store) Load() (blockchain.State, error) {
+	var st blockchain.State
+
+	var doc ChainDoc
+	if err := readJSON(filepath.Join(s.dir, chainFile), &doc); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return st, ErrNoChain
+		}
+		return st, err
+	}
+	st.Difficulty = doc.Difficulty
+	st.Difficulties = doc.Difficulties
+	st.Chain = doc.Blocks
+
+	if err := readJSON(filepath.Join(s.dir, mempoolFile), &st.Pending); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return st, err
+	}
+	return st, nil
+}
+
+// LoadOrCreate restores the saved chain, or creates a fresh one with the
+// given difficulty when the directory is empty.
+func (s *Store) LoadOrCreate(difficulty int) (*blockchain.Blockchain, error) {
+	st, err := s.Load()
+	if errors.Is(err, ErrNoChain) {
+		return blockchain.NewBlockchain(difficulty), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return blockchain.Restore(st)
+}
+
+// Save writes bc to disk if it changed since the last Save. The chain is
+// written before the pending pool; if a crash comes between the two,
+// Restore drops the pending transactions the chain already holds.
+func (s *Store) Save(bc *blockchain.Blockchain) error {
+	st, version := bc.Snapshot()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if bc == s.lastChain && version == s.lastVersion {
+		return nil
+	}
+
+	if err := writeJSON(filepath.Join(s.dir, chainFile), ChainDoc{Difficulty: st.Difficulty, Difficulties: st.Difficulties, Blocks: st.Chain}); err != nil {
+		s.lastErr = err
+		return err
+	}
+	if err := writeJSON(filepath.Join(s.dir, mempoolFile), st.Pending); err != nil {
+		s.lastErr = err
+		return err
+	}
+	s.lastErr = nil
+	s.lastChain = bc
+	s.lastVersion = version
+	return nil
+}
+
+// LoadNotary reads the saved notarization batches.
+func (s *Store) LoadNotary() ([]notary.Batch, error) {
+	var batches []notary.Batch
+	err := readJSON(filepath.Join(s.dir, notaryFile), &batches)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return batches, err
+}
+
+// SaveNotary writes the notarization batches.
+func (s *Store) SaveNotary(batches []notary.Batch) error {
+	return writeJSON(filepath.Join(s.dir, notaryFile), batches)
+}
+
+// Reset deletes the saved chain, mempool and notarization batches.
+func (s *Store) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range []string{chainFile, mempoolFile, notaryFile} {
+		if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	s.lastChain = nil
+	return nil
+}
+
+// Err returns the error from the most recent Save, if it failed.
+func (s *Store) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastErr
+}
+
+// AutoSave saves bc every interval until ctx is done. The caller is
+// expected to Save once more after shutting down everything that mutates
+// the chain.
+func (s *Store) AutoSave(ctx context.Context, bc *blockchain.Blockchain, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Save(bc); err != nil {
+				log.Printf("[STORE] autosave failed: %v", err)
+			}
+		}
+	}
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data)
+}
+
+// writeFile writes data to a temporary file and renames it to path.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
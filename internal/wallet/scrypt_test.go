@@ -0,0 +1,56 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// The test vectors of RFC 7914, sections 11 and 12.
+func TestScryptKey(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		n, r, p        int
+		want           string
+	}{
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+		{"pleaseletmein", "SodiumChloride", 16384, 8, 1, "7023bdcb3afd7348461c06cd81fd38ebfda8fbba904f8e3ea9b543f6545da1f2d5432955613f0fcf62d49705242a9af9e61e85dc0d651e40dfcf017b45575887"},
+	}
+	for _, tt := range tests {
+		key, err := scryptKey([]byte(tt.password), []byte(tt.salt), tt.n, tt.r, tt.p, 64)
+		if err != nil {
+			t.Fatalf("scrypt(%q, %q, %d, %d, %d): %v", tt.password, tt.salt, tt.n, tt.r, tt.p, err)
+		}
+		if got := hex.EncodeToString(key); got != tt.want {
+			t.Errorf("scrypt(%q, %q, %d, %d, %d) = %s, want %s", tt.password, tt.salt, tt.n, tt.r, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	const want = "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if got := hex.EncodeToString(pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)); got != want {
+		t.Errorf("pbkdf2 = %s, want %s", got, want)
+	}
+}
+
+func TestScryptKeyRejectsBadParameters(t *testing.T) {
+	for _, c := range [][3]int{{0, 8, 1}, {3, 8, 1}, {16, 0, 1}, {16, 1, 0}, {1 << 20, 1 << 10, 1}} {
+		if _, err := scryptKey(nil, nil, c[0], c[1], c[2], 32); err == nil {
+			t.Errorf("scrypt with N=%d, r=%d, p=%d succeeded", c[0], c[1], c[2])
+		}
+	}
+}
+
+func TestOpenRejectsCostlyKeystore(t *testing.T) {
+	for _, s := range []sealedKey{
+		{N: maxScryptN * 2, R: scryptR, P: scryptP},
+		{N: scryptN, R: maxScryptR + 1, P: scryptP},
+		{N: scryptN, R: scryptR, P: maxScryptP + 1},
+	} {
+		s.Cipher, s.KDF = "aes-256-gcm", "scrypt"
+		if _, err := open(s, nil, "passphrase"); err == nil || err == ErrBadPassphrase {
+			t.Errorf("open with N=%d, r=%d, p=%d: got %v, want a cost error", s.N, s.R, s.P, err)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+// Package wallet keeps ed25519 signing keys in a keystore directory. Each
+// account is a JSON file holding its public address in the clear and its
+// private key encrypted with AES-256-GCM under a key derived from the
+// account's passphrase with scrypt.
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default scrypt cost: about 32 MiB and a tenth of a second per unlock.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// The most a keystore file may ask for: N and r set the memory, 128*r*N
+// bytes, and p multiplies the time.
+const (
+	maxScryptN = 1 << 20
+	maxScryptR = 32
+	maxScryptP = 16
+)
+
+// defaultFile names the file recording the selected account.
+const defaultFile = "default"
+
+var (
+	ErrNoAccount     = errors.New("no such account")
+	ErrAccountExists = errors.New("account already exists")
+	ErrBadName       = errors.New("account names are 1 to 64 letters, digits, '-' or '_'")
+	ErrBadPassphrase = errors.New("wrong passphrase, or the account file is damaged")
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Account describes a key in the keystore. Address is the hex ed25519
+// public key, which blog transactions name as their author.
+type Account struct {
+	Name    string    `json:"name"`
+	Address string    `json:"address"`
+	Created time.Time `json:"created"`
+}
+
+// keyFile is the format of an account's file.
+type keyFile struct {
+	Account
+	Crypto sealedKey `json:"crypto"`
+}
+
+// sealedKey is an encrypted ed25519 seed and how to decrypt it. The
+// address is authenticated along with the ciphertext, so a key cannot be
+// moved to another account's file unnoticed.
+type sealedKey struct {
+	Cipher     string `json:"cipher"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// Keystore is a directory of account files.
+type Keystore struct {
+	dir string
+}
+
+// Open returns the keystore in dir, creating the directory if needed.
+func Open(dir string) (*Keystore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Keystore{dir: dir}, nil
+}
+
+// Create generates a key and stores it as account name.
+func (k *Keystore) Create(name, passphrase string) (Account, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Account{}, err
+	}
+	return k.Import(name, priv, passphrase)
+}
+
+// Import stores key as account name, encrypted with passphrase.
+func (k *Keystore) Import(name string, key ed25519.PrivateKey, passphrase string) (Account, error) {
+	if !validName.MatchString(name) {
+		return Account{}, ErrBadName
+	}
+	acct := Account{
+		Name:    name,
+		Address: hex.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+	sealed, err := seal(key.Seed(), []byte(acct.Address), passphrase)
+	if err != nil {
+		return Account{}, err
+	}
+	data, err := json.MarshalIndent(keyFile{Account: acct, Crypto: sealed}, "", "  ")
+	if err != nil {
+		return Account{}, err
+	}
+	if err := k.writeNew(k.path(name), data); err != nil {
+		return Account{}, err
+	}
+	return acct, nil
+}
+
+// writeNew writes data to path, failing with ErrAccountExists rather than
+// replacing a file that is already there.
+func (k *Keystore) writeNew(path string, data []byte) error {
+	tmp, err := os.CreateTemp(k.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	err = os.Link(tmp.Name(), path)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s: %w", strings.TrimSuffix(filepath.Base(path), ".json"), ErrAccountExists)
+	}
+	return err
+}
+
+// Accounts returns every account, sorted by name.
+func (k *Keystore) Accounts() ([]Account, error) {
+	paths, err := filepath.Glob(filepath.Join(k.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	accts := make([]Account, 0, len(paths))
+	for _, p := range paths {
+		kf, err := readKeyFile(p)
+		if err != nil {
+			return nil, err
+		}
+		accts = append(accts, kf.Account)
+	}
+	sort.Slice(accts, func(i, j int) bool { return accts[i].Name < accts[j].Name })
+	return accts, nil
+}
+
+// Account returns the account called name.
+func (k *Keystore) Account(name string) (Account, error) {
+	kf, err := k.load(name)
+	return kf.Account, err
+}
+
+// Unlock decrypts the key of account name with passphrase.
+func (k *Keystore) Unlock(name, passphrase string) (ed25519.PrivateKey, error) {
+	kf, err := k.load(name)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := open(kf.Crypto, []byte(kf.Address), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	if hex.EncodeToString(key.Public().(ed25519.PublicKey)) != kf.Address {
+		return nil, fmt.Errorf("account %s: key does not match its address", name)
+	}
+	return key, nil
+}
+
+// Default returns the name of the selected account, or "" if none is.
+func (k *Keystore) Default() (string, error) {
+	data, err := os.ReadFile(filepath.Join(k.dir, defaultFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+// SetDefault selects account name.
+func (k *Keystore) SetDefault(name string) error {
+	if _, err := k.load(name); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(k.dir, defaultFile), []byte(name+"\n"), 0o600)
+}
+
+func (k *Keystore) path(name string) string {
+	return filepath.Join(k.dir, name+".json")
+}
+
+func (k *Keystore) load(name string) (keyFile, error) {
+	if !validName.MatchString(name) {
+		return keyFile{}, ErrBadName
+	}
+	kf, err := readKeyFile(k.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return kf, fmt.Errorf("%s: %w", name, ErrNoAccount)
+	}
+	return kf, err
+}
+
+func readKeyFile(path string) (keyFile, error) {
+	var kf keyFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return kf, err
+	}
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return kf, fmt.Errorf("%s: %w", path, err)
+	}
+	return kf, nil
+}
+
+// seal encrypts seed under passphrase, authenticating ad with it.
+func seal(seed, ad []byte, passphrase string) (sealedKey, error) {
+	s := sealedKey{Cipher: "aes-256-gcm", KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP}
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return s, err
+	}
+	aead, err := newAEAD(passphrase, salt, s)
+	if err != nil {
+		return s, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return s, err
+	}
+	s.Salt = hex.EncodeToString(salt)
+	s.Nonce = hex.EncodeToString(nonce)
+	s.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, seed, ad))
+	return s, nil
+}
+
+// open reverses seal.
+func open(s sealedKey, ad []byte, passphrase string) ([]byte, error) {
+	if s.Cipher != "aes-256-gcm" || s.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported keystore encryption %s with %s", s.Cipher, s.KDF)
+	}
+	if s.N > maxScryptN {
+		return nil, fmt.Errorf("keystore scrypt cost %d is above the limit of %d", s.N, maxScryptN)
+	}
+	if s.R > maxScryptR || s.P > maxScryptP {
+		return nil, fmt.Errorf("keystore scrypt r=%d, p=%d is above the limit of r=%d, p=%d", s.R, s.P, maxScryptR, maxScryptP)
+	}
+	salt, err1 := hex.DecodeString(s.Salt)
+	nonce, err2 := hex.DecodeString(s.Nonce)
+	ciphertext, err3 := hex.DecodeString(s.Ciphertext)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, fmt.Errorf("malformed keystore file: %w", err)
+	}
+	aead, err := newAEAD(passphrase, salt, s)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("malformed keystore file: bad nonce")
+	}
+	seed, err := aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("malformed keystore file: bad key length")
+	}
+	return seed, nil
+}
+
+func newAEAD(passphrase string, salt []byte, s sealedKey) (cipher.AEAD, error) {
+	key, err := scryptKey([]byte(passphrase), salt, s.N, s.R, s.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}